@@ -5,14 +5,23 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"time"
 
 	"github.com/mtsgn/mtsgn-mtsgn-system-common-svc/common/logger"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/auth"
 	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/handlers"
 	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/middleware"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/problem"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/transform"
 	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/geoip"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/ipfilter"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/proxyproto"
 	rds "github.com/mtsgn/mtsgn-system-gateway-svc/pkg/redis"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/tracing"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/utils"
 )
 
 var (
@@ -40,12 +49,19 @@ func main() {
 		return
 	}
 
+	// --------------- Client IP Resolution ---------------------------- //
+	ipResolver, err := utils.NewClientIPResolver(cfg.Server.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Invalid trusted proxy configuration: %v", err)
+	}
+
 	// --------------- Setup Local Rate Limiter ---------------------------- //
 	localLimiter := rds.NewTokenBucketLimiter(
 		cfg.RateLimit.RequestsPerSecond,
 		cfg.RateLimit.Burst,
 	)
 	var redisLimiter *rds.RedisSlidingWindowLimiter = nil
+	var redisClient *rds.RedisClient = nil
 	var rateLimiter rds.RateLimiter = localLimiter
 	// Try to initialize Redis limiter if configured
 	if cfg.Redis.Host != "" {
@@ -58,23 +74,135 @@ func main() {
 			zeroLogger.Error(ctx, "Failed to connect to Redis, using local limiter", err)
 		} else {
 			rateLimiter = redisLimiter
+			redisClient, err = rds.InitRedis(cfg.Redis)
+			if err != nil {
+				zeroLogger.Error(ctx, "Failed to connect to Redis, using local state", err)
+			}
+		}
+	}
+
+	// --------------- IP Filter & Bans ---------------------------- //
+	var denyList rds.DenyList = rds.NewLocalDenyList()
+	if redisClient != nil {
+		redisDenyList := rds.NewRedisDenyList(redisClient, time.Duration(cfg.Admin.DenyListRefreshSeconds)*time.Second)
+		if err := redisDenyList.Refresh(ctx); err != nil {
+			zeroLogger.Error(ctx, "Failed to load deny list, retrying in background", "error", err)
+		}
+		go redisDenyList.Watch(ctx, *zeroLogger)
+		denyList = redisDenyList
+	}
+	var banStore rds.BanStore = rds.NewLocalBanStore()
+	if redisClient != nil {
+		banStore = rds.NewRedisBanStore(redisClient)
+	}
+	var countries ipfilter.CountryLookup
+	if cfg.GeoIP.DatabasePath != "" {
+		geoReader, err := geoip.Open(cfg.GeoIP.DatabasePath)
+		if err != nil {
+			log.Fatalf("Failed to load geoip database: %v", err)
 		}
+		defer geoReader.Close()
+		countries = geoReader
+	}
+	ipFilter, err := ipfilter.NewFilter(cfg, countries, denyList)
+	if err != nil {
+		log.Fatalf("Invalid ip filter configuration: %v", err)
+	}
+
+	// --------------- Tracing ---------------------------- //
+	shutdownTracing, err := tracing.Init(ctx, cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to configure tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	// --------------- Signing Keys ---------------------------- //
+	keyRing, err := auth.NewKeyRing(cfg.Auth)
+	if err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+	go keyRing.Watch(ctx, *zeroLogger)
+	verifiers, err := auth.NewVerifiers(cfg.Auth, keyRing)
+	if err != nil {
+		log.Fatalf("Failed to configure token verifiers: %v", err)
+	}
+	verifiers = verifiers.WithTokenCache(cfg.Auth.TokenCache, keyRing, middleware.RecordTokenCache)
+
+	// --------------- Token Revocation ---------------------------- //
+	var revocations *auth.RevocationChecker = nil
+	if cfg.Auth.Revocation.Enabled {
+		var revocationStore rds.RevocationStore = rds.NewLocalRevocationStore()
+		if redisClient != nil {
+			revocationStore = rds.NewRedisRevocationStore(redisClient)
+		}
+		revocations = auth.NewRevocationChecker(revocationStore, cfg.Auth.Revocation)
+		go revocations.Listen(ctx, *zeroLogger)
+	}
+
+	// --------------- API Keys ---------------------------- //
+	var apiKeyStore rds.APIKeyStore
+	if redisClient != nil {
+		apiKeyStore = rds.NewRedisAPIKeyStore(redisClient)
+	} else {
+		apiKeyStore, err = rds.NewLocalAPIKeyStore(cfg.Auth.APIKeys.File)
+		if err != nil {
+			log.Fatalf("Failed to load api keys: %v", err)
+		}
+	}
+	apiKeys := auth.NewAPIKeyAuthenticator(apiKeyStore, cfg.Auth.APIKeys)
+
+	// --------------- Response Cache ---------------------------- //
+	var responseCache rds.ResponseCache = rds.NewLocalResponseCache(cfg.Cache.MaxEntries, cfg.Cache.MaxBytes)
+	if redisClient != nil {
+		responseCache = rds.NewRedisResponseCache(redisClient)
+	}
+
+	problems, err := problem.NewWriter(cfg.Errors, cfg.Services)
+	if err != nil {
+		log.Fatalf("Failed to load error templates: %v", err)
+	}
+
+	headerRules, err := transform.NewHeaders(cfg.Services)
+	if err != nil {
+		log.Fatalf("Invalid header rules: %v", err)
+	}
+
+	pathRewrites, err := transform.NewPaths(cfg.Services)
+	if err != nil {
+		log.Fatalf("Invalid path rewrites: %v", err)
+	}
+
+	accessLog, err := middleware.NewAccessLog(cfg.AccessLog)
+	if err != nil {
+		log.Fatalf("Invalid access log configuration: %v", err)
 	}
 
 	zeroLogger.Info(ctx, "API Gateway initialized", "rate_limiter", fmt.Sprintf("%T", rateLimiter))
 	// Initialize handlers
-	proxyHandler := handlers.NewProxyHandler(cfg, rateLimiter, redisLimiter, *zeroLogger)
+	proxyHandler, err := handlers.NewProxyHandler(cfg, handlers.ProxyDeps{
+		RateLimiter:   rateLimiter,
+		RedisLimiter:  redisLimiter,
+		IPFilter:      ipFilter,
+		BanStore:      banStore,
+		Verifiers:     verifiers,
+		Revocations:   revocations,
+		APIKeys:       apiKeys,
+		ResponseCache: responseCache,
+		Headers:       headerRules,
+		Paths:         pathRewrites,
+		Problems:      problems,
+		Logger:        *zeroLogger,
+	})
+	if err != nil {
+		log.Fatalf("Invalid proxy configuration: %v", err)
+	}
+	adminHandler := handlers.NewAdminHandler(cfg, denyList, banStore, revocations, apiKeyStore, problems, *zeroLogger)
 
 	// Setup HTTP server with middlewares
 	mux := http.NewServeMux()
 
 	// Apply global middleware
-	handler := middleware.Logger(
-		middleware.CORS(
-			proxyHandler,
-		),
-		*zeroLogger,
-	)
+	handler := newHandler(proxyHandler, middleware.NewCompressor(cfg.Compression, cfg.Services), accessLog, *zeroLogger, ipResolver)
 
 	// Register routes
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -83,13 +211,79 @@ func main() {
 		w.Write([]byte(`{"status":"healthy","service":"api-gateway"}`))
 	})
 
+	adminChain := middleware.ClientIP(middleware.RequestID(proxyHandler.Protect(adminHandler)), ipResolver)
+	if cfg.Admin.Port > 0 && cfg.Admin.Port != cfg.Server.Port {
+		adminMux := http.NewServeMux()
+		adminMux.Handle("/admin/", adminChain)
+		adminAddr := fmt.Sprintf(":%d", cfg.Admin.Port)
+		go func() {
+			zeroLogger.Info(ctx, "Admin API listening on", "addr", adminAddr)
+			if err := http.ListenAndServe(adminAddr, adminMux); err != nil {
+				zeroLogger.Error(ctx, "Admin server failed", "error", err)
+			}
+		}()
+	} else {
+		mux.Handle("/admin/", adminChain)
+	}
 	mux.Handle("/", handler)
 
+	if cfg.Metrics.Enabled {
+		metricsPath := cfg.Metrics.Path
+		if metricsPath == "" {
+			metricsPath = "/metrics"
+		}
+		if cfg.Metrics.Port > 0 && cfg.Metrics.Port != cfg.Server.Port {
+			metricsMux := http.NewServeMux()
+			metricsMux.Handle(metricsPath, handlers.MetricsHandler())
+			metricsAddr := fmt.Sprintf(":%d", cfg.Metrics.Port)
+			go func() {
+				zeroLogger.Info(ctx, "Metrics listening on", "addr", metricsAddr, "path", metricsPath)
+				if err := http.ListenAndServe(metricsAddr, metricsMux); err != nil {
+					zeroLogger.Error(ctx, "Metrics server failed", "error", err)
+				}
+			}()
+		} else {
+			mux.Handle(metricsPath, handlers.MetricsHandler())
+		}
+	}
+
 	// Start server
 	addr := fmt.Sprintf(":%d", cfg.Server.Port)
 	zeroLogger.Info(ctx, "API Gateway starting on", "addr", addr)
 	zeroLogger.Info(ctx, "Configured services", "count", len(cfg.Services))
-	if err := http.ListenAndServe(addr, mux); err != nil {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
 		zeroLogger.Error(ctx, "Server failed to start", "error", err)
+		return
 	}
+	if cfg.Server.ProxyProtocol {
+		listener = proxyproto.NewListener(listener, ipResolver.IsTrusted)
+		zeroLogger.Info(ctx, "PROXY protocol enabled for trusted proxies", "trusted_proxies", cfg.Server.TrustedProxies)
+	}
+	if err := http.Serve(listener, mux); err != nil {
+		zeroLogger.Error(ctx, "Server failed to start", "error", err)
+	}
+}
+
+// newHandler wraps the proxy in the global middleware chain.
+func newHandler(proxy http.Handler, compressor *middleware.Compressor, accessLog *middleware.AccessLog, zeroLogger logger.ZeroLogger, ipResolver *utils.ClientIPResolver) http.Handler {
+	return middleware.ClientIP(
+		middleware.RequestID(
+			middleware.Metrics(
+				middleware.Tracing(
+					middleware.Logger(
+						middleware.Compression(
+							middleware.CORS(
+								proxy,
+							),
+							compressor,
+						),
+						accessLog,
+						zeroLogger,
+					),
+				),
+			),
+		),
+		ipResolver,
+	)
 }
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/mtsgn/mtsgn-mtsgn-system-common-svc/common/logger"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/middleware"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/utils"
+)
+
+// Streaming responses rely on every wrapper in the chain passing flushes on.
+func TestNewHandler_Flush(t *testing.T) {
+	accessLog, err := middleware.NewAccessLog(config.AccessLogConfig{Output: filepath.Join(t.TempDir(), "access.log")})
+	if err != nil {
+		t.Fatalf("NewAccessLog() error = %v", err)
+	}
+	resolver, err := utils.NewClientIPResolver(nil)
+	if err != nil {
+		t.Fatalf("NewClientIPResolver() error = %v", err)
+	}
+
+	var flushErr error
+	stream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: 1\n\n"))
+		flushErr = http.NewResponseController(w).Flush()
+	})
+	handler := newHandler(stream, middleware.NewCompressor(config.CompressionConfig{}, nil), accessLog, logger.ZeroLogger{}, resolver)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/events", nil))
+	if flushErr != nil || !w.Flushed {
+		t.Errorf("Flush() error = %v, recorder flushed = %v, want the flush to reach the client", flushErr, w.Flushed)
+	}
+}
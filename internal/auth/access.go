@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+)
+
+// Reasons returned when an access rule denies a verified token.
+const (
+	ReasonMissingScope  = "missing_scope"
+	ReasonMissingRole   = "missing_role"
+	ReasonAdminRequired = "admin_required"
+	ReasonClaimMismatch = "claim_mismatch"
+)
+
+// AccessDeniedError is returned when a valid token does not satisfy the
+// access rules of a route.
+type AccessDeniedError struct {
+	Reason string
+}
+
+func (e *AccessDeniedError) Error() string {
+	return "access denied: " + e.Reason
+}
+
+// AccessPolicy holds the access rules of one service. Every rule matching the
+// request method and path must pass; requests matched by no rule are allowed.
+// Incomplete claim conditions never match, so a misconfigured rule denies.
+type AccessPolicy struct {
+	rules []config.AccessRule
+}
+
+// NewAccessPolicy returns nil when there are no rules.
+func NewAccessPolicy(rules []config.AccessRule) *AccessPolicy {
+	if len(rules) == 0 {
+		return nil
+	}
+	return &AccessPolicy{rules: rules}
+}
+
+// Authorize returns nil or an *AccessDeniedError for the first failing rule.
+func (p *AccessPolicy) Authorize(method, path string, claims Claims) error {
+	if p == nil {
+		return nil
+	}
+	for _, rule := range p.rules {
+		if !ruleApplies(rule, method, path) {
+			continue
+		}
+		if reason := checkRule(rule, claims); reason != "" {
+			return &AccessDeniedError{Reason: reason}
+		}
+	}
+	return nil
+}
+
+func ruleApplies(rule config.AccessRule, method, path string) bool {
+	if len(rule.Methods) > 0 && !slices.ContainsFunc(rule.Methods, func(m string) bool {
+		return strings.EqualFold(m, method)
+	}) {
+		return false
+	}
+	if len(rule.Paths) == 0 {
+		return true
+	}
+	for _, pattern := range rule.Paths {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		} else if path == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func checkRule(rule config.AccessRule, claims Claims) string {
+	if rule.Admin && !isTrue(claims["isAdmin"]) {
+		return ReasonAdminRequired
+	}
+
+	// All listed scopes are required, as in OAuth2.
+	if len(rule.Scopes) > 0 {
+		granted := claims.Scopes()
+		for _, scope := range rule.Scopes {
+			if !slices.Contains(granted, scope) {
+				return ReasonMissingScope
+			}
+		}
+	}
+
+	// Any one of the listed roles is enough.
+	if len(rule.Roles) > 0 {
+		roles := claims.Roles()
+		if !slices.ContainsFunc(rule.Roles, func(role string) bool {
+			return slices.Contains(roles, role)
+		}) {
+			return ReasonMissingRole
+		}
+	}
+
+	for _, condition := range rule.Claims {
+		if !claimMatches(claims.Lookup(condition.Claim), condition) {
+			return ReasonClaimMismatch
+		}
+	}
+	return ""
+}
+
+// Scopes returns the granted scopes from a space separated "scope" claim or a
+// "scopes" list.
+func (c Claims) Scopes() []string {
+	if scope := c.String("scope"); scope != "" {
+		return strings.Fields(scope)
+	}
+	return stringList(c["scopes"])
+}
+
+// Roles returns the "roles" list, or the single "role" claim.
+func (c Claims) Roles() []string {
+	if roles := stringList(c["roles"]); len(roles) > 0 {
+		return roles
+	}
+	return stringList(c["role"])
+}
+
+// Lookup returns a claim by dotted path, e.g. "customClaims.tenant".
+func (c Claims) Lookup(path string) interface{} {
+	var value interface{} = map[string]interface{}(c)
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		if value, ok = object[name]; !ok {
+			return nil
+		}
+	}
+	return value
+}
+
+// claimMatches compares scalar claims directly; a list claim matches when any
+// of its elements does.
+func claimMatches(value interface{}, condition config.ClaimCondition) bool {
+	if value == nil {
+		return false
+	}
+	accepted := condition.In
+	if condition.Equals != "" {
+		accepted = append([]string{condition.Equals}, accepted...)
+	}
+	if list, ok := value.([]interface{}); ok {
+		for _, item := range list {
+			if slices.Contains(accepted, fmt.Sprint(item)) {
+				return true
+			}
+		}
+		return false
+	}
+	return slices.Contains(accepted, fmt.Sprint(value))
+}
+
+func stringList(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	default:
+		return nil
+	}
+}
+
+func isTrue(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(v, "true")
+	default:
+		return false
+	}
+}
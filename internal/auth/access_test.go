@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+)
+
+func TestAccessPolicy_Authorize(t *testing.T) {
+	policy := NewAccessPolicy([]config.AccessRule{
+		{Scopes: []string{"roles:read"}},
+		{Methods: []string{"POST", "DELETE"}, Roles: []string{"owner", "editor"}},
+		{Paths: []string{"/api/v1/role-permission/admin/*"}, Admin: true},
+		{Paths: []string{"/api/v1/role-permission/tenants/acme"}, Claims: []config.ClaimCondition{
+			{Claim: "customClaims.tenant", Equals: "acme"},
+			{Claim: "groups", In: []string{"ops", "eng"}},
+		}},
+	})
+
+	reader := Claims{"scope": "roles:read profile"}
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		claims Claims
+		reason string
+	}{
+		{"scope granted", "GET", "/api/v1/role-permission/roles", reader, ""},
+		{"scope list claim", "GET", "/api/v1/role-permission/roles", Claims{"scopes": []interface{}{"roles:read"}}, ""},
+		{"missing scope", "GET", "/api/v1/role-permission/roles", Claims{"scope": "profile"}, ReasonMissingScope},
+		{"role not needed for GET", "GET", "/api/v1/role-permission/roles", reader, ""},
+		{"missing role", "POST", "/api/v1/role-permission/roles", reader, ReasonMissingRole},
+		{"any role", "delete", "/api/v1/role-permission/roles", Claims{"scope": "roles:read", "roles": []interface{}{"viewer", "editor"}}, ""},
+		{"admin required", "GET", "/api/v1/role-permission/admin/users", reader, ReasonAdminRequired},
+		{"admin", "GET", "/api/v1/role-permission/admin/users", Claims{"scope": "roles:read", "isAdmin": true}, ""},
+		{"claims match", "GET", "/api/v1/role-permission/tenants/acme", Claims{
+			"scope":        "roles:read",
+			"customClaims": map[string]interface{}{"tenant": "acme"},
+			"groups":       []interface{}{"sales", "ops"},
+		}, ""},
+		{"nested claim mismatch", "GET", "/api/v1/role-permission/tenants/acme", Claims{
+			"scope":        "roles:read",
+			"customClaims": map[string]interface{}{"tenant": "globex"},
+			"groups":       []interface{}{"ops"},
+		}, ReasonClaimMismatch},
+		{"missing claim", "GET", "/api/v1/role-permission/tenants/acme", Claims{
+			"scope":        "roles:read",
+			"customClaims": map[string]interface{}{"tenant": "acme"},
+		}, ReasonClaimMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Authorize(tt.method, tt.path, tt.claims)
+			var denied *AccessDeniedError
+			switch {
+			case tt.reason == "" && err != nil:
+				t.Errorf("Authorize() error = %v, want nil", err)
+			case tt.reason != "" && (!errors.As(err, &denied) || denied.Reason != tt.reason):
+				t.Errorf("Authorize() error = %v, want %s", err, tt.reason)
+			}
+		})
+	}
+}
+
+func TestAccessPolicy_IncompleteConditionDenies(t *testing.T) {
+	policy := NewAccessPolicy([]config.AccessRule{{Claims: []config.ClaimCondition{{Claim: "tenant"}}}})
+	if err := policy.Authorize("GET", "/", Claims{"tenant": "acme"}); err == nil {
+		t.Error("Authorize() error = nil, want denial for a condition without values")
+	}
+	if err := NewAccessPolicy(nil).Authorize("GET", "/", Claims{}); err != nil {
+		t.Errorf("Authorize() error = %v without rules", err)
+	}
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+	rds "github.com/mtsgn/mtsgn-system-gateway-svc/pkg/redis"
+)
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	ctx := context.Background()
+	store, _ := rds.NewLocalAPIKeyStore("")
+	valid, _ := GenerateAPIKey()
+	expired, _ := GenerateAPIKey()
+	store.Put(ctx, rds.APIKey{Hash: HashAPIKey(valid), Owner: "partner-a", Scopes: []string{"orders:read"}})
+	store.Put(ctx, rds.APIKey{Hash: HashAPIKey(expired), Owner: "partner-b", ExpiresAt: time.Now().Add(-time.Minute)})
+
+	authenticator := NewAPIKeyAuthenticator(store, config.APIKeyConfig{QueryParam: "api_key"})
+
+	tests := []struct {
+		name    string
+		target  string
+		header  string
+		wantErr error
+	}{
+		{"header", "/orders", valid, nil},
+		{"query param", "/orders?api_key=" + valid + "&page=2", "", nil},
+		{"missing", "/orders", "", ErrMissingAPIKey},
+		{"unknown", "/orders", "gk_unknown", ErrInvalidAPIKey},
+		{"expired", "/orders", expired, ErrAPIKeyExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.target, nil)
+			if tt.header != "" {
+				r.Header.Set("X-API-Key", tt.header)
+			}
+			key, err := authenticator.Authenticate(ctx, r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if key.Owner != "partner-a" {
+				t.Errorf("Authenticate() owner = %q, want partner-a", key.Owner)
+			}
+
+			authenticator.StripCredentials(r)
+			if r.Header.Get("X-API-Key") != "" || r.URL.Query().Has("api_key") {
+				t.Error("StripCredentials() left the key on the request")
+			}
+			if tt.name == "query param" && r.URL.Query().Get("page") != "2" {
+				t.Error("StripCredentials() removed other query parameters")
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+)
+
+var (
+	ErrTokenInactive       = errors.New("token is not active")
+	ErrIntrospectionFailed = errors.New("token introspection failed")
+)
+
+const (
+	defaultIntrospectionTimeout   = 5 * time.Second
+	defaultIntrospectionCacheTTL  = time.Minute
+	defaultIntrospectionNegTTL    = 10 * time.Second
+	defaultIntrospectionCacheSize = 10000
+)
+
+// IntrospectionVerifier validates opaque tokens with an RFC 7662 endpoint.
+// Active results are cached until the token expires or CacheSeconds pass,
+// inactive ones for NegativeCacheSeconds. Endpoint failures are not cached.
+// exp is optional in introspection responses; without it the cache TTL is
+// the only bound.
+type IntrospectionVerifier struct {
+	endpoint     string
+	clientID     string
+	clientSecret string
+	httpClient   *http.Client
+	positiveTTL  time.Duration
+	negativeTTL  time.Duration
+	maxEntries   int
+	now          func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]introspectionEntry
+}
+
+type introspectionEntry struct {
+	claims    Claims // nil for inactive tokens
+	expiresAt time.Time
+}
+
+func NewIntrospectionVerifier(cfg config.IntrospectionConfig) *IntrospectionVerifier {
+	timeout := defaultIntrospectionTimeout
+	if cfg.TimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+	positiveTTL := defaultIntrospectionCacheTTL
+	if cfg.CacheSeconds > 0 {
+		positiveTTL = time.Duration(cfg.CacheSeconds) * time.Second
+	}
+	negativeTTL := defaultIntrospectionNegTTL
+	if cfg.NegativeCacheSeconds > 0 {
+		negativeTTL = time.Duration(cfg.NegativeCacheSeconds) * time.Second
+	}
+	maxEntries := defaultIntrospectionCacheSize
+	if cfg.CacheSize > 0 {
+		maxEntries = cfg.CacheSize
+	}
+
+	return &IntrospectionVerifier{
+		endpoint:     cfg.Endpoint,
+		clientID:     cfg.ClientID,
+		clientSecret: cfg.ClientSecret,
+		httpClient:   &http.Client{Timeout: timeout},
+		positiveTTL:  positiveTTL,
+		negativeTTL:  negativeTTL,
+		maxEntries:   maxEntries,
+		now:          time.Now,
+		cache:        make(map[string]introspectionEntry),
+	}
+}
+
+func (v *IntrospectionVerifier) Verify(ctx context.Context, token string, validator Validator) (Claims, error) {
+	sum := sha256.Sum256([]byte(token))
+	cacheKey := hex.EncodeToString(sum[:])
+
+	claims, cached := v.cached(cacheKey)
+	if !cached {
+		var err error
+		claims, err = v.introspect(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		v.remember(cacheKey, claims)
+	}
+
+	if claims == nil {
+		return nil, ErrTokenInactive
+	}
+	validator.expOptional = true
+	if err := validator.Validate(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *IntrospectionVerifier) introspect(ctx context.Context, token string) (Claims, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIntrospectionFailed, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if v.clientID != "" {
+		req.SetBasicAuth(url.QueryEscape(v.clientID), url.QueryEscape(v.clientSecret))
+	}
+
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIntrospectionFailed, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: endpoint returned %d", ErrIntrospectionFailed, resp.StatusCode)
+	}
+
+	var claims Claims
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIntrospectionFailed, err)
+	}
+	if active, _ := claims["active"].(bool); !active {
+		return nil, nil
+	}
+	return claims, nil
+}
+
+func (v *IntrospectionVerifier) cached(key string) (Claims, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	entry, ok := v.cache[key]
+	if !ok {
+		return nil, false
+	}
+	if !v.now().Before(entry.expiresAt) {
+		delete(v.cache, key)
+		return nil, false
+	}
+	return entry.claims, true
+}
+
+func (v *IntrospectionVerifier) remember(key string, claims Claims) {
+	now := v.now()
+	expiresAt := now.Add(v.negativeTTL)
+	if claims != nil {
+		expiresAt = now.Add(v.positiveTTL)
+		if exp, ok, err := claims.Time("exp"); err == nil && ok && exp.Before(expiresAt) {
+			expiresAt = exp
+		}
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if len(v.cache) >= v.maxEntries {
+		for k, entry := range v.cache {
+			if !now.Before(entry.expiresAt) {
+				delete(v.cache, k)
+			}
+		}
+		// Still full: drop arbitrary entries rather than grow.
+		for k := range v.cache {
+			if len(v.cache) < v.maxEntries {
+				break
+			}
+			delete(v.cache, k)
+		}
+	}
+	v.cache[key] = introspectionEntry{claims: claims, expiresAt: expiresAt}
+}
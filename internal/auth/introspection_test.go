@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+)
+
+// newIntrospectionStub answers for "good" (active until exp) and treats any
+// other token as inactive. It counts calls to prove caching.
+func newIntrospectionStub(t *testing.T, exp time.Time, calls *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if user, pass, ok := r.BasicAuth(); !ok || user != "gateway" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm() error = %v", err)
+		}
+
+		response := map[string]interface{}{"active": false}
+		switch r.PostForm.Get("token") {
+		case "good":
+			response = map[string]interface{}{
+				"active":    true,
+				"sub":       "user-1",
+				"client_id": "mobile",
+				"scope":     "orders:read",
+				"exp":       exp.Unix(),
+			}
+		case "no-exp":
+			response = map[string]interface{}{"active": true, "sub": "user-2"}
+		case "broken":
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}))
+}
+
+func TestIntrospectionVerifier(t *testing.T) {
+	now := time.Now()
+	var calls atomic.Int32
+	server := newIntrospectionStub(t, now.Add(30*time.Second), &calls)
+	defer server.Close()
+
+	verifier := NewIntrospectionVerifier(config.IntrospectionConfig{
+		Endpoint:     server.URL,
+		ClientID:     "gateway",
+		ClientSecret: "secret",
+		CacheSeconds: 300,
+	})
+	clock := now
+	verifier.now = func() time.Time { return clock }
+	validator := Validator{Now: func() time.Time { return clock }}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		claims, err := verifier.Verify(ctx, "good", validator)
+		if err != nil {
+			t.Fatalf("Verify() error = %v", err)
+		}
+		if claims.String("sub") != "user-1" || claims.String("client_id") != "mobile" {
+			t.Errorf("Verify() claims = %v", claims)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := verifier.Verify(ctx, "revoked", validator); !errors.Is(err, ErrTokenInactive) {
+			t.Fatalf("Verify() error = %v, want ErrTokenInactive", err)
+		}
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("endpoint calls = %d, want 2 with caching", got)
+	}
+
+	// Active results must not be reused past the token's exp even though
+	// cache_seconds is longer.
+	clock = now.Add(31 * time.Second)
+	if _, err := verifier.Verify(ctx, "good", validator); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Verify() error = %v, want ErrTokenExpired", err)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("endpoint calls = %d, want a fresh introspection after exp", got)
+	}
+
+	// Negative results expire after the default negative TTL.
+	clock = now.Add(time.Minute)
+	verifier.Verify(ctx, "revoked", validator)
+	if got := calls.Load(); got != 4 {
+		t.Errorf("endpoint calls = %d, want a fresh introspection after the negative TTL", got)
+	}
+
+	// Failures are reported and not cached.
+	for i := 0; i < 2; i++ {
+		if _, err := verifier.Verify(ctx, "broken", validator); !errors.Is(err, ErrIntrospectionFailed) {
+			t.Fatalf("Verify() error = %v, want ErrIntrospectionFailed", err)
+		}
+	}
+	if got := calls.Load(); got != 6 {
+		t.Errorf("endpoint calls = %d, want failures not cached", got)
+	}
+}
+
+func TestIntrospectionVerifier_WithoutExp(t *testing.T) {
+	var calls atomic.Int32
+	server := newIntrospectionStub(t, time.Now(), &calls)
+	defer server.Close()
+
+	verifier := NewIntrospectionVerifier(config.IntrospectionConfig{
+		Endpoint:     server.URL,
+		ClientID:     "gateway",
+		ClientSecret: "secret",
+		CacheSeconds: 60,
+	})
+	clock := time.Now()
+	verifier.now = func() time.Time { return clock }
+
+	claims, err := verifier.Verify(context.Background(), "no-exp", Validator{})
+	if err != nil || claims.String("sub") != "user-2" {
+		t.Fatalf("Verify() = %v, %v, want an active token without exp", claims, err)
+	}
+
+	// Without exp the configured cache TTL bounds the cached result.
+	verifier.Verify(context.Background(), "no-exp", Validator{})
+	if calls.Load() != 1 {
+		t.Errorf("introspection calls = %d, want 1 within the cache TTL", calls.Load())
+	}
+	clock = clock.Add(61 * time.Second)
+	verifier.Verify(context.Background(), "no-exp", Validator{})
+	if calls.Load() != 2 {
+		t.Errorf("introspection calls = %d, want the entry expired after cache_seconds", calls.Load())
+	}
+}
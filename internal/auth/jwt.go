@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var defaultJWTAlgorithms = []string{"RS256", "ES256", "EdDSA"}
+
+// JWTVerifier verifies JWS-signed JWTs. Asymmetric algorithms use the key ring
+// entry named by the header kid; HS256 uses the shared HMAC secret.
+type JWTVerifier struct {
+	ring       *KeyRing
+	hmacSecret []byte
+	methods    []string
+}
+
+func NewJWTVerifier(ring *KeyRing, hmacSecret []byte, algorithms []string) *JWTVerifier {
+	methods := algorithms
+	if len(methods) == 0 {
+		methods = append([]string(nil), defaultJWTAlgorithms...)
+		if len(hmacSecret) > 0 {
+			methods = append(methods, "HS256")
+		}
+	}
+	return &JWTVerifier{
+		ring:       ring,
+		hmacSecret: hmacSecret,
+		methods:    methods,
+	}
+}
+
+func (v *JWTVerifier) Verify(ctx context.Context, token string, validator Validator) (Claims, error) {
+	parsed, err := jwt.Parse(token, v.key,
+		jwt.WithValidMethods(v.methods),
+		jwt.WithoutClaimsValidation(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	mapClaims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("unexpected jwt claims type")
+	}
+	claims := Claims(mapClaims)
+	if err := validator.Validate(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *JWTVerifier) key(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if len(v.hmacSecret) == 0 {
+			return nil, fmt.Errorf("%s is not configured", token.Method.Alg())
+		}
+		return v.hmacSecret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	return v.ring.PublicKey(kid)
+}
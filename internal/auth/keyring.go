@@ -0,0 +1,332 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"aidanwoods.dev/go-paseto"
+	"github.com/mtsgn/mtsgn-mtsgn-system-common-svc/common/logger"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+)
+
+var ErrUnknownKey = errors.New("unknown key id")
+
+// KeyRing holds the public keys tokens may be signed with, indexed by key id
+// (kid). Keys are parsed once and reloaded when their source files change,
+// so signing keys can be rotated without restarting the gateway. The key
+// stored under the empty kid verifies tokens that carry no kid.
+type KeyRing struct {
+	cfg config.AuthConfig
+
+	mu       sync.RWMutex
+	keys     map[string]*publicKey
+	modTimes map[string]time.Time
+	// generation counts successful reloads, so results verified against an
+	// older set of keys can be told apart.
+	generation atomic.Uint64
+}
+
+type publicKey struct {
+	public crypto.PublicKey
+	paseto *paseto.V4AsymmetricPublicKey
+}
+
+// keySetDocument is a JWKS-like document listing public keys by kid.
+type keySetDocument struct {
+	Keys []struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		Hex string `json:"hex"`
+	} `json:"keys"`
+}
+
+func NewKeyRing(cfg config.AuthConfig) (*KeyRing, error) {
+	ring := &KeyRing{cfg: cfg}
+	if err := ring.Reload(); err != nil {
+		return nil, err
+	}
+	return ring, nil
+}
+
+// PasetoKey returns the PASETO v4 public key registered for kid.
+func (k *KeyRing) PasetoKey(kid string) (paseto.V4AsymmetricPublicKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key, ok := k.keys[kid]
+	if !ok || key.paseto == nil {
+		if kid == "" {
+			return paseto.V4AsymmetricPublicKey{}, fmt.Errorf("%w: token has no kid and no default key is configured", ErrUnknownKey)
+		}
+		return paseto.V4AsymmetricPublicKey{}, fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+	}
+	return *key.paseto, nil
+}
+
+// PublicKey returns the key registered for kid in its crypto form (Ed25519,
+// RSA or ECDSA), for verifiers other than PASETO.
+func (k *KeyRing) PublicKey(kid string) (crypto.PublicKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+	return key.public, nil
+}
+
+// Len returns the number of loaded keys.
+func (k *KeyRing) Len() int {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return len(k.keys)
+}
+
+// Reload parses every configured key source and atomically replaces the ring.
+// On error the previous keys stay in place.
+func (k *KeyRing) Reload() error {
+	keys := make(map[string]*publicKey)
+	modTimes := make(map[string]time.Time)
+
+	defaultHex := k.cfg.PublicKey
+	if defaultHex == "" {
+		defaultHex = k.cfg.JWTSecret
+	}
+	if defaultHex != "" {
+		key, err := parsePublicKey([]byte(defaultHex))
+		if err != nil {
+			return fmt.Errorf("invalid auth.public_key: %w", err)
+		}
+		keys[""] = key
+	}
+
+	for _, keyCfg := range k.cfg.Keys {
+		data := []byte(keyCfg.Hex)
+		if keyCfg.File != "" {
+			fileData, modTime, err := readKeyFile(keyCfg.File)
+			if err != nil {
+				return err
+			}
+			data = fileData
+			modTimes[keyCfg.File] = modTime
+		}
+		key, err := parsePublicKey(data)
+		if err != nil {
+			return fmt.Errorf("invalid key %q: %w", keyCfg.KID, err)
+		}
+		keys[keyCfg.KID] = key
+	}
+
+	if k.cfg.KeySetFile != "" {
+		data, modTime, err := readKeyFile(k.cfg.KeySetFile)
+		if err != nil {
+			return err
+		}
+		modTimes[k.cfg.KeySetFile] = modTime
+		if err := parseKeySet(data, keys); err != nil {
+			return fmt.Errorf("invalid key set %s: %w", k.cfg.KeySetFile, err)
+		}
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.modTimes = modTimes
+	k.mu.Unlock()
+	k.generation.Add(1)
+	return nil
+}
+
+// Generation changes every time the keys are reloaded.
+func (k *KeyRing) Generation() uint64 {
+	return k.generation.Load()
+}
+
+// Watch reloads the ring whenever a key file changes, until ctx is done.
+func (k *KeyRing) Watch(ctx context.Context, logger logger.ZeroLogger) {
+	interval := time.Duration(k.cfg.KeyRefreshSeconds) * time.Second
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !k.changed() {
+				continue
+			}
+			if err := k.Reload(); err != nil {
+				logger.Error(ctx, "Failed to reload signing keys, keeping previous keys", "error", err)
+				continue
+			}
+			logger.Info(ctx, "Reloaded signing keys", "count", k.Len())
+		}
+	}
+}
+
+func (k *KeyRing) changed() bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for path, modTime := range k.modTimes {
+		info, err := os.Stat(path)
+		if err != nil || !info.ModTime().Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+func readKeyFile(path string) ([]byte, time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to stat key file: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to read key file: %w", err)
+	}
+	return data, info.ModTime(), nil
+}
+
+// parsePublicKey accepts a hex-encoded Ed25519 key or a PEM PKIX public key.
+func parsePublicKey(data []byte) (*publicKey, error) {
+	trimmed := strings.TrimSpace(string(data))
+	if block, _ := pem.Decode([]byte(trimmed)); block != nil {
+		public, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return newPublicKey(public)
+	}
+
+	raw, err := hex.DecodeString(trimmed)
+	if err != nil {
+		return nil, fmt.Errorf("key is neither PEM nor hex: %w", err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("ed25519 public key must be %d bytes", ed25519.PublicKeySize)
+	}
+	return newPublicKey(ed25519.PublicKey(raw))
+}
+
+func newPublicKey(public crypto.PublicKey) (*publicKey, error) {
+	key := &publicKey{public: public}
+	if edKey, ok := public.(ed25519.PublicKey); ok {
+		pasetoKey, err := paseto.NewV4AsymmetricPublicKeyFromEd25519(edKey)
+		if err != nil {
+			return nil, err
+		}
+		key.paseto = &pasetoKey
+	}
+	return key, nil
+}
+
+func parseKeySet(data []byte, keys map[string]*publicKey) error {
+	var doc keySetDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	for _, entry := range doc.Keys {
+		if entry.Kid == "" {
+			return errors.New("every key needs a kid")
+		}
+
+		var key *publicKey
+		var err error
+		switch {
+		case entry.Hex != "":
+			key, err = parsePublicKey([]byte(entry.Hex))
+		case entry.Kty == "OKP" && entry.Crv == "Ed25519":
+			var raw []byte
+			raw, err = base64.RawURLEncoding.DecodeString(entry.X)
+			if err == nil && len(raw) != ed25519.PublicKeySize {
+				err = fmt.Errorf("ed25519 public key must be %d bytes", ed25519.PublicKeySize)
+			}
+			if err == nil {
+				key, err = newPublicKey(ed25519.PublicKey(raw))
+			}
+		case entry.Kty == "RSA":
+			var n, e []byte
+			if n, err = base64.RawURLEncoding.DecodeString(entry.N); err == nil {
+				e, err = base64.RawURLEncoding.DecodeString(entry.E)
+			}
+			if err == nil {
+				key, err = newPublicKey(&rsa.PublicKey{
+					N: new(big.Int).SetBytes(n),
+					E: int(new(big.Int).SetBytes(e).Int64()),
+				})
+			}
+		case entry.Kty == "EC" && entry.Crv == "P-256":
+			var x, y []byte
+			if x, err = base64.RawURLEncoding.DecodeString(entry.X); err == nil {
+				y, err = base64.RawURLEncoding.DecodeString(entry.Y)
+			}
+			if err == nil && (len(x) != 32 || len(y) != 32) {
+				err = errors.New("P-256 coordinates must be 32 bytes")
+			}
+			if err == nil {
+				// ecdh rejects points that are not on the curve
+				_, err = ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...))
+			}
+			if err == nil {
+				key, err = newPublicKey(&ecdsa.PublicKey{
+					Curve: elliptic.P256(),
+					X:     new(big.Int).SetBytes(x),
+					Y:     new(big.Int).SetBytes(y),
+				})
+			}
+		default:
+			err = fmt.Errorf("unsupported key type %s/%s", entry.Kty, entry.Crv)
+		}
+		if err != nil {
+			return fmt.Errorf("key %q: %w", entry.Kid, err)
+		}
+		keys[entry.Kid] = key
+	}
+	return nil
+}
+
+// tokenKID reads the kid from a PASETO footer without verifying it. Footers
+// that are not JSON carry no kid.
+func tokenKID(protocol paseto.Protocol, token string) string {
+	footer, err := paseto.NewParser().UnsafeParseFooter(protocol, token)
+	if err != nil || len(footer) == 0 {
+		return ""
+	}
+	var parsed struct {
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(footer, &parsed); err != nil {
+		return ""
+	}
+	return parsed.Kid
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"aidanwoods.dev/go-paseto"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+)
+
+func signTestToken(t testing.TB, key paseto.V4AsymmetricSecretKey, kid string) string {
+	t.Helper()
+	token := paseto.NewToken()
+	token.SetExpiration(time.Now().Add(time.Hour))
+	token.SetString("userId", "42")
+	if kid != "" {
+		token.SetFooter([]byte(fmt.Sprintf(`{"kid":%q}`, kid)))
+	}
+	return token.V4Sign(key, nil)
+}
+
+func writeKeySet(t *testing.T, path string, keys map[string]paseto.V4AsymmetricSecretKey) {
+	t.Helper()
+	doc := `{"keys":[`
+	first := true
+	for kid, key := range keys {
+		if !first {
+			doc += ","
+		}
+		first = false
+		x := base64.RawURLEncoding.EncodeToString(key.Public().ExportBytes())
+		doc += fmt.Sprintf(`{"kid":%q,"kty":"OKP","crv":"Ed25519","x":%q}`, kid, x)
+	}
+	doc += `]}`
+	if err := os.WriteFile(path, []byte(doc), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+}
+
+func TestKeyRing_Rotation(t *testing.T) {
+	defaultKey := paseto.NewV4AsymmetricSecretKey()
+	oldKey := paseto.NewV4AsymmetricSecretKey()
+	newKey := paseto.NewV4AsymmetricSecretKey()
+
+	keySetPath := filepath.Join(t.TempDir(), "keys.json")
+	writeKeySet(t, keySetPath, map[string]paseto.V4AsymmetricSecretKey{"2025-01": oldKey})
+
+	ring, err := NewKeyRing(config.AuthConfig{
+		JWTSecret:  defaultKey.Public().ExportHex(),
+		KeySetFile: keySetPath,
+	})
+	if err != nil {
+		t.Fatalf("NewKeyRing() error = %v", err)
+	}
+	verifier := &PasetoPublicVerifier{ring: ring}
+
+	if _, err := verifier.Verify(context.Background(), signTestToken(t, defaultKey, ""), Validator{}); err != nil {
+		t.Errorf("Verify() without kid error = %v", err)
+	}
+	if _, err := verifier.Verify(context.Background(), signTestToken(t, oldKey, "2025-01"), Validator{}); err != nil {
+		t.Errorf("Verify() with kid error = %v", err)
+	}
+	if _, err := verifier.Verify(context.Background(), signTestToken(t, newKey, "2025-02"), Validator{}); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Verify() error = %v, want ErrUnknownKey", err)
+	}
+	if _, err := verifier.Verify(context.Background(), signTestToken(t, newKey, "2025-01"), Validator{}); err == nil {
+		t.Error("Verify() accepted token signed with the wrong key")
+	}
+
+	// Rotate: publish the new key alongside the old one
+	writeKeySet(t, keySetPath, map[string]paseto.V4AsymmetricSecretKey{"2025-01": oldKey, "2025-02": newKey})
+	later := time.Now().Add(time.Second)
+	os.Chtimes(keySetPath, later, later)
+	if !ring.changed() {
+		t.Fatal("changed() = false after key set update")
+	}
+	if err := ring.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if _, err := verifier.Verify(context.Background(), signTestToken(t, newKey, "2025-02"), Validator{}); err != nil {
+		t.Errorf("Verify() after rotation error = %v", err)
+	}
+}
+
+func TestKeyRing_ReloadKeepsPreviousKeysOnError(t *testing.T) {
+	key := paseto.NewV4AsymmetricSecretKey()
+	keyPath := filepath.Join(t.TempDir(), "key.hex")
+	os.WriteFile(keyPath, []byte(key.Public().ExportHex()), 0o600)
+
+	ring, err := NewKeyRing(config.AuthConfig{Keys: []config.KeyConfig{{KID: "a", File: keyPath}}})
+	if err != nil {
+		t.Fatalf("NewKeyRing() error = %v", err)
+	}
+	verifier := &PasetoPublicVerifier{ring: ring}
+
+	os.WriteFile(keyPath, []byte("not a key"), 0o600)
+	if err := ring.Reload(); err == nil {
+		t.Fatal("Reload() expected error for invalid key file")
+	}
+	if _, err := verifier.Verify(context.Background(), signTestToken(t, key, "a"), Validator{}); err != nil {
+		t.Errorf("Verify() after failed reload error = %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mtsgn/mtsgn-mtsgn-system-common-svc/common/logger"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+	rds "github.com/mtsgn/mtsgn-system-gateway-svc/pkg/redis"
+)
+
+var ErrTokenRevoked = errors.New("token or session has been revoked")
+
+// RevocationChecker rejects tokens whose sessionId or jti has been revoked.
+// Ids found not revoked are cached locally for up to the configured
+// staleness, and revoked ids until their revocation expires. Revocations
+// published by any instance update the cache immediately. The cache holds at
+// most CacheSize ids.
+type RevocationChecker struct {
+	store      rds.RevocationStore
+	staleness  time.Duration
+	maxEntries int
+	failClosed bool
+	defaultTTL time.Duration
+
+	mu    sync.Mutex
+	cache map[string]revocationEntry
+}
+
+type revocationEntry struct {
+	revoked   bool
+	expiresAt time.Time // zero never expires
+}
+
+func (e revocationEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+func NewRevocationChecker(store rds.RevocationStore, cfg config.RevocationConfig) *RevocationChecker {
+	staleness := time.Duration(cfg.CacheStalenessSeconds) * time.Second
+	if staleness <= 0 {
+		staleness = 5 * time.Second
+	}
+	maxEntries := cfg.CacheSize
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+	defaultTTL := time.Duration(cfg.DefaultTTLSeconds) * time.Second
+	if defaultTTL <= 0 {
+		defaultTTL = 24 * time.Hour
+	}
+
+	return &RevocationChecker{
+		store:      store,
+		staleness:  staleness,
+		maxEntries: maxEntries,
+		failClosed: cfg.FailClosed,
+		defaultTTL: defaultTTL,
+		cache:      make(map[string]revocationEntry),
+	}
+}
+
+// Check returns ErrTokenRevoked when the token's session or token id is
+// revoked. Store errors are only returned when the checker fails closed.
+func (c *RevocationChecker) Check(ctx context.Context, claims Claims) error {
+	ids := []struct{ kind, id string }{
+		{rds.RevocationSession, claims.String("sessionId")},
+		{rds.RevocationToken, claims.String("jti")},
+	}
+
+	for _, entry := range ids {
+		if entry.id == "" {
+			continue
+		}
+		revoked, err := c.isRevoked(ctx, entry.kind, entry.id)
+		if err != nil {
+			if c.failClosed {
+				return err
+			}
+			continue
+		}
+		if revoked {
+			return fmt.Errorf("%w: %s", ErrTokenRevoked, entry.kind)
+		}
+	}
+	return nil
+}
+
+func (c *RevocationChecker) isRevoked(ctx context.Context, kind, id string) (bool, error) {
+	key := kind + ":" + id
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, found := c.cache[key]
+	c.mu.Unlock()
+	if found && !entry.expired(now) {
+		return entry.revoked, nil
+	}
+
+	expiresAt, revoked, err := c.store.RevokedUntil(ctx, kind, id)
+	if err != nil {
+		return false, err
+	}
+	if !revoked {
+		expiresAt = now.Add(c.staleness)
+	}
+	c.remember(key, revocationEntry{revoked: revoked, expiresAt: expiresAt}, now)
+	return revoked, nil
+}
+
+// remember caches entry under key. A full cache first drops expired entries,
+// then everything, since every entry can be looked up again.
+func (c *RevocationChecker) remember(key string, entry revocationEntry, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.cache[key]; !exists && len(c.cache) >= c.maxEntries {
+		for cached, cachedEntry := range c.cache {
+			if cachedEntry.expired(now) {
+				delete(c.cache, cached)
+			}
+		}
+		if len(c.cache) >= c.maxEntries {
+			c.cache = make(map[string]revocationEntry)
+		}
+	}
+	c.cache[key] = entry
+}
+
+// Revoke records a revocation for ttl, or the default ttl when ttl is zero.
+func (c *RevocationChecker) Revoke(ctx context.Context, kind, id string, ttl time.Duration) error {
+	if kind != rds.RevocationSession && kind != rds.RevocationToken {
+		return fmt.Errorf("unknown revocation kind %q", kind)
+	}
+	if ttl <= 0 {
+		ttl = c.defaultTTL
+	}
+	if err := c.store.Revoke(ctx, kind, id, ttl); err != nil {
+		return err
+	}
+	now := time.Now()
+	c.remember(kind+":"+id, revocationEntry{revoked: true, expiresAt: now.Add(ttl)}, now)
+	return nil
+}
+
+// Listen applies revocations published by other instances to the local
+// cache, resubscribing after connection errors until ctx is done.
+func (c *RevocationChecker) Listen(ctx context.Context, logger logger.ZeroLogger) {
+	for {
+		err := c.store.Subscribe(ctx, func(kind, id string, expiresAt time.Time) {
+			c.remember(kind+":"+id, revocationEntry{revoked: true, expiresAt: expiresAt}, time.Now())
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.Error(ctx, "Revocation subscription failed, retrying", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
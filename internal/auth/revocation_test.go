@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/mtsgn/mtsgn-mtsgn-system-common-svc/common/logger"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+	rds "github.com/mtsgn/mtsgn-system-gateway-svc/pkg/redis"
+)
+
+func TestRevocationChecker_PropagatesAcrossInstances(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Failed to start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	newInstance := func() *RevocationChecker {
+		client, err := rds.InitRedis(config.RedisConfig{Host: mr.Host(), Port: mr.Server().Addr().Port})
+		if err != nil {
+			t.Fatalf("InitRedis() error = %v", err)
+		}
+		t.Cleanup(func() { client.Close() })
+		// A long staleness proves eviction comes from pub/sub, not expiry
+		return NewRevocationChecker(rds.NewRedisRevocationStore(client), config.RevocationConfig{CacheStalenessSeconds: 3600})
+	}
+	first := newInstance()
+	second := newInstance()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go second.Listen(ctx, logger.ZeroLogger{})
+
+	claims := Claims{"sessionId": "s-1", "jti": "t-1"}
+	if err := second.Check(ctx, claims); err != nil {
+		t.Fatalf("Check() error = %v before revocation", err)
+	}
+
+	time.Sleep(50 * time.Millisecond) // let the subscription settle
+	if err := first.Revoke(ctx, rds.RevocationSession, "s-1", time.Minute); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		err := second.Check(ctx, claims)
+		if errors.Is(err, ErrTokenRevoked) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Check() error = %v, want ErrTokenRevoked after publish", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := first.Check(ctx, Claims{"jti": "t-2"}); err != nil {
+		t.Errorf("Check() error = %v for unrelated token", err)
+	}
+}
+
+type failingRevocationStore struct{}
+
+func (failingRevocationStore) Revoke(ctx context.Context, kind, id string, ttl time.Duration) error {
+	return errors.New("store unavailable")
+}
+
+func (failingRevocationStore) RevokedUntil(ctx context.Context, kind, id string) (time.Time, bool, error) {
+	return time.Time{}, false, errors.New("store unavailable")
+}
+
+func (failingRevocationStore) Subscribe(ctx context.Context, fn func(kind, id string, expiresAt time.Time)) error {
+	<-ctx.Done()
+	return nil
+}
+
+func TestRevocationChecker_FailMode(t *testing.T) {
+	claims := Claims{"sessionId": "s-1"}
+
+	open := NewRevocationChecker(failingRevocationStore{}, config.RevocationConfig{})
+	if err := open.Check(context.Background(), claims); err != nil {
+		t.Errorf("Check() error = %v, want fail open", err)
+	}
+
+	closed := NewRevocationChecker(failingRevocationStore{}, config.RevocationConfig{FailClosed: true})
+	if err := closed.Check(context.Background(), claims); err == nil {
+		t.Error("Check() error = nil, want fail closed")
+	}
+}
+
+func TestRevocationChecker_PositivesExpire(t *testing.T) {
+	store := rds.NewLocalRevocationStore()
+	checker := NewRevocationChecker(store, config.RevocationConfig{CacheStalenessSeconds: 3600, CacheSize: 2})
+	ctx := context.Background()
+
+	if err := checker.Revoke(ctx, rds.RevocationToken, "t-1", 50*time.Millisecond); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	claims := Claims{"jti": "t-1"}
+	if err := checker.Check(ctx, claims); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("Check() error = %v, want ErrTokenRevoked", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if err := checker.Check(ctx, claims); err != nil {
+		t.Errorf("Check() error = %v after the revocation expired", err)
+	}
+
+	for _, id := range []string{"t-2", "t-3", "t-4"} {
+		checker.Check(ctx, Claims{"jti": id})
+	}
+	if n := len(checker.cache); n > 2 {
+		t.Errorf("cache holds %d entries, want at most 2", n)
+	}
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+)
+
+const defaultTokenCacheSize = 10000
+
+// TokenCache is a bounded LRU of verified token hashes to their claims.
+// Entries are dropped once the token's exp passes.
+type TokenCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[[sha256.Size]byte]*list.Element
+	order      *list.List // front is most recently used
+	now        func() time.Time
+}
+
+type tokenCacheEntry struct {
+	key       [sha256.Size]byte
+	claims    Claims
+	expiresAt time.Time
+}
+
+func NewTokenCache(maxEntries int) *TokenCache {
+	if maxEntries <= 0 {
+		maxEntries = defaultTokenCacheSize
+	}
+	return &TokenCache{
+		maxEntries: maxEntries,
+		entries:    make(map[[sha256.Size]byte]*list.Element),
+		order:      list.New(),
+		now:        time.Now,
+	}
+}
+
+func (c *TokenCache) get(key [sha256.Size]byte) (Claims, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*tokenCacheEntry)
+	if !c.now().Before(entry.expiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return entry.claims, true
+}
+
+func (c *TokenCache) put(key [sha256.Size]byte, claims Claims) {
+	exp, ok, err := claims.Time("exp")
+	if err != nil || !ok || !c.now().Before(exp) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value = &tokenCacheEntry{key: key, claims: claims, expiresAt: exp}
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&tokenCacheEntry{key: key, claims: claims, expiresAt: exp})
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*tokenCacheEntry).key)
+	}
+}
+
+// Len returns the number of cached tokens.
+func (c *TokenCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// cachingVerifier skips signature checks for tokens it has verified before.
+// The validator still runs on every hit because it differs per service and
+// depends on the current time; revocation is checked by the caller. Keys
+// include the key ring generation, so a reload that rotates or removes a key
+// makes every earlier result unreachable.
+type cachingVerifier struct {
+	tokenType string
+	inner     Verifier
+	cache     *TokenCache
+	ring      *KeyRing
+	observe   func(hit bool)
+}
+
+func (v *cachingVerifier) Verify(ctx context.Context, token string, validator Validator) (Claims, error) {
+	var generation uint64
+	if v.ring != nil {
+		generation = v.ring.Generation()
+	}
+	key := sha256.Sum256([]byte(v.tokenType + ":" + strconv.FormatUint(generation, 10) + ":" + token))
+	claims, ok := v.cache.get(key)
+	if v.observe != nil {
+		v.observe(ok)
+	}
+	if ok {
+		if err := validator.Validate(claims); err != nil {
+			return nil, err
+		}
+		return claims, nil
+	}
+
+	claims, err := v.inner.Verify(ctx, token, validator)
+	if err != nil {
+		return nil, err
+	}
+	v.cache.put(key, claims)
+	return claims, nil
+}
+
+// WithTokenCache wraps the signature based verifiers with a shared cache that
+// is invalidated whenever ring reloads. observe, if set, is called with the
+// outcome of every lookup. Introspection keeps its own cache since a token
+// can turn inactive before it expires.
+func (v Verifiers) WithTokenCache(cfg config.TokenCacheConfig, ring *KeyRing, observe func(hit bool)) Verifiers {
+	if !cfg.Enabled {
+		return v
+	}
+	cache := NewTokenCache(cfg.MaxEntries)
+	wrapped := make(Verifiers, len(v))
+	for tokenType, verifier := range v {
+		if tokenType == config.TokenTypeIntrospect {
+			wrapped[tokenType] = verifier
+			continue
+		}
+		wrapped[tokenType] = &cachingVerifier{tokenType: tokenType, inner: verifier, cache: cache, ring: ring, observe: observe}
+	}
+	return wrapped
+}
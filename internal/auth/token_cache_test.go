@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"aidanwoods.dev/go-paseto"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+)
+
+type countingVerifier struct {
+	inner Verifier
+	calls int
+}
+
+func (v *countingVerifier) Verify(ctx context.Context, token string, validator Validator) (Claims, error) {
+	v.calls++
+	return v.inner.Verify(ctx, token, validator)
+}
+
+func testPasetoVerifiers(key paseto.V4AsymmetricSecretKey) Verifiers {
+	ring := testRing(map[string]interface{}{"": ed25519.PublicKey(key.Public().ExportBytes())})
+	return Verifiers{config.TokenTypePasetoPublic: &PasetoPublicVerifier{ring: ring}}
+}
+
+func TestTokenCache(t *testing.T) {
+	key := paseto.NewV4AsymmetricSecretKey()
+	counting := &countingVerifier{inner: testPasetoVerifiers(key)[config.TokenTypePasetoPublic]}
+	verifiers := Verifiers{config.TokenTypePasetoPublic: counting}.WithTokenCache(config.TokenCacheConfig{Enabled: true, MaxEntries: 2}, nil, nil)
+	verifier, _ := verifiers.For("")
+	ctx := context.Background()
+
+	token := signTestToken(t, key, "")
+	for i := 0; i < 3; i++ {
+		claims, err := verifier.Verify(ctx, token, Validator{})
+		if err != nil || claims.String("userId") != "42" {
+			t.Fatalf("Verify() = %v, %v", claims, err)
+		}
+	}
+	if counting.calls != 1 {
+		t.Errorf("signature checks = %d, want 1", counting.calls)
+	}
+
+	// Cached claims still go through the service's validator.
+	if _, err := verifier.Verify(ctx, token, Validator{Issuers: []string{"other"}}); !errors.Is(err, ErrInvalidIssuer) {
+		t.Errorf("Verify() error = %v, want ErrInvalidIssuer on a cache hit", err)
+	}
+
+	// Failed verifications are not cached.
+	for i := 0; i < 2; i++ {
+		verifier.Verify(ctx, "v4.public.garbage", Validator{})
+	}
+	if counting.calls != 3 {
+		t.Errorf("signature checks = %d, want invalid tokens rechecked", counting.calls)
+	}
+
+	cache := verifier.(*cachingVerifier).cache
+	for i := 0; i < 3; i++ {
+		other := paseto.NewToken()
+		other.SetExpiration(time.Now().Add(time.Hour))
+		other.Set("n", i)
+		verifier.Verify(ctx, other.V4Sign(key, nil), Validator{})
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Len() = %d, want the cache bounded to 2", cache.Len())
+	}
+
+	// Entries expire with the token.
+	cache.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	before := counting.calls
+	verifier.Verify(ctx, token, Validator{})
+	if counting.calls != before+1 {
+		t.Error("expired token was served from the cache")
+	}
+}
+
+func TestTokenCache_KeyRotation(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "a.hex")
+	oldKey := paseto.NewV4AsymmetricSecretKey()
+	os.WriteFile(keyPath, []byte(oldKey.Public().ExportHex()), 0o600)
+	cfg := config.AuthConfig{Keys: []config.KeyConfig{{KID: "a", File: keyPath}}}
+	ring, err := NewKeyRing(cfg)
+	if err != nil {
+		t.Fatalf("NewKeyRing() error = %v", err)
+	}
+	verifiers, err := NewVerifiers(cfg, ring)
+	if err != nil {
+		t.Fatalf("NewVerifiers() error = %v", err)
+	}
+	var hits int
+	verifier, _ := verifiers.WithTokenCache(config.TokenCacheConfig{Enabled: true}, ring, func(hit bool) {
+		if hit {
+			hits++
+		}
+	}).For("")
+	ctx := context.Background()
+
+	token := signTestToken(t, oldKey, "a")
+	for i := 0; i < 2; i++ {
+		if _, err := verifier.Verify(ctx, token, Validator{}); err != nil {
+			t.Fatalf("Verify() error = %v", err)
+		}
+	}
+	if hits != 1 {
+		t.Fatalf("cache hits = %d, want 1", hits)
+	}
+
+	// Rotate kid "a" to a new key; tokens signed with the old one must fail.
+	os.WriteFile(keyPath, []byte(paseto.NewV4AsymmetricSecretKey().Public().ExportHex()), 0o600)
+	if err := ring.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if _, err := verifier.Verify(ctx, token, Validator{}); err == nil {
+		t.Error("Verify() accepted a cached token signed with a rotated key")
+	}
+}
+
+func BenchmarkPasetoPublicVerify(b *testing.B) {
+	key := paseto.NewV4AsymmetricSecretKey()
+	token := signTestToken(b, key, "")
+	ctx := context.Background()
+
+	b.Run("uncached", func(b *testing.B) {
+		verifier, _ := testPasetoVerifiers(key).For("")
+		for i := 0; i < b.N; i++ {
+			if _, err := verifier.Verify(ctx, token, Validator{}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		verifier, _ := testPasetoVerifiers(key).WithTokenCache(config.TokenCacheConfig{Enabled: true}, nil, nil).For("")
+		for i := 0; i < b.N; i++ {
+			if _, err := verifier.Verify(ctx, token, Validator{}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,310 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+)
+
+var (
+	ErrMissingToken      = errors.New("authorization header is required")
+	ErrTokenExpired      = errors.New("token has expired")
+	ErrTokenNotYetValid  = errors.New("token is not valid yet")
+	ErrTokenTooOld       = errors.New("token exceeds the maximum age")
+	ErrTokenIssuedFuture = errors.New("token is issued in the future")
+	ErrInvalidIssuer     = errors.New("token issuer is not accepted")
+	ErrInvalidAudience   = errors.New("token audience is not accepted")
+	ErrMissingClaim      = errors.New("token is missing a required claim")
+	ErrInvalidClaim      = errors.New("token claim has an invalid value")
+	ErrUnsupportedType   = errors.New("token type is not configured")
+)
+
+// Failure reasons recorded in the authentication_failures_total metric.
+const (
+	ReasonMissingToken    = "missing_token"
+	ReasonInvalidToken    = "invalid_token"
+	ReasonUnknownKey      = "unknown_key"
+	ReasonExpired         = "expired"
+	ReasonNotYetValid     = "not_yet_valid"
+	ReasonTooOld          = "too_old"
+	ReasonIssuedInFuture  = "issued_in_future"
+	ReasonInvalidIssuer   = "invalid_issuer"
+	ReasonInvalidAudience = "invalid_audience"
+	ReasonMissingClaim    = "missing_claim"
+	ReasonInvalidClaim    = "invalid_claim"
+	ReasonUnsupportedType = "unsupported_token_type"
+	ReasonRevoked         = "revoked"
+	ReasonMissingAPIKey   = "missing_api_key"
+	ReasonInvalidAPIKey   = "invalid_api_key"
+	ReasonAPIKeyExpired   = "api_key_expired"
+	ReasonInactive        = "inactive"
+	ReasonIntrospection   = "introspection_failed"
+	ReasonAPIKeyStore     = "api_key_store_unavailable"
+)
+
+// FailureReason maps a verification error to a stable reason code.
+func FailureReason(err error) string {
+	switch {
+	case errors.Is(err, ErrMissingToken):
+		return ReasonMissingToken
+	case errors.Is(err, ErrUnknownKey):
+		return ReasonUnknownKey
+	case errors.Is(err, ErrTokenExpired):
+		return ReasonExpired
+	case errors.Is(err, ErrTokenNotYetValid):
+		return ReasonNotYetValid
+	case errors.Is(err, ErrTokenTooOld):
+		return ReasonTooOld
+	case errors.Is(err, ErrTokenIssuedFuture):
+		return ReasonIssuedInFuture
+	case errors.Is(err, ErrInvalidIssuer):
+		return ReasonInvalidIssuer
+	case errors.Is(err, ErrInvalidAudience):
+		return ReasonInvalidAudience
+	case errors.Is(err, ErrMissingClaim):
+		return ReasonMissingClaim
+	case errors.Is(err, ErrInvalidClaim):
+		return ReasonInvalidClaim
+	case errors.Is(err, ErrUnsupportedType):
+		return ReasonUnsupportedType
+	case errors.Is(err, ErrTokenRevoked):
+		return ReasonRevoked
+	case errors.Is(err, ErrMissingAPIKey):
+		return ReasonMissingAPIKey
+	case errors.Is(err, ErrInvalidAPIKey):
+		return ReasonInvalidAPIKey
+	case errors.Is(err, ErrAPIKeyExpired):
+		return ReasonAPIKeyExpired
+	case errors.Is(err, ErrTokenInactive):
+		return ReasonInactive
+	case errors.Is(err, ErrIntrospectionFailed):
+		return ReasonIntrospection
+	case errors.Is(err, ErrAPIKeyStoreUnavailable):
+		return ReasonAPIKeyStore
+	default:
+		return ReasonInvalidToken
+	}
+}
+
+// Claims are the verified claims of a token.
+type Claims map[string]interface{}
+
+// String returns the claim as a string, or "" when it is absent or not a string.
+func (c Claims) String(name string) string {
+	value, _ := c[name].(string)
+	return value
+}
+
+// Time reads a time claim encoded either as an RFC 3339 string (PASETO) or as
+// seconds since the epoch (JWT).
+func (c Claims) Time(name string) (time.Time, bool, error) {
+	value, exists := c[name]
+	if !exists || value == nil {
+		return time.Time{}, false, nil
+	}
+
+	switch v := value.(type) {
+	case string:
+		if parsed, err := time.Parse(time.RFC3339, v); err == nil {
+			return parsed, true, nil
+		}
+		seconds, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return time.Time{}, true, fmt.Errorf("%w: %s", ErrInvalidClaim, name)
+		}
+		return unixSeconds(seconds), true, nil
+	case float64:
+		return unixSeconds(v), true, nil
+	case int64:
+		return time.Unix(v, 0), true, nil
+	default:
+		return time.Time{}, true, fmt.Errorf("%w: %s", ErrInvalidClaim, name)
+	}
+}
+
+// Audiences returns the aud claim, which may be a single string or a list.
+func (c Claims) Audiences() []string {
+	switch v := c["aud"].(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		audiences := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+		return audiences
+	default:
+		return nil
+	}
+}
+
+func unixSeconds(seconds float64) time.Time {
+	whole, frac := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(frac*1e9))
+}
+
+// Verifier checks a token's signature (or decrypts it) and returns its
+// claims once they pass the validator.
+type Verifier interface {
+	Verify(ctx context.Context, token string, validator Validator) (Claims, error)
+}
+
+// Validator applies the same claim rules to every token type, so exp, nbf,
+// iat, iss and aud behave identically for PASETO and JWT.
+type Validator struct {
+	Issuers        []string
+	Audiences      []string
+	MaxAge         time.Duration
+	ClockSkew      time.Duration
+	RequiredClaims []string
+	Now            func() time.Time
+	// expOptional accepts claims without exp, as RFC 7662 allows for
+	// introspection responses. A present exp is still enforced.
+	expOptional bool
+}
+
+// NewValidator builds the validator for a service, starting from the global
+// rules and replacing every field the service sets.
+func NewValidator(global config.TokenValidationConfig, service *config.TokenValidationConfig) Validator {
+	rules := global
+	if service != nil {
+		if len(service.Issuers) > 0 {
+			rules.Issuers = service.Issuers
+		}
+		if len(service.Audiences) > 0 {
+			rules.Audiences = service.Audiences
+		}
+		if service.MaxAgeSeconds > 0 {
+			rules.MaxAgeSeconds = service.MaxAgeSeconds
+		}
+		if service.ClockSkewSeconds > 0 {
+			rules.ClockSkewSeconds = service.ClockSkewSeconds
+		}
+		if len(service.RequiredClaims) > 0 {
+			rules.RequiredClaims = service.RequiredClaims
+		}
+	}
+
+	return Validator{
+		Issuers:        rules.Issuers,
+		Audiences:      rules.Audiences,
+		MaxAge:         time.Duration(rules.MaxAgeSeconds) * time.Second,
+		ClockSkew:      time.Duration(rules.ClockSkewSeconds) * time.Second,
+		RequiredClaims: rules.RequiredClaims,
+	}
+}
+
+func (v Validator) Validate(claims Claims) error {
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+
+	exp, exists, err := claims.Time("exp")
+	if err != nil {
+		return err
+	}
+	if !exists && !v.expOptional {
+		return fmt.Errorf("%w: exp", ErrMissingClaim)
+	}
+	if exists && now.After(exp.Add(v.ClockSkew)) {
+		return ErrTokenExpired
+	}
+
+	nbf, exists, err := claims.Time("nbf")
+	if err != nil {
+		return err
+	}
+	if exists && now.Add(v.ClockSkew).Before(nbf) {
+		return ErrTokenNotYetValid
+	}
+
+	iat, exists, err := claims.Time("iat")
+	if err != nil {
+		return err
+	}
+	if exists && now.Add(v.ClockSkew).Before(iat) {
+		return ErrTokenIssuedFuture
+	}
+	if v.MaxAge > 0 {
+		if !exists {
+			return fmt.Errorf("%w: iat", ErrMissingClaim)
+		}
+		if now.Sub(iat) > v.MaxAge+v.ClockSkew {
+			return ErrTokenTooOld
+		}
+	}
+
+	if len(v.Issuers) > 0 && !containsAny(v.Issuers, []string{claims.String("iss")}) {
+		return ErrInvalidIssuer
+	}
+	if len(v.Audiences) > 0 && !containsAny(v.Audiences, claims.Audiences()) {
+		return ErrInvalidAudience
+	}
+
+	for _, name := range v.RequiredClaims {
+		if value, exists := claims[name]; !exists || value == nil {
+			return fmt.Errorf("%w: %s", ErrMissingClaim, name)
+		}
+	}
+	return nil
+}
+
+func containsAny(accepted []string, values []string) bool {
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		for _, candidate := range accepted {
+			if value == candidate {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Verifiers maps a token type to the verifier for it.
+type Verifiers map[string]Verifier
+
+// NewVerifiers builds a verifier for every token type the configuration has
+// key material or an introspection endpoint for. PASETO v4.public is always available.
+func NewVerifiers(cfg config.AuthConfig, ring *KeyRing) (Verifiers, error) {
+	verifiers := Verifiers{
+		config.TokenTypePasetoPublic: &PasetoPublicVerifier{ring: ring},
+		config.TokenTypeJWT:          NewJWTVerifier(ring, []byte(cfg.HMACSecret), cfg.JWTAlgorithms),
+	}
+
+	if cfg.LocalKey != "" {
+		local, err := NewPasetoLocalVerifier(cfg.LocalKey)
+		if err != nil {
+			return nil, err
+		}
+		verifiers[config.TokenTypePasetoLocal] = local
+	}
+	if cfg.Introspection.Endpoint != "" {
+		verifiers[config.TokenTypeIntrospect] = NewIntrospectionVerifier(cfg.Introspection)
+	}
+	return verifiers, nil
+}
+
+// For returns the verifier for tokenType, defaulting to PASETO v4.public.
+func (v Verifiers) For(tokenType string) (Verifier, error) {
+	if tokenType == "" {
+		tokenType = config.TokenTypePasetoPublic
+	}
+	verifier, ok := v[tokenType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, tokenType)
+	}
+	return verifier, nil
+}
@@ -0,0 +1,244 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"aidanwoods.dev/go-paseto"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+)
+
+func testRing(keys map[string]interface{}) *KeyRing {
+	ring := &KeyRing{keys: make(map[string]*publicKey)}
+	for kid, key := range keys {
+		public, err := newPublicKey(key)
+		if err != nil {
+			panic(err)
+		}
+		ring.keys[kid] = public
+	}
+	return ring
+}
+
+func TestJWTVerifier(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPublic, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	secret := []byte("0123456789abcdef0123456789abcdef")
+
+	ring := testRing(map[string]interface{}{
+		"rsa": &rsaKey.PublicKey,
+		"ec":  &ecKey.PublicKey,
+		"ed":  edPublic,
+	})
+	verifier := NewJWTVerifier(ring, secret, nil)
+	validator := Validator{Issuers: []string{"auth"}, Audiences: []string{"gateway"}}
+
+	sign := func(method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("SignedString() error = %v", err)
+		}
+		return signed
+	}
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"userId": "42",
+			"iss":    "auth",
+			"aud":    []string{"other", "gateway"},
+			"exp":    time.Now().Add(time.Hour).Unix(),
+		}
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{name: "RS256", token: sign(jwt.SigningMethodRS256, "rsa", rsaKey, valid())},
+		{name: "ES256", token: sign(jwt.SigningMethodES256, "ec", ecKey, valid())},
+		{name: "EdDSA", token: sign(jwt.SigningMethodEdDSA, "ed", edPrivate, valid())},
+		{name: "HS256", token: sign(jwt.SigningMethodHS256, "", secret, valid())},
+		{
+			name: "expired",
+			token: sign(jwt.SigningMethodHS256, "", secret, jwt.MapClaims{
+				"iss": "auth", "aud": "gateway", "exp": time.Now().Add(-time.Minute).Unix(),
+			}),
+			wantErr: ErrTokenExpired,
+		},
+		{
+			name: "not yet valid",
+			token: sign(jwt.SigningMethodHS256, "", secret, jwt.MapClaims{
+				"iss": "auth", "aud": "gateway", "exp": time.Now().Add(time.Hour).Unix(), "nbf": time.Now().Add(time.Minute).Unix(),
+			}),
+			wantErr: ErrTokenNotYetValid,
+		},
+		{
+			name: "wrong issuer",
+			token: sign(jwt.SigningMethodHS256, "", secret, jwt.MapClaims{
+				"iss": "someone", "aud": "gateway", "exp": time.Now().Add(time.Hour).Unix(),
+			}),
+			wantErr: ErrInvalidIssuer,
+		},
+		{
+			name: "wrong audience",
+			token: sign(jwt.SigningMethodHS256, "", secret, jwt.MapClaims{
+				"iss": "auth", "aud": "billing", "exp": time.Now().Add(time.Hour).Unix(),
+			}),
+			wantErr: ErrInvalidAudience,
+		},
+		{
+			name:    "missing exp",
+			token:   sign(jwt.SigningMethodHS256, "", secret, jwt.MapClaims{"iss": "auth", "aud": "gateway"}),
+			wantErr: ErrMissingClaim,
+		},
+		{
+			name:    "unknown kid",
+			token:   sign(jwt.SigningMethodRS256, "nope", rsaKey, valid()),
+			wantErr: ErrUnknownKey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifier.Verify(context.Background(), tt.token, validator)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if claims.String("userId") != "42" {
+				t.Errorf("Verify() userId = %q, want 42", claims.String("userId"))
+			}
+		})
+	}
+}
+
+func TestJWTVerifier_RejectsAlgorithmConfusion(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ring := testRing(map[string]interface{}{"rsa": &rsaKey.PublicKey})
+	// No HMAC secret configured: HS256 must be refused outright
+	verifier := NewJWTVerifier(ring, nil, nil)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()})
+	token.Header["kid"] = "rsa"
+	signed, _ := token.SignedString([]byte("guessed"))
+	if _, err := verifier.Verify(context.Background(), signed, Validator{}); err == nil {
+		t.Error("Verify() accepted HS256 token without a configured secret")
+	}
+}
+
+func TestPasetoLocalVerifier(t *testing.T) {
+	key := paseto.NewV4SymmetricKey()
+	verifiers, err := NewVerifiers(config.AuthConfig{LocalKey: key.ExportHex()}, testRing(nil))
+	if err != nil {
+		t.Fatalf("NewVerifiers() error = %v", err)
+	}
+	verifier, err := verifiers.For(config.TokenTypePasetoLocal)
+	if err != nil {
+		t.Fatalf("For() error = %v", err)
+	}
+
+	token := paseto.NewToken()
+	token.SetExpiration(time.Now().Add(time.Hour))
+	token.SetString("userId", "7")
+	claims, err := verifier.Verify(context.Background(), token.V4Encrypt(key, nil), Validator{})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if claims.String("userId") != "7" {
+		t.Errorf("Verify() userId = %q, want 7", claims.String("userId"))
+	}
+
+	expired := paseto.NewToken()
+	expired.SetExpiration(time.Now().Add(-time.Minute))
+	if _, err := verifier.Verify(context.Background(), expired.V4Encrypt(key, nil), Validator{}); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Verify() error = %v, want ErrTokenExpired", err)
+	}
+}
+
+func TestVerifiers_For(t *testing.T) {
+	verifiers, err := NewVerifiers(config.AuthConfig{}, testRing(nil))
+	if err != nil {
+		t.Fatalf("NewVerifiers() error = %v", err)
+	}
+	if _, err := verifiers.For(""); err != nil {
+		t.Errorf("For(\"\") error = %v, want default verifier", err)
+	}
+	if _, err := verifiers.For(config.TokenTypePasetoLocal); err == nil {
+		t.Error("For(paseto_v4_local) expected error without a local key")
+	}
+}
+
+func TestValidator_Rules(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	base := func() Claims {
+		return Claims{
+			"iss":       "auth",
+			"aud":       []interface{}{"gateway"},
+			"iat":       now.Add(-10 * time.Minute).Format(time.RFC3339),
+			"exp":       float64(now.Add(time.Hour).Unix()),
+			"sessionId": "s1",
+		}
+	}
+	validator := NewValidator(
+		config.TokenValidationConfig{Issuers: []string{"auth"}, ClockSkewSeconds: 30},
+		&config.TokenValidationConfig{
+			Audiences:      []string{"gateway", "admin"},
+			MaxAgeSeconds:  900,
+			RequiredClaims: []string{"sessionId"},
+		},
+	)
+	validator.Now = func() time.Time { return now }
+
+	tests := []struct {
+		name   string
+		mutate func(Claims)
+		reason string
+	}{
+		{name: "valid", mutate: func(c Claims) {}},
+		{name: "expired within skew", mutate: func(c Claims) { c["exp"] = float64(now.Add(-20 * time.Second).Unix()) }},
+		{name: "expired beyond skew", mutate: func(c Claims) { c["exp"] = float64(now.Add(-time.Minute).Unix()) }, reason: ReasonExpired},
+		{name: "nbf in future", mutate: func(c Claims) { c["nbf"] = now.Add(time.Minute).Format(time.RFC3339) }, reason: ReasonNotYetValid},
+		{name: "iat in future", mutate: func(c Claims) { c["iat"] = now.Add(time.Minute).Format(time.RFC3339) }, reason: ReasonIssuedInFuture},
+		{name: "too old", mutate: func(c Claims) { c["iat"] = now.Add(-time.Hour).Format(time.RFC3339) }, reason: ReasonTooOld},
+		{name: "max age needs iat", mutate: func(c Claims) { delete(c, "iat") }, reason: ReasonMissingClaim},
+		{name: "wrong issuer", mutate: func(c Claims) { c["iss"] = "other" }, reason: ReasonInvalidIssuer},
+		{name: "wrong audience", mutate: func(c Claims) { c["aud"] = "billing" }, reason: ReasonInvalidAudience},
+		{name: "missing required claim", mutate: func(c Claims) { delete(c, "sessionId") }, reason: ReasonMissingClaim},
+		{name: "malformed exp", mutate: func(c Claims) { c["exp"] = true }, reason: ReasonInvalidClaim},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := base()
+			tt.mutate(claims)
+			err := validator.Validate(claims)
+			if tt.reason == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if got := FailureReason(err); got != tt.reason {
+				t.Errorf("FailureReason(%v) = %q, want %q", err, got, tt.reason)
+			}
+		})
+	}
+}
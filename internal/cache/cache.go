@@ -0,0 +1,285 @@
+// Package cache implements the HTTP caching rules of the gateway's response
+// cache: which responses are stored, for how long, and under which key.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+	rds "github.com/mtsgn/mtsgn-system-gateway-svc/pkg/redis"
+)
+
+const defaultMaxBodyBytes = 1 << 20
+
+// Entries with validators are kept this long past their stale windows so
+// they can be revalidated with a conditional request.
+const revalidationWindow = time.Minute
+
+// ConsumerHeader identifies the API key consumer of a request. The gateway
+// sets it after authentication and strips it from client requests.
+const ConsumerHeader = "X-Consumer-ID"
+
+// Statuses stored by the cache.
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusGone:                 true,
+}
+
+// Policy is the cache configuration of one service.
+type Policy struct {
+	ttl          time.Duration
+	swr          time.Duration
+	sie          time.Duration
+	keyHeaders   []string
+	perUser      bool
+	maxBodyBytes int
+}
+
+// NewPolicy returns nil when caching is disabled for the service.
+func NewPolicy(cfg config.ServiceCacheConfig, global config.CacheConfig) *Policy {
+	if !cfg.Enabled {
+		return nil
+	}
+	p := &Policy{
+		ttl:          time.Duration(cfg.TTLSeconds) * time.Second,
+		swr:          time.Duration(cfg.StaleWhileRevalidateSeconds) * time.Second,
+		sie:          time.Duration(cfg.StaleIfErrorSeconds) * time.Second,
+		perUser:      cfg.PerUser,
+		maxBodyBytes: global.MaxBodyBytes,
+	}
+	for _, header := range cfg.KeyHeaders {
+		p.keyHeaders = append(p.keyHeaders, http.CanonicalHeaderKey(header))
+	}
+	if p.maxBodyBytes <= 0 {
+		p.maxBodyBytes = defaultMaxBodyBytes
+	}
+	return p
+}
+
+// MaxBodyBytes is the largest response body stored.
+func (p *Policy) MaxBodyBytes() int {
+	return p.maxBodyBytes
+}
+
+// Lookup reports whether r may be answered from the cache, and whether a
+// stored response must be revalidated first.
+func (p *Policy) Lookup(r *http.Request) (cacheable, revalidate bool) {
+	if r.Method != http.MethodGet {
+		return false, false
+	}
+	cc := ParseCacheControl(r.Header.Values("Cache-Control"))
+	if cc.Has("no-store") {
+		return false, false
+	}
+	maxAge, ok := cc.Seconds("max-age")
+	return true, cc.Has("no-cache") || (ok && maxAge == 0)
+}
+
+// Key identifies the response to r within service. Credentials are part of
+// the key when the policy is per user.
+func (p *Policy) Key(service string, r *http.Request) string {
+	h := sha256.New()
+	write := func(parts ...string) {
+		for _, part := range parts {
+			h.Write([]byte(part))
+			h.Write([]byte{0})
+		}
+	}
+	write(service, r.Method, r.URL.Path, r.URL.Query().Encode())
+	for _, header := range p.keyHeaders {
+		write(header, strings.Join(r.Header.Values(header), ","))
+	}
+	if p.perUser {
+		write(r.Header.Get("Authorization"), r.Header.Get(ConsumerHeader))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// VariantKey is the key of the variant of key selected by r's values of the
+// headers a response varies on.
+func VariantKey(key string, vary []string, r *http.Request) string {
+	h := sha256.New()
+	h.Write([]byte(key))
+	for _, header := range vary {
+		h.Write([]byte{0})
+		h.Write([]byte(strings.Join(r.Header.Values(header), ",")))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Vary returns the request headers named by the response's Vary header.
+func Vary(header http.Header) []string {
+	var names []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// Entry builds the stored form of a response to r and the time it should
+// be kept. It reports false when the response must not be stored.
+func (p *Policy) Entry(r *http.Request, status int, header http.Header, body []byte, now time.Time) (*rds.CachedResponse, time.Duration, bool) {
+	if !cacheableStatus[status] || len(body) > p.maxBodyBytes || header.Get("Set-Cookie") != "" {
+		return nil, 0, false
+	}
+	cc := ParseCacheControl(header.Values("Cache-Control"))
+	if cc.Has("no-store") || cc.Has("private") {
+		return nil, 0, false
+	}
+	vary := Vary(header)
+	if slices.Contains(vary, "*") {
+		return nil, 0, false
+	}
+	// A shared cache only stores answers to authenticated requests when
+	// the backend allows it or entries are kept apart per caller.
+	credentials := r.Header.Get("Authorization") != "" || r.Header.Get(ConsumerHeader) != ""
+	if credentials && !p.perUser && !cc.Has("public") && !cc.Has("s-maxage") && !cc.Has("must-revalidate") {
+		return nil, 0, false
+	}
+
+	lifetime, explicit := freshnessLifetime(cc, header)
+	if !explicit {
+		lifetime = p.ttl
+	}
+	if cc.Has("no-cache") {
+		lifetime = 0
+	}
+	if age, err := strconv.Atoi(header.Get("Age")); err == nil && age > 0 {
+		lifetime -= time.Duration(age) * time.Second
+	}
+	lifetime = max(lifetime, 0)
+
+	entry := &rds.CachedResponse{
+		Status:               status,
+		Header:               header.Clone(),
+		Body:                 body,
+		Vary:                 vary,
+		StoredAt:             now,
+		FreshUntil:           now.Add(lifetime),
+		StaleWhileRevalidate: p.swr,
+		StaleIfError:         p.sie,
+	}
+	if d, ok := cc.Seconds("stale-while-revalidate"); ok {
+		entry.StaleWhileRevalidate = d
+	}
+	if d, ok := cc.Seconds("stale-if-error"); ok {
+		entry.StaleIfError = d
+	}
+	if cc.Has("must-revalidate") || cc.Has("proxy-revalidate") {
+		entry.StaleWhileRevalidate, entry.StaleIfError = 0, 0
+	}
+
+	ttl := lifetime + max(entry.StaleWhileRevalidate, entry.StaleIfError)
+	if Validator(header) {
+		ttl += revalidationWindow
+	}
+	if ttl <= 0 {
+		return nil, 0, false
+	}
+	return entry, ttl, true
+}
+
+// Refresh applies a 304 Not Modified answer to a stored entry and returns
+// the updated copy and how long to keep it.
+func (p *Policy) Refresh(r *http.Request, entry *rds.CachedResponse, notModified http.Header, now time.Time) (*rds.CachedResponse, time.Duration, bool) {
+	header := entry.Header.Clone()
+	for name, values := range notModified {
+		header[name] = values
+	}
+	return p.Entry(r, entry.Status, header, entry.Body, now)
+}
+
+// freshnessLifetime reads s-maxage, max-age or Expires, in that order.
+func freshnessLifetime(cc Directives, header http.Header) (time.Duration, bool) {
+	if d, ok := cc.Seconds("s-maxage"); ok {
+		return d, true
+	}
+	if d, ok := cc.Seconds("max-age"); ok {
+		return d, true
+	}
+	if value := header.Get("Expires"); value != "" {
+		expires, err := http.ParseTime(value)
+		if err != nil {
+			return 0, true // invalid Expires means already expired
+		}
+		date, err := http.ParseTime(header.Get("Date"))
+		if err != nil {
+			date = time.Now()
+		}
+		return expires.Sub(date), true
+	}
+	return 0, false
+}
+
+// Validator reports whether a response can be revalidated.
+func Validator(header http.Header) bool {
+	return header.Get("ETag") != "" || header.Get("Last-Modified") != ""
+}
+
+// MatchETag reports whether an If-None-Match header matches etag, using the
+// weak comparison.
+func MatchETag(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Directives are parsed Cache-Control directives, keyed by lower case name.
+type Directives map[string]string
+
+func ParseCacheControl(values []string) Directives {
+	directives := make(Directives)
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name == "" {
+				continue
+			}
+			directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+	return directives
+}
+
+func (d Directives) Has(name string) bool {
+	_, ok := d[name]
+	return ok
+}
+
+// Seconds returns a delta-seconds argument.
+func (d Directives) Seconds(name string) (time.Duration, bool) {
+	arg, ok := d[name]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(arg)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
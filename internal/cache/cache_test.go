@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+)
+
+func TestPolicy_Entry(t *testing.T) {
+	policy := NewPolicy(config.ServiceCacheConfig{Enabled: true, TTLSeconds: 30, StaleIfErrorSeconds: 60}, config.CacheConfig{MaxBodyBytes: 16})
+	now := time.Now()
+	tests := []struct {
+		name      string
+		auth      bool
+		status    int
+		header    http.Header
+		body      string
+		stored    bool
+		freshness time.Duration
+	}{
+		{"max-age", false, 200, http.Header{"Cache-Control": {"max-age=60"}}, "ok", true, time.Minute},
+		{"s-maxage wins", false, 200, http.Header{"Cache-Control": {"max-age=60, s-maxage=10"}}, "ok", true, 10 * time.Second},
+		{"expires", false, 200, http.Header{"Date": {now.UTC().Format(http.TimeFormat)}, "Expires": {now.Add(2 * time.Minute).UTC().Format(http.TimeFormat)}}, "ok", true, 2 * time.Minute},
+		{"policy ttl", false, 200, http.Header{}, "ok", true, 30 * time.Second},
+		{"age", false, 200, http.Header{"Cache-Control": {"max-age=60"}, "Age": {"20"}}, "ok", true, 40 * time.Second},
+		{"no-store", false, 200, http.Header{"Cache-Control": {"no-store"}}, "ok", false, 0},
+		{"private", false, 200, http.Header{"Cache-Control": {"private, max-age=60"}}, "ok", false, 0},
+		{"vary star", false, 200, http.Header{"Vary": {"*"}}, "ok", false, 0},
+		{"set-cookie", false, 200, http.Header{"Set-Cookie": {"session=1"}}, "ok", false, 0},
+		{"server error", false, 500, http.Header{"Cache-Control": {"max-age=60"}}, "ok", false, 0},
+		{"too large", false, 200, http.Header{}, "0123456789abcdefg", false, 0},
+		{"authenticated", true, 200, http.Header{"Cache-Control": {"max-age=60"}}, "ok", false, 0},
+		{"authenticated public", true, 200, http.Header{"Cache-Control": {"public, max-age=60"}}, "ok", true, time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/products", nil)
+			if tt.auth {
+				r.Header.Set("Authorization", "Bearer token")
+			}
+			entry, _, ok := policy.Entry(r, tt.status, tt.header, []byte(tt.body), now)
+			if ok != tt.stored {
+				t.Fatalf("stored = %v, want %v", ok, tt.stored)
+			}
+			if ok && entry.FreshUntil.Sub(now).Round(time.Second) != tt.freshness {
+				t.Errorf("freshness = %v, want %v", entry.FreshUntil.Sub(now), tt.freshness)
+			}
+		})
+	}
+}
+
+func TestPolicy_Key(t *testing.T) {
+	policy := NewPolicy(config.ServiceCacheConfig{Enabled: true, KeyHeaders: []string{"X-Tenant"}, PerUser: true}, config.CacheConfig{})
+	request := func(query, tenant, token string) *http.Request {
+		r := httptest.NewRequest("GET", "/products"+query, nil)
+		r.Header.Set("X-Tenant", tenant)
+		r.Header.Set("Authorization", token)
+		return r
+	}
+
+	base := policy.Key("catalogue", request("?a=1&b=2", "acme", "t1"))
+	if policy.Key("catalogue", request("?b=2&a=1", "acme", "t1")) != base {
+		t.Error("query parameter order changed the key")
+	}
+	for name, r := range map[string]*http.Request{
+		"query":  request("?a=1", "acme", "t1"),
+		"header": request("?a=1&b=2", "globex", "t1"),
+		"user":   request("?a=1&b=2", "acme", "t2"),
+	} {
+		if policy.Key("catalogue", r) == base {
+			t.Errorf("a different %s produced the same key", name)
+		}
+	}
+}
+
+func TestMatchETag(t *testing.T) {
+	for _, tt := range []struct {
+		ifNoneMatch, etag string
+		want              bool
+	}{
+		{`"v1"`, `"v1"`, true},
+		{`"v0", W/"v1"`, `"v1"`, true},
+		{`*`, `"v1"`, true},
+		{`"v2"`, `"v1"`, false},
+		{``, `"v1"`, false},
+	} {
+		if got := MatchETag(tt.ifNoneMatch, tt.etag); got != tt.want {
+			t.Errorf("MatchETag(%q, %q) = %v, want %v", tt.ifNoneMatch, tt.etag, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mtsgn/mtsgn-mtsgn-system-common-svc/common/logger"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/auth"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/problem"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/server"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+	rds "github.com/mtsgn/mtsgn-system-gateway-svc/pkg/redis"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/utils"
+)
+
+// AdminHandler serves the operational /admin API. Every request must carry
+// the configured admin API key as a bearer token.
+type AdminHandler struct {
+	config      *config.Config
+	logger      utils.ContextLogger
+	denyList    rds.DenyList
+	banStore    rds.BanStore
+	revocations *auth.RevocationChecker
+	apiKeys     rds.APIKeyStore
+	problems    *problem.Writer
+	mux         *http.ServeMux
+}
+
+func NewAdminHandler(cfg *config.Config, denyList rds.DenyList, banStore rds.BanStore, revocations *auth.RevocationChecker, apiKeys rds.APIKeyStore, problems *problem.Writer, logger logger.ZeroLogger) *AdminHandler {
+	a := &AdminHandler{
+		config:      cfg,
+		logger:      utils.NewContextLogger(logger),
+		denyList:    denyList,
+		banStore:    banStore,
+		revocations: revocations,
+		apiKeys:     apiKeys,
+		problems:    problems,
+		mux:         http.NewServeMux(),
+	}
+
+	a.mux.HandleFunc("GET /admin/ip-deny", a.listDenyEntries)
+	a.mux.HandleFunc("POST /admin/ip-deny", a.addDenyEntry)
+	a.mux.HandleFunc("DELETE /admin/ip-deny", a.removeDenyEntry)
+	a.mux.HandleFunc("GET /admin/bans", a.listBans)
+	a.mux.HandleFunc("DELETE /admin/bans", a.liftBan)
+	a.mux.HandleFunc("POST /admin/revocations", a.revoke)
+	a.mux.HandleFunc("GET /admin/api-keys", a.listAPIKeys)
+	a.mux.HandleFunc("POST /admin/api-keys", a.createAPIKey)
+	a.mux.HandleFunc("DELETE /admin/api-keys", a.deleteAPIKey)
+	return a
+}
+
+func (a *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if a.config.Admin.APIKey == "" {
+		a.problems.Write(w, r, "", problem.New(http.StatusNotFound, problem.CodeNotFound, "Not found"))
+		return
+	}
+
+	token := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	if subtle.ConstantTimeCompare([]byte(token), []byte(a.config.Admin.APIKey)) != 1 {
+		a.problems.Write(w, r, "", problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "Unauthorized"))
+		return
+	}
+
+	a.mux.ServeHTTP(w, r)
+}
+
+// Protect puts next behind the IP filter, the ban check and the global rate
+// limit, and counts its 401 answers toward bans, so that the admin key cannot
+// be brute-forced. next is not routed to any service.
+func (p *ProxyHandler) Protect(next http.Handler) http.Handler {
+	guarded := p.ipFilterMiddleware(p.banMiddleware(p.rateLimitMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		if sw.status == http.StatusUnauthorized {
+			p.recordClientFailure(r.Context(), utils.GetClientIP(r), failureAuth)
+		}
+	})))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		guarded(w, r.WithContext(context.WithValue(r.Context(), routeMatchKey{}, (*server.Match)(nil))))
+	})
+}
+
+// statusWriter records the status of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+type denyEntryRequest struct {
+	Entry      string `json:"entry"`
+	TTLSeconds int    `json:"ttl_seconds"`
+	Reason     string `json:"reason"`
+}
+
+func (a *AdminHandler) listDenyEntries(w http.ResponseWriter, r *http.Request) {
+	entries, err := a.denyList.List(r.Context())
+	if err != nil {
+		a.logger.Error(r.Context(), "Failed to list deny entries", "error", err)
+		a.problems.Write(w, r, "", problem.New(http.StatusInternalServerError, problem.CodeInternal, "Failed to list deny entries"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"entries": entries})
+}
+
+func (a *AdminHandler) addDenyEntry(w http.ResponseWriter, r *http.Request) {
+	var req denyEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Entry == "" {
+		a.problems.Write(w, r, "", problem.New(http.StatusBadRequest, problem.CodeBadRequest, "Request body must contain an entry"))
+		return
+	}
+	if _, err := rds.ParseDenyEntry(req.Entry); err != nil {
+		a.problems.Write(w, r, "", problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error()))
+		return
+	}
+
+	ttl := time.Duration(req.TTLSeconds) * time.Second
+	if err := a.denyList.Add(r.Context(), req.Entry, ttl, req.Reason); err != nil {
+		a.logger.Error(r.Context(), "Failed to add deny entry", "entry", req.Entry, "error", err)
+		a.problems.Write(w, r, "", problem.New(http.StatusInternalServerError, problem.CodeInternal, "Failed to add deny entry"))
+		return
+	}
+
+	a.logger.Info(r.Context(), "Deny entry added", "entry", req.Entry, "ttl", ttl, "reason", req.Reason)
+	writeJSON(w, http.StatusCreated, req)
+}
+
+func (a *AdminHandler) removeDenyEntry(w http.ResponseWriter, r *http.Request) {
+	entry := r.URL.Query().Get("entry")
+	if _, err := rds.ParseDenyEntry(entry); err != nil {
+		a.problems.Write(w, r, "", problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error()))
+		return
+	}
+
+	if err := a.denyList.Remove(r.Context(), entry); err != nil {
+		a.logger.Error(r.Context(), "Failed to remove deny entry", "entry", entry, "error", err)
+		a.problems.Write(w, r, "", problem.New(http.StatusInternalServerError, problem.CodeInternal, "Failed to remove deny entry"))
+		return
+	}
+
+	a.logger.Info(r.Context(), "Deny entry removed", "entry", entry)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *AdminHandler) listBans(w http.ResponseWriter, r *http.Request) {
+	bans, err := a.banStore.List(r.Context())
+	if err != nil {
+		a.logger.Error(r.Context(), "Failed to list bans", "error", err)
+		a.problems.Write(w, r, "", problem.New(http.StatusInternalServerError, problem.CodeInternal, "Failed to list bans"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"bans": bans})
+}
+
+func (a *AdminHandler) liftBan(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		a.problems.Write(w, r, "", problem.New(http.StatusBadRequest, problem.CodeBadRequest, "Query parameter key is required"))
+		return
+	}
+
+	if err := a.banStore.Unban(r.Context(), key); err != nil {
+		a.logger.Error(r.Context(), "Failed to lift ban", "key", key, "error", err)
+		a.problems.Write(w, r, "", problem.New(http.StatusInternalServerError, problem.CodeInternal, "Failed to lift ban"))
+		return
+	}
+
+	a.logger.Info(r.Context(), "Ban lifted", "key", key)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type revocationRequest struct {
+	Kind       string `json:"kind"` // session or token
+	ID         string `json:"id"`
+	TTLSeconds int    `json:"ttl_seconds"`
+}
+
+func (a *AdminHandler) revoke(w http.ResponseWriter, r *http.Request) {
+	if a.revocations == nil {
+		a.problems.Write(w, r, "", problem.New(http.StatusNotFound, problem.CodeNotFound, "Revocation is not enabled"))
+		return
+	}
+
+	var req revocationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == "" {
+		a.problems.Write(w, r, "", problem.New(http.StatusBadRequest, problem.CodeBadRequest, "Request body must contain a kind and an id"))
+		return
+	}
+	if req.Kind != rds.RevocationSession && req.Kind != rds.RevocationToken {
+		a.problems.Write(w, r, "", problem.New(http.StatusBadRequest, problem.CodeBadRequest, "kind must be session or token"))
+		return
+	}
+
+	if err := a.revocations.Revoke(r.Context(), req.Kind, req.ID, time.Duration(req.TTLSeconds)*time.Second); err != nil {
+		a.logger.Error(r.Context(), "Failed to revoke", "kind", req.Kind, "id", req.ID, "error", err)
+		a.problems.Write(w, r, "", problem.New(http.StatusInternalServerError, problem.CodeInternal, "Failed to revoke"))
+		return
+	}
+
+	a.logger.Info(r.Context(), "Revoked", "kind", req.Kind, "id", req.ID)
+	writeJSON(w, http.StatusCreated, req)
+}
+
+type apiKeyRequest struct {
+	Owner      string   `json:"owner"`
+	Scopes     []string `json:"scopes"`
+	Plan       string   `json:"plan"`
+	TTLSeconds int      `json:"ttl_seconds"` // No expiry when 0
+}
+
+type apiKeyResponse struct {
+	Key string `json:"key"` // Only returned on creation
+	rds.APIKey
+}
+
+func (a *AdminHandler) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := a.apiKeys.List(r.Context())
+	if err != nil {
+		a.logger.Error(r.Context(), "Failed to list api keys", "error", err)
+		a.problems.Write(w, r, "", problem.New(http.StatusInternalServerError, problem.CodeInternal, "Failed to list api keys"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"api_keys": keys})
+}
+
+func (a *AdminHandler) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req apiKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Owner == "" {
+		a.problems.Write(w, r, "", problem.New(http.StatusBadRequest, problem.CodeBadRequest, "Request body must contain an owner"))
+		return
+	}
+	if req.Plan != "" && !hasRateLimitPolicy(a.config.RateLimit, req.Plan) {
+		a.problems.Write(w, r, "", problem.New(http.StatusBadRequest, problem.CodeBadRequest, "Unknown plan "+req.Plan))
+		return
+	}
+
+	raw, err := auth.GenerateAPIKey()
+	if err != nil {
+		a.logger.Error(r.Context(), "Failed to generate api key", "error", err)
+		a.problems.Write(w, r, "", problem.New(http.StatusInternalServerError, problem.CodeInternal, "Failed to create api key"))
+		return
+	}
+	key := rds.APIKey{
+		Hash:      auth.HashAPIKey(raw),
+		Owner:     req.Owner,
+		Scopes:    req.Scopes,
+		Plan:      req.Plan,
+		CreatedAt: time.Now().UTC(),
+	}
+	if req.TTLSeconds > 0 {
+		key.ExpiresAt = key.CreatedAt.Add(time.Duration(req.TTLSeconds) * time.Second)
+	}
+
+	if err := a.apiKeys.Put(r.Context(), key); err != nil {
+		a.logger.Error(r.Context(), "Failed to store api key", "owner", req.Owner, "error", err)
+		a.problems.Write(w, r, "", problem.New(http.StatusInternalServerError, problem.CodeInternal, "Failed to create api key"))
+		return
+	}
+
+	a.logger.Info(r.Context(), "API key created", "owner", key.Owner, "hash", key.Hash, "plan", key.Plan)
+	writeJSON(w, http.StatusCreated, apiKeyResponse{Key: raw, APIKey: key})
+}
+
+func (a *AdminHandler) deleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	hash := r.URL.Query().Get("hash")
+	if hash == "" {
+		a.problems.Write(w, r, "", problem.New(http.StatusBadRequest, problem.CodeBadRequest, "Query parameter hash is required"))
+		return
+	}
+
+	if err := a.apiKeys.Delete(r.Context(), hash); err != nil {
+		a.logger.Error(r.Context(), "Failed to delete api key", "hash", hash, "error", err)
+		a.problems.Write(w, r, "", problem.New(http.StatusInternalServerError, problem.CodeInternal, "Failed to delete api key"))
+		return
+	}
+
+	a.logger.Info(r.Context(), "API key deleted", "hash", hash)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mtsgn/mtsgn-mtsgn-system-common-svc/common/logger"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+	rds "github.com/mtsgn/mtsgn-system-gateway-svc/pkg/redis"
+)
+
+func TestProtect_BansAdminKeyGuessing(t *testing.T) {
+	cfg := &config.Config{
+		Admin: config.AdminConfig{APIKey: "secret"},
+		Ban:   config.BanConfig{Enabled: true, Threshold: 2, BanSeconds: 60},
+		// A catch-all service must not change how the admin API is guarded.
+		Services: []config.ServiceConfig{{Name: "web", BasePath: "/*", Target: "http://127.0.0.1:1", SkipAuth: true}},
+	}
+	bans := rds.NewLocalBanStore()
+	proxy, err := NewProxyHandler(cfg, ProxyDeps{RateLimiter: rds.NewTokenBucketLimiter(100, 100), BanStore: bans})
+	if err != nil {
+		t.Fatalf("NewProxyHandler() error = %v", err)
+	}
+	admin := proxy.Protect(NewAdminHandler(cfg, rds.NewLocalDenyList(), bans, nil, nil, nil, logger.ZeroLogger{}))
+
+	serve := func(key string) int {
+		r := httptest.NewRequest("GET", "/admin/bans", nil)
+		r.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, r)
+		return w.Code
+	}
+	for i := 0; i < 2; i++ {
+		if code := serve("guess"); code != http.StatusUnauthorized {
+			t.Fatalf("guess %d: status = %d, want 401", i, code)
+		}
+	}
+	if code := serve("secret"); code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403 once banned", code)
+	}
+}
+
+func TestNewProxyHandler_RejectsAdminRoutes(t *testing.T) {
+	cfg := &config.Config{Services: []config.ServiceConfig{{Name: "ops", BasePath: "/admin/ops/*", SkipAuth: true}}}
+	if _, err := NewProxyHandler(cfg, ProxyDeps{RateLimiter: rds.NewTokenBucketLimiter(100, 100)}); err == nil {
+		t.Error("NewProxyHandler() error = nil, want /admin rejected on the gateway port")
+	}
+
+	cfg.Admin.Port = 9091
+	if _, err := NewProxyHandler(cfg, ProxyDeps{RateLimiter: rds.NewTokenBucketLimiter(100, 100)}); err != nil {
+		t.Errorf("NewProxyHandler() error = %v with the admin API on its own port", err)
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/auth"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/middleware"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/server"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+	rds "github.com/mtsgn/mtsgn-system-gateway-svc/pkg/redis"
+)
+
+// apiKeyClaimHeaders forwards the consumer behind an API key.
+var apiKeyClaimHeaders = []config.ClaimHeader{
+	{Claim: "consumerId", Header: "X-Consumer-ID"},
+	{Claim: "plan", Header: "X-Consumer-Plan"},
+	{Claim: "scope", Header: "X-Consumer-Scopes"},
+}
+
+type consumerContextKey struct{}
+
+type consumerResult struct {
+	key rds.APIKey
+	err error
+}
+
+// resolveConsumer authenticates the request's API key once; the result is
+// kept in the returned request's context for later middlewares.
+func (p *ProxyHandler) resolveConsumer(r *http.Request) (*http.Request, rds.APIKey, error) {
+	if result, ok := r.Context().Value(consumerContextKey{}).(*consumerResult); ok {
+		return r, result.key, result.err
+	}
+	if p.apiKeys == nil {
+		return r, rds.APIKey{}, errors.New("api key authentication is not configured")
+	}
+
+	key, err := p.apiKeys.Authenticate(r.Context(), r)
+	r = r.WithContext(context.WithValue(r.Context(), consumerContextKey{}, &consumerResult{key: key, err: err}))
+	return r, key, err
+}
+
+func (p *ProxyHandler) apiKeyAuthorization(r *http.Request, service *server.ServiceConfig) (auth.Claims, error) {
+	_, key, err := p.resolveConsumer(r)
+	if err != nil {
+		return nil, err
+	}
+	middleware.SetUserID(r.Context(), key.Owner)
+
+	claims := auth.APIKeyClaims(key)
+	if err := p.access[service.Name].Authorize(r.Method, r.URL.Path, claims); err != nil {
+		return nil, err
+	}
+
+	p.apiKeys.StripCredentials(r)
+	for _, mapping := range apiKeyClaimHeaders {
+		if value := claims.String(mapping.Claim); value != "" {
+			r.Header.Set(mapping.Header, value)
+		}
+	}
+	return claims, nil
+}
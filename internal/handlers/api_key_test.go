@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/auth"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+	rds "github.com/mtsgn/mtsgn-system-gateway-svc/pkg/redis"
+)
+
+func TestAPIKeyService(t *testing.T) {
+	var consumer string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		consumer = r.Header.Get("X-Consumer-ID")
+	}))
+	defer backend.Close()
+
+	store, err := rds.NewLocalAPIKeyStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Put(context.Background(), rds.APIKey{Hash: auth.HashAPIKey("gk_test"), Owner: "acme"})
+
+	cfg := &config.Config{Services: []config.ServiceConfig{
+		{Name: "partners", BasePath: "/api/partners/*", Target: backend.URL, Auth: config.AuthModeAPIKey},
+	}}
+	apiKeys := auth.NewAPIKeyAuthenticator(store, cfg.Auth.APIKeys)
+	proxy, err := NewProxyHandler(cfg, ProxyDeps{RateLimiter: rds.NewTokenBucketLimiter(100, 100), APIKeys: apiKeys})
+	if err != nil {
+		t.Fatalf("NewProxyHandler() error = %v", err)
+	}
+
+	for _, tt := range []struct {
+		key  string
+		want int
+	}{
+		{"gk_test", http.StatusOK},
+		{"gk_unknown", http.StatusUnauthorized},
+	} {
+		r := httptest.NewRequest("GET", "/api/partners/1", nil)
+		r.Header.Set("X-API-Key", tt.key)
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("key %s: status = %d, want %d", tt.key, w.Code, tt.want)
+		}
+	}
+	if consumer != "acme" {
+		t.Errorf("X-Consumer-ID = %q, want acme", consumer)
+	}
+}
+
+// unavailableKeyStore fails every lookup, like Redis during an outage.
+type unavailableKeyStore struct {
+	rds.APIKeyStore
+}
+
+func (unavailableKeyStore) Get(ctx context.Context, hash string) (rds.APIKey, bool, error) {
+	return rds.APIKey{}, false, errors.New("connection refused")
+}
+
+func TestAPIKeyService_StoreUnavailable(t *testing.T) {
+	cfg := &config.Config{
+		Ban: config.BanConfig{Enabled: true, Threshold: 1},
+		Services: []config.ServiceConfig{
+			{Name: "partners", BasePath: "/api/partners/*", Target: "http://127.0.0.1:1", Auth: config.AuthModeAPIKey},
+		},
+	}
+	bans := rds.NewLocalBanStore()
+	apiKeys := auth.NewAPIKeyAuthenticator(unavailableKeyStore{}, cfg.Auth.APIKeys)
+	proxy, err := NewProxyHandler(cfg, ProxyDeps{RateLimiter: rds.NewTokenBucketLimiter(100, 100), BanStore: bans, APIKeys: apiKeys})
+	if err != nil {
+		t.Fatalf("NewProxyHandler() error = %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		r := httptest.NewRequest("GET", "/api/partners/1", nil)
+		r.Header.Set("X-API-Key", "gk_test")
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, r)
+		if w.Code != http.StatusServiceUnavailable {
+			t.Fatalf("request %d: status = %d, want 503", i, w.Code)
+		}
+	}
+	if list, _ := bans.List(context.Background()); len(list) != 0 {
+		t.Errorf("bans = %v, want none during a key store outage", list)
+	}
+}
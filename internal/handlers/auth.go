@@ -1,68 +1,111 @@
 package handlers
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 
-	"aidanwoods.dev/go-paseto"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/auth"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/middleware"
 	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/server"
 	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
 )
 
-func (p *ProxyHandler) authorizationMiddleware(w http.ResponseWriter, r *http.Request, cfg *config.Config, service *server.ServiceConfig) error {
+// authorizationMiddleware returns the verified claims, which are empty for
+// anonymous requests and services that skip auth.
+func (p *ProxyHandler) authorizationMiddleware(w http.ResponseWriter, r *http.Request, cfg *config.Config, service *server.ServiceConfig) (auth.Claims, error) {
 	if service == nil {
-		return errors.New("service not found")
+		return nil, errors.New("service not found")
 	}
 
 	if service.SkipAuth {
-		return nil
+		return nil, nil
 	}
 
+	switch service.Auth {
+	case config.AuthModeAPIKey:
+		return p.apiKeyAuthorization(r, service)
+	case config.AuthModeOptional:
+		return p.optionalAuthorization(r, service)
+	}
+	return p.tokenAuthorization(r, service)
+}
+
+// authResult labels a successful authorizationMiddleware call for metrics.
+func authResult(r *http.Request, service *server.ServiceConfig) string {
+	switch {
+	case service.SkipAuth:
+		return "skipped"
+	case service.Auth == config.AuthModeOptional && r.Header.Get("X-Auth-State") != authStateAuthenticated:
+		return r.Header.Get("X-Auth-State")
+	default:
+		return "success"
+	}
+}
+
+// X-Auth-State values sent to backends of optional auth services.
+const (
+	authStateAuthenticated = "authenticated"
+	authStateAnonymous     = "anonymous"
+	authStateInvalid       = "invalid"
+)
+
+// optionalAuthorization lets requests without a token through as anonymous.
+// Access rules still apply to them, with no claims.
+func (p *ProxyHandler) optionalAuthorization(r *http.Request, service *server.ServiceConfig) (auth.Claims, error) {
+	if r.Header.Get("Authorization") == "" {
+		r.Header.Set("X-Auth-State", authStateAnonymous)
+		return nil, p.access[service.Name].Authorize(r.Method, r.URL.Path, auth.Claims{})
+	}
+
+	claims, err := p.tokenAuthorization(r, service)
+	var denied *auth.AccessDeniedError
+	switch {
+	case err == nil:
+		r.Header.Set("X-Auth-State", authStateAuthenticated)
+		return claims, nil
+	case errors.As(err, &denied), errors.Is(err, auth.ErrIntrospectionFailed):
+		return nil, err
+	case service.InvalidToken == config.InvalidTokenIgnore:
+		middleware.RecordAuthFailure(auth.FailureReason(err))
+		r.Header.Set("X-Auth-State", authStateInvalid)
+		return nil, p.access[service.Name].Authorize(r.Method, r.URL.Path, auth.Claims{})
+	default:
+		return nil, err
+	}
+}
+
+func (p *ProxyHandler) tokenAuthorization(r *http.Request, service *server.ServiceConfig) (auth.Claims, error) {
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
-		return errors.New("authorization header is required")
+		return nil, auth.ErrMissingToken
 	}
 
 	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 	tokenString = strings.TrimSpace(tokenString)
 
-	parser := paseto.NewParser()
-
-	publicKey, err := paseto.NewV4AsymmetricPublicKeyFromHex(cfg.Auth.JWTSecret)
+	verifier, err := p.verifiers.For(service.TokenType)
 	if err != nil {
-		return fmt.Errorf("Invalid public key configuration: %v", err)
+		return nil, err
 	}
 
-	token, err := parser.ParseV4Public(publicKey, tokenString, nil)
+	claims, err := verifier.Verify(r.Context(), tokenString, p.validators[service.Name])
 	if err != nil {
-		return fmt.Errorf("Invalid token: %v", err)
+		return nil, fmt.Errorf("Invalid token: %w", err)
 	}
 
-	var claims map[string]interface{}
-	if err := json.Unmarshal(token.ClaimsJSON(), &claims); err != nil {
-		return fmt.Errorf("Failed to parse token claims: %v", err)
+	if p.revocations != nil {
+		if err := p.revocations.Check(r.Context(), claims); err != nil {
+			return nil, fmt.Errorf("Invalid token: %w", err)
+		}
 	}
+	middleware.SetUserID(r.Context(), claims.String("sub"))
 
-	if userID, exists := claims["userId"]; exists {
-		r.Header.Set("X-User-ID", fmt.Sprintf("%v", userID))
-	}
-	if admin, exists := claims["isAdmin"]; exists {
-		r.Header.Set("X-Is-Admin", fmt.Sprintf("%v", admin))
+	if err := p.access[service.Name].Authorize(r.Method, r.URL.Path, claims); err != nil {
+		return nil, err
 	}
-	if issuedAt, exists := claims["iat"]; exists {
-		r.Header.Set("X-Issued-At", fmt.Sprintf("%v", issuedAt))
-	}
-	if sessionId, exists := claims["sessionId"]; exists {
-		r.Header.Set("X-Session-ID", fmt.Sprintf("%v", sessionId))
-	}
-	if customClaims, exists := claims["customClaims"]; exists {
-		r.Header.Set("X-Custom-Claims", fmt.Sprintf("%v", customClaims))
-	}
-	if expiresAt, exists := claims["exp"]; exists {
-		r.Header.Set("X-Exp", fmt.Sprintf("%v", expiresAt))
-	}
-	return nil
+
+	p.setClaimHeaders(r, service.Name, claims)
+	return claims, nil
 }
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"aidanwoods.dev/go-paseto"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/auth"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/server"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+)
+
+func TestOptionalAuthorization(t *testing.T) {
+	key := paseto.NewV4SymmetricKey()
+	verifier, err := auth.NewPasetoLocalVerifier(key.ExportHex())
+	if err != nil {
+		t.Fatalf("NewPasetoLocalVerifier() error = %v", err)
+	}
+	token := paseto.NewToken()
+	token.SetExpiration(time.Now().Add(time.Hour))
+	token.SetString("userId", "7")
+	valid := token.V4Encrypt(key, nil)
+
+	cfg := &config.Config{Services: []config.ServiceConfig{{Name: "catalog"}}}
+	claimHeaders, reservedHeaders := newClaimHeaders(cfg)
+	p := &ProxyHandler{
+		verifiers:       auth.Verifiers{config.TokenTypePasetoLocal: verifier},
+		validators:      map[string]auth.Validator{},
+		access:          map[string]*auth.AccessPolicy{},
+		claimHeaders:    claimHeaders,
+		reservedHeaders: reservedHeaders,
+	}
+
+	tests := []struct {
+		name         string
+		token        string
+		invalidToken string
+		wantState    string
+		wantUser     string
+		wantErr      bool
+	}{
+		{"anonymous", "", "", authStateAnonymous, "", false},
+		{"valid token", valid, "", authStateAuthenticated, "7", false},
+		{"invalid token rejected", "garbage", "", "", "", true},
+		{"invalid token ignored", "garbage", config.InvalidTokenIgnore, authStateInvalid, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &server.ServiceConfig{
+				Name:         "catalog",
+				Auth:         config.AuthModeOptional,
+				InvalidToken: tt.invalidToken,
+				TokenType:    config.TokenTypePasetoLocal,
+			}
+			r := httptest.NewRequest("GET", "/api/products", nil)
+			r.Header.Set("X-Auth-State", "forged")
+			r.Header.Set("X-User-ID", "forged")
+			p.stripReservedHeaders(r)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			_, err := p.authorizationMiddleware(httptest.NewRecorder(), r, cfg, service)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("authorizationMiddleware() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := r.Header.Get("X-Auth-State"); got != tt.wantState {
+				t.Errorf("X-Auth-State = %q, want %q", got, tt.wantState)
+			}
+			if got := r.Header.Get("X-User-ID"); got != tt.wantUser {
+				t.Errorf("X-User-ID = %q, want %q", got, tt.wantUser)
+			}
+		})
+	}
+
+	// Access rules still apply to anonymous requests.
+	p.access["catalog"] = auth.NewAccessPolicy([]config.AccessRule{{Methods: []string{"POST"}, Roles: []string{"editor"}}})
+	r := httptest.NewRequest("POST", "/api/products", nil)
+	_, err = p.authorizationMiddleware(httptest.NewRecorder(), r, cfg, &server.ServiceConfig{Name: "catalog", Auth: config.AuthModeOptional})
+	var denied *auth.AccessDeniedError
+	if !errors.As(err, &denied) {
+		t.Errorf("authorizationMiddleware() error = %v, want access denied for anonymous POST", err)
+	}
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/middleware"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+	rds "github.com/mtsgn/mtsgn-system-gateway-svc/pkg/redis"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/utils"
+)
+
+// Failure kinds counted towards a ban.
+const (
+	failureRateLimit = "rate_limit"
+	failureAuth      = "auth"
+)
+
+const reasonClientBanned = "client_banned"
+
+// banDuration returns the ban length for the nth offence: the base duration
+// doubled for every earlier offence, capped at the configured maximum.
+func banDuration(cfg config.BanConfig, offences int64) time.Duration {
+	base := time.Duration(cfg.BanSeconds) * time.Second
+	if base <= 0 {
+		base = time.Minute
+	}
+	maxBan := time.Duration(cfg.MaxBanSeconds) * time.Second
+	if maxBan <= 0 {
+		maxBan = 24 * time.Hour
+	}
+
+	exponent := math.Min(float64(offences-1), 30)
+	duration := time.Duration(float64(base) * math.Pow(2, exponent))
+	if duration > maxBan || duration <= 0 {
+		return maxBan
+	}
+	return duration
+}
+
+// banLookupCache remembers clients found not banned, so that most requests
+// skip the ban store. Bans are never cached, so lifting one applies at once.
+type banLookupCache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]time.Time // checked at
+}
+
+func newBanLookupCache(cfg config.BanConfig) *banLookupCache {
+	ttl := time.Duration(cfg.LookupCacheSeconds) * time.Second
+	if ttl <= 0 {
+		ttl = 2 * time.Second
+	}
+	return &banLookupCache{
+		ttl:        ttl,
+		maxEntries: 10000,
+		entries:    make(map[string]time.Time),
+	}
+}
+
+func (c *banLookupCache) contains(key string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	checkedAt, found := c.entries[key]
+	return found && now.Sub(checkedAt) < c.ttl
+}
+
+func (c *banLookupCache) remember(key string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= c.maxEntries {
+		for cached, checkedAt := range c.entries {
+			if now.Sub(checkedAt) >= c.ttl {
+				delete(c.entries, cached)
+			}
+		}
+		if len(c.entries) >= c.maxEntries {
+			c.entries = make(map[string]time.Time)
+		}
+	}
+	c.entries[key] = now
+}
+
+func (c *banLookupCache) forget(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// ==================== Ban Middleware ====================
+func (p *ProxyHandler) banMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !p.config.Ban.Enabled || p.banStore == nil {
+			next(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		clientIP := utils.GetClientIP(r)
+		now := time.Now()
+		if p.notBanned.contains(clientIP, now) {
+			next(w, r)
+			return
+		}
+		ban, banned, err := p.banStore.Get(ctx, clientIP)
+		if err != nil {
+			p.logger.Error(ctx, "Ban lookup failed", "client_ip", clientIP, "error", err)
+			next(w, r)
+			return
+		}
+
+		if banned {
+			middleware.RecordBannedRequest()
+			retryAfter := int(math.Ceil(time.Until(ban.ExpiresAt).Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+			p.writeForbidden(w, r, p.serviceName(r), reasonClientBanned)
+			return
+		}
+
+		p.notBanned.remember(clientIP, now)
+		next(w, r)
+	}
+}
+
+// recordClientFailure counts a rate limit or authentication failure for the
+// client and bans it once the configured threshold is crossed.
+func (p *ProxyHandler) recordClientFailure(ctx context.Context, clientKey string, kind string) {
+	cfg := p.config.Ban
+	if !cfg.Enabled || p.banStore == nil || clientKey == "" {
+		return
+	}
+
+	window := time.Duration(cfg.WindowSeconds) * time.Second
+	if window <= 0 {
+		window = time.Minute
+	}
+	threshold := cfg.Threshold
+	if threshold <= 0 {
+		threshold = 20
+	}
+
+	failures, err := p.banStore.RecordFailure(ctx, clientKey, window)
+	if err != nil {
+		p.logger.Error(ctx, "Failed to record client failure", "client", clientKey, "error", err)
+		return
+	}
+	if failures < int64(threshold) {
+		return
+	}
+
+	offenceTTL := time.Duration(cfg.OffenceTTLSeconds) * time.Second
+	if offenceTTL <= 0 {
+		offenceTTL = 24 * time.Hour
+	}
+	offences, err := p.banStore.Offend(ctx, clientKey, offenceTTL)
+	if err != nil {
+		p.logger.Error(ctx, "Failed to record client offence", "client", clientKey, "error", err)
+		return
+	}
+
+	now := time.Now()
+	duration := banDuration(cfg, offences)
+	ban := rds.Ban{
+		Key:       clientKey,
+		Reason:    kind,
+		Offences:  offences,
+		BannedAt:  now,
+		ExpiresAt: now.Add(duration),
+	}
+	if err := p.banStore.Ban(ctx, ban); err != nil {
+		p.logger.Error(ctx, "Failed to ban client", "client", clientKey, "error", err)
+		return
+	}
+	p.notBanned.forget(clientKey)
+
+	middleware.RecordClientBan(kind)
+	p.logger.Info(ctx, "Client banned", "client", clientKey, "reason", kind, "offences", offences, "duration", duration)
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+	rds "github.com/mtsgn/mtsgn-system-gateway-svc/pkg/redis"
+)
+
+func TestBanDuration(t *testing.T) {
+	cfg := config.BanConfig{BanSeconds: 60, MaxBanSeconds: 600}
+	tests := []struct {
+		offences int64
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{5, 10 * time.Minute},
+		{100, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := banDuration(cfg, tt.offences); got != tt.want {
+			t.Errorf("banDuration(%d) = %v, want %v", tt.offences, got, tt.want)
+		}
+	}
+	if got := banDuration(config.BanConfig{}, 1); got != time.Minute {
+		t.Errorf("banDuration() with defaults = %v, want 1m", got)
+	}
+}
+
+func TestRecordClientFailure(t *testing.T) {
+	cfg := &config.Config{Ban: config.BanConfig{Enabled: true, Threshold: 3, BanSeconds: 60, MaxBanSeconds: 3600}}
+	bans := rds.NewLocalBanStore()
+	proxy, err := NewProxyHandler(cfg, ProxyDeps{RateLimiter: rds.NewTokenBucketLimiter(100, 100), BanStore: bans})
+	if err != nil {
+		t.Fatalf("NewProxyHandler() error = %v", err)
+	}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		proxy.recordClientFailure(ctx, "192.0.2.1", failureAuth)
+	}
+	if _, banned, _ := bans.Get(ctx, "192.0.2.1"); banned {
+		t.Fatal("client banned below the threshold")
+	}
+
+	proxy.recordClientFailure(ctx, "192.0.2.1", failureAuth)
+	ban, banned, _ := bans.Get(ctx, "192.0.2.1")
+	if !banned || ban.Offences != 1 || ban.Reason != failureAuth {
+		t.Fatalf("Get() = %+v, %v, want first auth ban", ban, banned)
+	}
+	if d := ban.ExpiresAt.Sub(ban.BannedAt); d != time.Minute {
+		t.Errorf("first ban lasts %v, want 1m", d)
+	}
+
+	// Failure history is cleared by the ban, so the next one takes another
+	// full threshold and escalates.
+	for i := 0; i < 3; i++ {
+		proxy.recordClientFailure(ctx, "192.0.2.1", failureRateLimit)
+	}
+	ban, _, _ = bans.Get(ctx, "192.0.2.1")
+	if ban.Offences != 2 || ban.ExpiresAt.Sub(ban.BannedAt) != 2*time.Minute {
+		t.Errorf("second ban = %+v, want 2 offences lasting 2m", ban)
+	}
+}
+
+func TestBanMiddleware(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		Ban:      config.BanConfig{Enabled: true, Threshold: 1, BanSeconds: 60, LookupCacheSeconds: 60},
+		Services: []config.ServiceConfig{{Name: "users", BasePath: "/api/users", Target: backend.URL, SkipAuth: true}},
+	}
+	bans := rds.NewLocalBanStore()
+	proxy, err := NewProxyHandler(cfg, ProxyDeps{RateLimiter: rds.NewTokenBucketLimiter(100, 100), BanStore: bans})
+	if err != nil {
+		t.Fatalf("NewProxyHandler() error = %v", err)
+	}
+	serve := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/api/users", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := serve(); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 before any ban", w.Code)
+	}
+
+	// A ban placed elsewhere is picked up once the cached lookup expires.
+	ctx := context.Background()
+	now := time.Now()
+	bans.Ban(ctx, rds.Ban{Key: "192.0.2.1", BannedAt: now, ExpiresAt: now.Add(time.Minute)})
+	if w := serve(); w.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200 while the lookup is cached", w.Code)
+	}
+
+	// A ban placed by this instance applies at once.
+	proxy.recordClientFailure(ctx, "192.0.2.1", failureAuth)
+	w := serve()
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403 once banned", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("missing Retry-After on a banned request")
+	}
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/cache"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/middleware"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/server"
+	rds "github.com/mtsgn/mtsgn-system-gateway-svc/pkg/redis"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/utils"
+)
+
+// Values of the X-Cache response header.
+const (
+	cacheHit         = "HIT"
+	cacheMiss        = "MISS"
+	cacheStale       = "STALE"
+	cacheRevalidated = "REVALIDATED"
+	cacheBypass      = "BYPASS"
+)
+
+// serveCached answers r from the response cache when it can and forwards it
+// to the backend otherwise.
+func (p *ProxyHandler) serveCached(w http.ResponseWriter, r *http.Request, service *server.ServiceConfig, policy *cache.Policy, target *url.URL) {
+	cacheable, revalidate := policy.Lookup(r)
+	if !cacheable {
+		middleware.RecordCacheResult(service.Name, "bypass")
+		w.Header().Set("X-Cache", cacheBypass)
+		resp, err := p.forward(r, service, target)
+		if err != nil {
+			p.writeRoundTripError(w, r, service, err)
+			return
+		}
+		defer resp.Body.Close()
+		p.writeResponse(w, r, service, resp.StatusCode, resp.Header, resp.Body)
+		return
+	}
+
+	key := policy.Key(service.Name, r)
+	entry := p.lookupCache(r, key)
+	now := time.Now()
+	switch {
+	case entry == nil:
+		p.fetchAndStore(w, r, service, policy, target, key, nil)
+	case !revalidate && entry.Fresh(now):
+		middleware.RecordCacheResult(service.Name, "hit")
+		p.writeCached(w, r, entry, cacheHit)
+	case !revalidate && entry.StaleWhileRevalidating(now):
+		middleware.RecordCacheResult(service.Name, "stale")
+		p.revalidateInBackground(r, service, policy, target, key, entry)
+		p.writeCached(w, r, entry, cacheStale)
+	default:
+		p.fetchAndStore(w, r, service, policy, target, key, entry)
+	}
+}
+
+// fetchAndStore forwards r, revalidating stale when it is set, and stores
+// the backend's answer if it may be cached.
+func (p *ProxyHandler) fetchAndStore(w http.ResponseWriter, r *http.Request, service *server.ServiceConfig, policy *cache.Policy, target *url.URL, key string, stale *rds.CachedResponse) {
+	upstream := r
+	if stale != nil && cache.Validator(stale.Header) {
+		upstream = r.Clone(r.Context())
+		upstream.Header.Del("If-None-Match")
+		upstream.Header.Del("If-Modified-Since")
+		if etag := stale.Header.Get("ETag"); etag != "" {
+			upstream.Header.Set("If-None-Match", etag)
+		} else {
+			upstream.Header.Set("If-Modified-Since", stale.Header.Get("Last-Modified"))
+		}
+	}
+
+	resp, err := p.forward(upstream, service, target)
+	now := time.Now()
+	if stale != nil && stale.StaleOnError(now) && (err != nil || resp.StatusCode >= http.StatusInternalServerError) {
+		if err == nil {
+			resp.Body.Close()
+		}
+		p.logger.Error(r.Context(), "Serving stale response after backend failure", "service", service.Name, "error", err)
+		middleware.RecordCacheResult(service.Name, "stale")
+		p.writeCached(w, r, stale, cacheStale)
+		return
+	}
+	if err != nil {
+		p.writeRoundTripError(w, r, service, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && stale != nil && upstream != r {
+		entry, ttl, ok := policy.Refresh(r, stale, resp.Header, now)
+		if ok {
+			p.storeCache(r, key, entry, ttl)
+		} else {
+			entry = stale
+		}
+		middleware.RecordCacheResult(service.Name, "revalidated")
+		p.writeCached(w, r, entry, cacheRevalidated)
+		return
+	}
+
+	middleware.RecordCacheResult(service.Name, "miss")
+	w.Header().Set("X-Cache", cacheMiss)
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(policy.MaxBodyBytes())+1))
+	if err == nil && r.Method == http.MethodGet {
+		if entry, ttl, ok := policy.Entry(r, resp.StatusCode, resp.Header, body, now); ok {
+			p.storeCache(r, key, entry, ttl)
+		}
+	}
+	p.writeResponse(w, r, service, resp.StatusCode, resp.Header, io.MultiReader(bytes.NewReader(body), resp.Body))
+}
+
+// revalidateInBackground refreshes a stale entry after the client has been
+// answered. Only one refresh per key runs at a time.
+func (p *ProxyHandler) revalidateInBackground(r *http.Request, service *server.ServiceConfig, policy *cache.Policy, target *url.URL, key string, stale *rds.CachedResponse) {
+	if _, running := p.revalidating.LoadOrStore(key, struct{}{}); running {
+		return
+	}
+	background := r.Clone(context.WithoutCancel(r.Context()))
+	background.Body = http.NoBody
+	go func() {
+		defer p.revalidating.Delete(key)
+		p.fetchAndStore(discardResponseWriter{header: make(http.Header)}, background, service, policy, target, key, stale)
+	}()
+}
+
+// lookupCache returns the entry for r, following the Vary index to the
+// variant selected by r's headers.
+func (p *ProxyHandler) lookupCache(r *http.Request, key string) *rds.CachedResponse {
+	entry, ok, err := p.cache.Get(r.Context(), key)
+	if err != nil {
+		p.logger.Error(r.Context(), "Response cache lookup failed", "error", err)
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+	if entry.Status == 0 && len(entry.Vary) > 0 {
+		entry, ok, err = p.cache.Get(r.Context(), cache.VariantKey(key, entry.Vary, r))
+		if err != nil || !ok {
+			return nil
+		}
+	}
+	return entry
+}
+
+func (p *ProxyHandler) storeCache(r *http.Request, key string, entry *rds.CachedResponse, ttl time.Duration) {
+	var err error
+	if len(entry.Vary) > 0 {
+		// The index must outlive every variant it points to, not only the
+		// latest one stored.
+		expires := time.Now().Add(ttl)
+		if existing, ok, _ := p.cache.Get(r.Context(), key); ok && existing.Status == 0 && existing.FreshUntil.After(expires) {
+			expires = existing.FreshUntil
+		}
+		index := &rds.CachedResponse{Vary: entry.Vary, StoredAt: entry.StoredAt, FreshUntil: expires}
+		if err = p.cache.Set(r.Context(), key, index, time.Until(expires)); err == nil {
+			err = p.cache.Set(r.Context(), cache.VariantKey(key, entry.Vary, r), entry, ttl)
+		}
+	} else {
+		err = p.cache.Set(r.Context(), key, entry, ttl)
+	}
+	if err != nil {
+		p.logger.Error(r.Context(), "Response cache store failed", "error", err)
+	}
+}
+
+// writeCached answers r from a stored entry, with 304 Not Modified when the
+// client already holds it.
+func (p *ProxyHandler) writeCached(w http.ResponseWriter, r *http.Request, entry *rds.CachedResponse, state string) {
+	for key, values := range entry.Header {
+		if key == utils.RequestIDHeader {
+			continue
+		}
+		w.Header()[key] = append([]string(nil), values...)
+	}
+	age := max(int(time.Since(entry.StoredAt).Seconds()), 0)
+	w.Header().Set("Age", strconv.Itoa(age))
+	w.Header().Set("X-Cache", state)
+
+	if entry.Status == http.StatusOK && cache.MatchETag(r.Header.Get("If-None-Match"), entry.Header.Get("ETag")) {
+		w.Header().Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(entry.Status)
+	if _, err := w.Write(entry.Body); err != nil {
+		p.logger.Error(r.Context(), "Error writing cached response", "error", err)
+	}
+}
+
+// discardResponseWriter receives background revalidations, which have no
+// client waiting.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (d discardResponseWriter) Header() http.Header         { return d.header }
+func (d discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (d discardResponseWriter) WriteHeader(int)             {}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+	rds "github.com/mtsgn/mtsgn-system-gateway-svc/pkg/redis"
+)
+
+func TestResponseCache(t *testing.T) {
+	var calls, revalidations atomic.Int32
+	var failing atomic.Bool
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "max-age=1, stale-if-error=60")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			revalidations.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("catalogue"))
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{Services: []config.ServiceConfig{
+		{Name: "catalogue", BasePath: "/api/products/*", Target: backend.URL, SkipAuth: true, Cache: config.ServiceCacheConfig{Enabled: true}},
+	}}
+	proxy, err := NewProxyHandler(cfg, ProxyDeps{RateLimiter: rds.NewTokenBucketLimiter(100, 100), ResponseCache: rds.NewLocalResponseCache(100, 0)})
+	if err != nil {
+		t.Fatalf("NewProxyHandler() error = %v", err)
+	}
+
+	get := func(header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/api/products/1", nil)
+		for name, values := range header {
+			r.Header[name] = values
+		}
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, r)
+		return w
+	}
+	expect := func(step string, w *httptest.ResponseRecorder, status int, xcache string) {
+		t.Helper()
+		if w.Code != status || w.Header().Get("X-Cache") != xcache {
+			t.Fatalf("%s: status %d, X-Cache %q, want %d and %q", step, w.Code, w.Header().Get("X-Cache"), status, xcache)
+		}
+	}
+
+	expect("first request", get(nil), http.StatusOK, cacheMiss)
+	w := get(nil)
+	expect("second request", w, http.StatusOK, cacheHit)
+	if w.Body.String() != "catalogue" || calls.Load() != 1 {
+		t.Fatalf("hit body %q after %d backend calls, want the cached body after 1", w.Body.String(), calls.Load())
+	}
+	expect("conditional request", get(http.Header{"If-None-Match": {`"v1"`}}), http.StatusNotModified, cacheHit)
+	expect("no-cache request", get(http.Header{"Cache-Control": {"no-cache"}}), http.StatusOK, cacheRevalidated)
+	if revalidations.Load() != 1 {
+		t.Fatalf("revalidations = %d, want 1", revalidations.Load())
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	failing.Store(true)
+	w = get(nil)
+	expect("backend failure", w, http.StatusOK, cacheStale)
+	if w.Body.String() != "catalogue" {
+		t.Errorf("stale body = %q", w.Body.String())
+	}
+	expect("no-store request", get(http.Header{"Cache-Control": {"no-store"}}), http.StatusBadGateway, cacheBypass)
+}
+
+// ttlCache records the ttl each key was last stored with.
+type ttlCache struct {
+	rds.ResponseCache
+	ttls map[string]time.Duration
+}
+
+func (c *ttlCache) Set(ctx context.Context, key string, resp *rds.CachedResponse, ttl time.Duration) error {
+	c.ttls[key] = ttl
+	return c.ResponseCache.Set(ctx, key, resp, ttl)
+}
+
+func TestStoreCache_VaryIndexOutlivesVariants(t *testing.T) {
+	store := &ttlCache{ResponseCache: rds.NewLocalResponseCache(100, 0), ttls: make(map[string]time.Duration)}
+	cfg := &config.Config{Services: []config.ServiceConfig{{Name: "catalogue", BasePath: "/api/products/*", SkipAuth: true}}}
+	proxy, err := NewProxyHandler(cfg, ProxyDeps{RateLimiter: rds.NewTokenBucketLimiter(100, 100), ResponseCache: store})
+	if err != nil {
+		t.Fatalf("NewProxyHandler() error = %v", err)
+	}
+
+	storeVariant := func(language string, ttl time.Duration) {
+		r := httptest.NewRequest("GET", "/api/products/1", nil)
+		r.Header.Set("Accept-Language", language)
+		proxy.storeCache(r, "k", &rds.CachedResponse{Status: http.StatusOK, Vary: []string{"Accept-Language"}, StoredAt: time.Now()}, ttl)
+	}
+	storeVariant("en", time.Hour)
+	storeVariant("de", time.Minute)
+
+	if ttl := store.ttls["k"]; ttl < 59*time.Minute {
+		t.Errorf("Vary index stored for %v, want it to outlive the one hour variant", ttl)
+	}
+	r := httptest.NewRequest("GET", "/api/products/1", nil)
+	r.Header.Set("Accept-Language", "en")
+	if proxy.lookupCache(r, "k") == nil {
+		t.Error("longer lived variant is unreachable")
+	}
+}
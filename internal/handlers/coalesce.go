@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/cache"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/middleware"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/server"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+)
+
+const defaultCoalesceBodyBytes = 1 << 20
+
+// Headers that always take part in the coalescing key, so that callers
+// never receive an answer meant for other credentials, conditions or
+// content negotiation.
+var coalesceKeyHeaders = []string{
+	"Authorization", "Cookie", cache.ConsumerHeader,
+	"If-None-Match", "If-Modified-Since", "Range",
+	"Accept", "Accept-Encoding", "Accept-Language",
+}
+
+// coalescer shares one backend call among identical concurrent requests.
+type coalescer struct {
+	mu           sync.Mutex
+	calls        map[string]*coalescedCall
+	keyHeaders   []string
+	maxBodyBytes int
+}
+
+// coalescedCall is a backend call in flight. shared is false when the
+// response was too large or too personal to share; waiters then make their
+// own call.
+type coalescedCall struct {
+	done   chan struct{}
+	status int
+	header http.Header
+	body   []byte
+	err    error
+	shared bool
+}
+
+// newCoalescer returns nil when coalescing is disabled.
+func newCoalescer(cfg config.CoalesceConfig) *coalescer {
+	if !cfg.Enabled {
+		return nil
+	}
+	c := &coalescer{
+		calls:        make(map[string]*coalescedCall),
+		keyHeaders:   slices.Clone(coalesceKeyHeaders),
+		maxBodyBytes: cfg.MaxBodyBytes,
+	}
+	for _, header := range cfg.KeyHeaders {
+		if header = http.CanonicalHeaderKey(header); !slices.Contains(c.keyHeaders, header) {
+			c.keyHeaders = append(c.keyHeaders, header)
+		}
+	}
+	if c.maxBodyBytes <= 0 {
+		c.maxBodyBytes = defaultCoalesceBodyBytes
+	}
+	return c
+}
+
+func (c *coalescer) eligible(r *http.Request) bool {
+	return (r.Method == http.MethodGet || r.Method == http.MethodHead) && (r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0)
+}
+
+func (c *coalescer) key(r *http.Request) string {
+	h := sha256.New()
+	write := func(parts ...string) {
+		for _, part := range parts {
+			h.Write([]byte(part))
+			h.Write([]byte{0})
+		}
+	}
+	write(r.Method, r.URL.Path, r.URL.Query().Encode())
+	for _, header := range c.keyHeaders {
+		write(header, strings.Join(r.Header.Values(header), ","))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// shareable reports whether a response may answer every request with the
+// same key: it sets no cookie and varies only on headers in the key.
+func (c *coalescer) shareable(header http.Header) bool {
+	if len(header.Values("Set-Cookie")) > 0 {
+		return false
+	}
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name != "" && !slices.Contains(c.keyHeaders, name) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// forward sends r to the backend. With coalescing enabled for the service,
+// identical requests in flight at the same time share a single call.
+func (p *ProxyHandler) forward(r *http.Request, service *server.ServiceConfig, target *url.URL) (*http.Response, error) {
+	c := p.coalescers[service.Name]
+	if c == nil || !c.eligible(r) {
+		return p.roundTrip(r, service, target)
+	}
+
+	key := c.key(r)
+	c.mu.Lock()
+	if call, ok := c.calls[key]; ok {
+		c.mu.Unlock()
+		return p.awaitCoalesced(r, service, target, call)
+	}
+	call := &coalescedCall{done: make(chan struct{})}
+	c.calls[key] = call
+	c.mu.Unlock()
+	middleware.RecordCoalesced(service.Name, false)
+
+	// Waiters depend on this call, so it outlives the leader's client.
+	resp, err := p.roundTrip(r.WithContext(context.WithoutCancel(r.Context())), service, target)
+	var body []byte
+	if err == nil {
+		body, err = io.ReadAll(io.LimitReader(resp.Body, int64(c.maxBodyBytes)+1))
+		if err != nil {
+			resp.Body.Close()
+		}
+	}
+
+	c.mu.Lock()
+	delete(c.calls, key)
+	c.mu.Unlock()
+	call.err = err
+	if err == nil {
+		call.status = resp.StatusCode
+		call.header = resp.Header
+		call.body = body
+		call.shared = len(body) <= c.maxBodyBytes && c.shareable(resp.Header)
+	}
+	close(call.done)
+
+	if err != nil {
+		return nil, err
+	}
+	if len(body) <= c.maxBodyBytes {
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return resp, nil
+	}
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+	return resp, nil
+}
+
+// awaitCoalesced waits for the call in flight and answers r with a copy of
+// its response.
+func (p *ProxyHandler) awaitCoalesced(r *http.Request, service *server.ServiceConfig, target *url.URL, call *coalescedCall) (*http.Response, error) {
+	start := time.Now()
+	select {
+	case <-call.done:
+	case <-r.Context().Done():
+		return nil, r.Context().Err()
+	}
+	if call.err != nil {
+		return nil, call.err
+	}
+	if !call.shared {
+		return p.roundTrip(r, service, target)
+	}
+
+	middleware.RecordCoalesced(service.Name, true)
+	middleware.SetUpstream(r.Context(), target.Host, time.Since(start))
+	return &http.Response{
+		Status:        http.StatusText(call.status),
+		StatusCode:    call.status,
+		Header:        call.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(call.body)),
+		ContentLength: int64(len(call.body)),
+		Request:       r,
+	}, nil
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+	rds "github.com/mtsgn/mtsgn-system-gateway-svc/pkg/redis"
+)
+
+func TestCoalesce(t *testing.T) {
+	var calls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("hot " + r.Header.Get("Accept-Language")))
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{Services: []config.ServiceConfig{
+		{Name: "catalogue", BasePath: "/api/products/*", Target: backend.URL, SkipAuth: true,
+			Coalesce: config.CoalesceConfig{Enabled: true, KeyHeaders: []string{"Accept-Language"}}},
+	}}
+	proxy, err := NewProxyHandler(cfg, ProxyDeps{RateLimiter: rds.NewTokenBucketLimiter(1000, 1000)})
+	if err != nil {
+		t.Fatalf("NewProxyHandler() error = %v", err)
+	}
+
+	languages := []string{"en", "en", "en", "en", "en", "en", "de", "de"}
+	bodies := make([]string, len(languages))
+	var wg sync.WaitGroup
+	for i, language := range languages {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest("GET", "/api/products/1?page=2", nil)
+			r.Header.Set("Accept-Language", language)
+			w := httptest.NewRecorder()
+			proxy.ServeHTTP(w, r)
+			bodies[i] = w.Body.String()
+		}()
+	}
+	wg.Wait()
+
+	if got := calls.Load(); got != 2 {
+		t.Errorf("backend calls = %d, want one per Accept-Language", got)
+	}
+	for i, body := range bodies {
+		if body != "hot "+languages[i] {
+			t.Errorf("request %d got %q, want %q", i, body, "hot "+languages[i])
+		}
+	}
+}
+
+func TestCoalesce_DoesNotShareAcrossClients(t *testing.T) {
+	tests := []struct {
+		name      string
+		requests  []http.Header
+		response  http.Header
+		wantCalls int32
+	}{
+		{
+			name:      "cookies",
+			requests:  []http.Header{{"Cookie": {"session=a"}}, {"Cookie": {"session=b"}}, {"Cookie": {"session=a"}}},
+			wantCalls: 2,
+		},
+		{
+			name:      "accept encoding",
+			requests:  []http.Header{{"Accept-Encoding": {"gzip"}}, {}, {"Accept-Encoding": {"gzip"}}},
+			wantCalls: 2,
+		},
+		{
+			name:      "set cookie",
+			requests:  []http.Header{{}, {}, {}},
+			response:  http.Header{"Set-Cookie": {"visitor=1"}},
+			wantCalls: 3,
+		},
+		{
+			name:      "vary outside the key",
+			requests:  []http.Header{{}, {}, {}},
+			response:  http.Header{"Vary": {"Accept-Encoding, X-Tenant"}},
+			wantCalls: 3,
+		},
+		{
+			name:      "vary inside the key",
+			requests:  []http.Header{{}, {}, {}},
+			response:  http.Header{"Vary": {"accept-encoding"}},
+			wantCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				for name, values := range tt.response {
+					w.Header()[name] = values
+				}
+				time.Sleep(200 * time.Millisecond)
+			}))
+			defer backend.Close()
+
+			cfg := &config.Config{Services: []config.ServiceConfig{
+				{Name: "catalogue", BasePath: "/api/products/*", Target: backend.URL, SkipAuth: true,
+					Coalesce: config.CoalesceConfig{Enabled: true}},
+			}}
+			proxy, err := NewProxyHandler(cfg, ProxyDeps{RateLimiter: rds.NewTokenBucketLimiter(1000, 1000)})
+			if err != nil {
+				t.Fatalf("NewProxyHandler() error = %v", err)
+			}
+
+			var wg sync.WaitGroup
+			for _, header := range tt.requests {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					r := httptest.NewRequest("GET", "/api/products/1", nil)
+					r.Header = header
+					proxy.ServeHTTP(httptest.NewRecorder(), r)
+				}()
+			}
+			wg.Wait()
+
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("backend calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/problem"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/server"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+)
+
+func (p *ProxyHandler) writeProblem(w http.ResponseWriter, r *http.Request, service string, pr problem.Problem) {
+	p.problems.Write(w, r, service, pr)
+}
+
+// serviceName returns the name of the service the request routes to, or "".
+func (p *ProxyHandler) serviceName(r *http.Request) string {
+	if service := p.routeService(r); service != nil {
+		return service.Name
+	}
+	return ""
+}
+
+// writeForbidden answers 403 with a machine-readable reason code.
+func (p *ProxyHandler) writeForbidden(w http.ResponseWriter, r *http.Request, service, reason string) {
+	p.writeProblem(w, r, service, problem.New(http.StatusForbidden, problem.CodeForbidden, "Access to this resource is forbidden").WithReason(reason))
+}
+
+// writeUnauthorized answers 401 with the failure reason only; the
+// verification error itself is logged by the caller.
+func (p *ProxyHandler) writeUnauthorized(w http.ResponseWriter, r *http.Request, service *server.ServiceConfig, reason string) {
+	if service.Auth != config.AuthModeAPIKey {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	}
+	p.writeProblem(w, r, service.Name, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "Authentication failed").WithReason(reason))
+}
+
+// writeUpstreamError distinguishes backend timeouts from other failures.
+func (p *ProxyHandler) writeUpstreamError(w http.ResponseWriter, r *http.Request, service string, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		p.writeProblem(w, r, service, problem.New(http.StatusRequestEntityTooLarge, problem.CodePayloadTooLarge, "The request body is too large"))
+		return
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		p.writeProblem(w, r, service, problem.New(http.StatusGatewayTimeout, problem.CodeGatewayTimeout, "The upstream service did not respond in time"))
+		return
+	}
+	p.writeProblem(w, r, service, problem.New(http.StatusBadGateway, problem.CodeBadGateway, "The upstream service is unavailable"))
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/auth"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/transform"
+)
+
+// claimVar formats claims for header templates the way claim headers are.
+func claimVar(claims auth.Claims) func(string) (string, bool) {
+	return func(path string) (string, bool) {
+		value := claims.Lookup(path)
+		if value == nil {
+			return "", false
+		}
+		return claimHeaderValue(value), true
+	}
+}
+
+// headerRulesWriter applies the response header rules of a service just
+// before the headers are sent, so backend, cached and gateway error
+// responses are all rewritten.
+type headerRulesWriter struct {
+	http.ResponseWriter
+	apply       func(http.Header)
+	wroteHeader bool
+}
+
+func (hw *headerRulesWriter) WriteHeader(status int) {
+	if !hw.wroteHeader && status >= http.StatusOK {
+		hw.wroteHeader = true
+		hw.apply(hw.Header())
+	}
+	hw.ResponseWriter.WriteHeader(status)
+}
+
+func (hw *headerRulesWriter) Write(b []byte) (int, error) {
+	if !hw.wroteHeader {
+		hw.WriteHeader(http.StatusOK)
+	}
+	return hw.ResponseWriter.Write(b)
+}
+
+func (hw *headerRulesWriter) Flush() {
+	if !hw.wroteHeader {
+		hw.WriteHeader(http.StatusOK)
+	}
+	http.NewResponseController(hw.ResponseWriter).Flush()
+}
+
+func (hw *headerRulesWriter) Unwrap() http.ResponseWriter {
+	return hw.ResponseWriter
+}
+
+// wrapResponseHeaders wraps w so that the response header rules of service
+// run. vars.Claim may be filled in later, once the request is authenticated.
+func (p *ProxyHandler) wrapResponseHeaders(w http.ResponseWriter, r *http.Request, service string, vars *transform.Vars) http.ResponseWriter {
+	if !p.headers.HasResponseRules(service) {
+		return w
+	}
+	method, path := r.Method, r.URL.Path
+	return &headerRulesWriter{
+		ResponseWriter: w,
+		apply: func(header http.Header) {
+			p.headers.ApplyResponse(service, method, path, header, vars)
+		},
+	}
+}
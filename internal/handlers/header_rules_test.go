@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/transform"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+	rds "github.com/mtsgn/mtsgn-system-gateway-svc/pkg/redis"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/utils"
+)
+
+func TestHeaderRules(t *testing.T) {
+	var forwarded http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Clone()
+		w.Header().Set("Server", "legacy/1.0")
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{Services: []config.ServiceConfig{{
+		Name: "legacy", BasePath: "/api/legacy/*", Target: backend.URL, SkipAuth: true,
+		Headers: config.HeaderRulesConfig{
+			Request:  []config.HeaderRule{{Set: map[string]string{"x-origin-request": "${request_id}"}}},
+			Response: []config.HeaderRule{{Remove: []string{"server"}, Set: map[string]string{"x-served-by": "gateway"}}},
+		},
+	}}}
+	headers, err := transform.NewHeaders(cfg.Services)
+	if err != nil {
+		t.Fatalf("NewHeaders() error = %v", err)
+	}
+	proxy, err := NewProxyHandler(cfg, ProxyDeps{RateLimiter: rds.NewTokenBucketLimiter(100, 100), Headers: headers})
+	if err != nil {
+		t.Fatalf("NewProxyHandler() error = %v", err)
+	}
+
+	r := httptest.NewRequest("GET", "/api/legacy/items", nil)
+	r = r.WithContext(utils.WithRequestID(r.Context(), "req-42"))
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if got := forwarded.Get("X-Origin-Request"); got != "req-42" {
+		t.Errorf("backend X-Origin-Request = %q, want req-42", got)
+	}
+	if w.Header().Get("Server") != "" || w.Header().Get("X-Served-By") != "gateway" {
+		t.Errorf("response headers = %v, want Server removed and X-Served-By set", w.Header())
+	}
+}
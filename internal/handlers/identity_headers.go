@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/auth"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+)
+
+// defaultClaimHeaders is the mapping used when auth.claim_headers is empty.
+var defaultClaimHeaders = []config.ClaimHeader{
+	{Claim: "userId", Header: "X-User-ID"},
+	{Claim: "isAdmin", Header: "X-Is-Admin"},
+	{Claim: "iat", Header: "X-Issued-At"},
+	{Claim: "sessionId", Header: "X-Session-ID"},
+	{Claim: "customClaims", Header: "X-Custom-Claims"},
+	{Claim: "exp", Header: "X-Exp"},
+}
+
+// defaultIntrospectionHeaders is used for oauth2_introspection services when
+// auth.introspection.claim_headers is empty.
+var defaultIntrospectionHeaders = []config.ClaimHeader{
+	{Claim: "sub", Header: "X-User-ID"},
+	{Claim: "client_id", Header: "X-Client-ID"},
+	{Claim: "scope", Header: "X-Scopes"},
+	{Claim: "username", Header: "X-Username"},
+}
+
+// newClaimHeaders resolves the claim mapping of every service and the set of
+// headers clients may never send themselves.
+func newClaimHeaders(cfg *config.Config) (map[string][]config.ClaimHeader, []string) {
+	global := cfg.Auth.ClaimHeaders
+	if len(global) == 0 {
+		global = defaultClaimHeaders
+	}
+
+	introspection := cfg.Auth.Introspection.ClaimHeaders
+	if len(introspection) == 0 {
+		introspection = defaultIntrospectionHeaders
+	}
+
+	reserved := make(map[string]struct{})
+	reserved["X-Auth-State"] = struct{}{}
+	for _, header := range cfg.Auth.ReservedHeaders {
+		reserved[http.CanonicalHeaderKey(header)] = struct{}{}
+	}
+	for _, mapping := range slices.Concat(defaultClaimHeaders, apiKeyClaimHeaders, introspection) {
+		reserved[http.CanonicalHeaderKey(mapping.Header)] = struct{}{}
+	}
+
+	mappings := make(map[string][]config.ClaimHeader)
+	for _, service := range cfg.Services {
+		mapping := global
+		if service.TokenType == config.TokenTypeIntrospect {
+			mapping = introspection
+		}
+		if len(service.ClaimHeaders) > 0 {
+			mapping = service.ClaimHeaders
+		}
+		mappings[service.Name] = mapping
+		for _, m := range mapping {
+			reserved[http.CanonicalHeaderKey(m.Header)] = struct{}{}
+		}
+	}
+	for _, m := range global {
+		reserved[http.CanonicalHeaderKey(m.Header)] = struct{}{}
+	}
+
+	headers := make([]string, 0, len(reserved))
+	for header := range reserved {
+		headers = append(headers, header)
+	}
+	return mappings, headers
+}
+
+// stripReservedHeaders removes identity headers a client may have forged.
+func (p *ProxyHandler) stripReservedHeaders(r *http.Request) {
+	for _, header := range p.reservedHeaders {
+		r.Header.Del(header)
+	}
+}
+
+// setClaimHeaders forwards the mapped claims of a verified token.
+func (p *ProxyHandler) setClaimHeaders(r *http.Request, serviceName string, claims auth.Claims) {
+	for _, mapping := range p.claimHeaders[serviceName] {
+		value := claims.Lookup(mapping.Claim)
+		if value == nil {
+			continue
+		}
+		r.Header.Set(mapping.Header, claimHeaderValue(value))
+	}
+}
+
+// claimHeaderValue writes strings as they are, whole numbers without an
+// exponent and objects or lists as JSON.
+func claimHeaderValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}, []interface{}:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return string(encoded)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/auth"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+)
+
+func TestIdentityHeaders(t *testing.T) {
+	cfg := &config.Config{
+		Auth: config.AuthConfig{ReservedHeaders: []string{"x-tenant-id"}},
+		Services: []config.ServiceConfig{
+			{Name: "users"},
+			{Name: "billing", ClaimHeaders: []config.ClaimHeader{{Claim: "customClaims.account", Header: "X-Account"}}},
+		},
+	}
+	claimHeaders, reservedHeaders := newClaimHeaders(cfg)
+	p := &ProxyHandler{claimHeaders: claimHeaders, reservedHeaders: reservedHeaders}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, header := range []string{"X-Is-Admin", "X-User-ID", "X-Tenant-ID", "X-Account"} {
+		r.Header.Set(header, "forged")
+	}
+	r.Header.Set("X-Other", "kept")
+	p.stripReservedHeaders(r)
+	for _, header := range []string{"X-Is-Admin", "X-User-ID", "X-Tenant-ID", "X-Account"} {
+		if value := r.Header.Get(header); value != "" {
+			t.Errorf("%s = %q, want it stripped", header, value)
+		}
+	}
+	if r.Header.Get("X-Other") != "kept" {
+		t.Error("unrelated header was stripped")
+	}
+
+	claims := auth.Claims{
+		"userId":       "u-1",
+		"isAdmin":      false,
+		"iat":          float64(1767225600),
+		"customClaims": map[string]interface{}{"account": "a-9", "tier": "gold"},
+	}
+	p.setClaimHeaders(r, "users", claims)
+	want := map[string]string{
+		"X-User-ID":       "u-1",
+		"X-Is-Admin":      "false",
+		"X-Issued-At":     "1767225600",
+		"X-Custom-Claims": `{"account":"a-9","tier":"gold"}`,
+		"X-Session-ID":    "",
+	}
+	for header, value := range want {
+		if got := r.Header.Get(header); got != value {
+			t.Errorf("%s = %q, want %q", header, got, value)
+		}
+	}
+
+	billing := httptest.NewRequest("GET", "/", nil)
+	p.setClaimHeaders(billing, "billing", claims)
+	if got := billing.Header.Get("X-Account"); got != "a-9" {
+		t.Errorf("X-Account = %q, want a-9", got)
+	}
+	if got := billing.Header.Get("X-User-ID"); got != "" {
+		t.Errorf("X-User-ID = %q, want the service mapping to replace the default", got)
+	}
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/middleware"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/utils"
+)
+
+// ==================== IP Filter Middleware ====================
+func (p *ProxyHandler) ipFilterMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if p.ipFilter == nil {
+			next(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		clientIP := utils.GetClientIP(r)
+		serviceName := ""
+		if service := p.routeService(r); service != nil {
+			serviceName = service.Name
+		}
+
+		if reason := p.ipFilter.Check(clientIP, serviceName); reason != "" {
+			middleware.RecordIPFilterRejection(serviceName, reason)
+			p.logger.Info(ctx, "Request blocked by IP filter", "client_ip", clientIP, "path", r.URL.Path, "service", serviceName, "reason", reason)
+			p.writeForbidden(w, r, serviceName, reason)
+			return
+		}
+
+		next(w, r)
+	}
+}
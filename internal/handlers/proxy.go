@@ -2,41 +2,122 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/mtsgn/mtsgn-mtsgn-system-common-svc/common/logger"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/auth"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/cache"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/middleware"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/problem"
 	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/server"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/transform"
 	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/ipfilter"
 	rds "github.com/mtsgn/mtsgn-system-gateway-svc/pkg/redis"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/utils"
 )
 
 type ProxyHandler struct {
 	config       *config.Config
-	logger       logger.ZeroLogger
+	logger       utils.ContextLogger
 	httpClient   *http.Client
 	router       *server.PriorityRouter
 	rateLimiter  rds.RateLimiter
 	redisLimiter *rds.RedisSlidingWindowLimiter
+	policies     map[string]*rateLimitPolicy
+	ipFilter     *ipfilter.Filter
+	banStore     rds.BanStore
+	notBanned    *banLookupCache
+	verifiers    auth.Verifiers
+	validators   map[string]auth.Validator
+	access       map[string]*auth.AccessPolicy
+	revocations  *auth.RevocationChecker
+	apiKeys      *auth.APIKeyAuthenticator
+	// reservedHeaders are stripped from inbound requests before auth.
+	reservedHeaders []string
+	claimHeaders    map[string][]config.ClaimHeader
+	problems        *problem.Writer
+	cache           rds.ResponseCache
+	cachePolicies   map[string]*cache.Policy
+	coalescers      map[string]*coalescer
+	headers         *transform.Headers
+	paths           *transform.Paths
+	// revalidating holds the cache keys being refreshed in the background.
+	revalidating sync.Map
+}
+
+// ProxyDeps holds the collaborators of a ProxyHandler. RateLimiter is
+// required; any other nil field turns off the feature that uses it.
+type ProxyDeps struct {
+	RateLimiter   rds.RateLimiter
+	RedisLimiter  *rds.RedisSlidingWindowLimiter
+	IPFilter      *ipfilter.Filter
+	BanStore      rds.BanStore
+	Verifiers     auth.Verifiers
+	Revocations   *auth.RevocationChecker
+	APIKeys       *auth.APIKeyAuthenticator
+	ResponseCache rds.ResponseCache
+	Headers       *transform.Headers
+	Paths         *transform.Paths
+	Problems      *problem.Writer
+	Logger        logger.ZeroLogger
 }
 
-func NewProxyHandler(cfg *config.Config, rateLimiter rds.RateLimiter, redisLimiter *rds.RedisSlidingWindowLimiter, logger logger.ZeroLogger) *ProxyHandler {
+func NewProxyHandler(cfg *config.Config, deps ProxyDeps) (*ProxyHandler, error) {
+	logger := deps.Logger
+	policies, err := newRateLimitPolicies(cfg.RateLimit, deps.RateLimiter, deps.RedisLimiter, logger)
+	if err != nil {
+		return nil, err
+	}
+
 	router := server.NewPriorityRouter()
+	validators := make(map[string]auth.Validator)
+	access := make(map[string]*auth.AccessPolicy)
+	cachePolicies := make(map[string]*cache.Policy)
+	coalescers := make(map[string]*coalescer)
+	adminShared := cfg.Admin.Port <= 0 || cfg.Admin.Port == cfg.Server.Port
 	for _, service := range cfg.Services {
+		if segments := utils.SplitPath(service.BasePath); adminShared && len(segments) > 0 && segments[0] == "admin" {
+			return nil, fmt.Errorf("service %s: base path %s is reserved for the admin API", service.Name, service.BasePath)
+		}
+		if _, ok := policies[service.RateLimitPolicy]; service.RateLimitPolicy != "" && !ok {
+			return nil, fmt.Errorf("service %s: unknown rate limit policy %q", service.Name, service.RateLimitPolicy)
+		}
+		validators[service.Name] = auth.NewValidator(cfg.Auth.Validation, service.TokenValidation)
+		access[service.Name] = auth.NewAccessPolicy(service.Access)
+		cachePolicies[service.Name] = cache.NewPolicy(service.Cache, cfg.Cache)
+		coalescers[service.Name] = newCoalescer(service.Coalesce)
 		serviceConfig := &server.ServiceConfig{
-			Name:     service.Name,
-			Target:   service.Target,
-			Methods:  service.Methods,
-			SkipAuth: service.SkipAuth,
+			Name:            service.Name,
+			Target:          service.Target,
+			Methods:         service.Methods,
+			SkipAuth:        service.SkipAuth,
+			Auth:            service.Auth,
+			InvalidToken:    service.InvalidToken,
+			RateLimitPolicy: service.RateLimitPolicy,
+			RateLimitKey:    service.RateLimitKey,
+			TokenType:       service.TokenType,
 		}
 		router.AddRoute(service.BasePath, serviceConfig)
 		logger.Info(context.Background(), "Registered service", "base_path", service.BasePath, "target", serviceConfig.Target, "name", serviceConfig.Name)
 	}
 
+	claimHeaders, reservedHeaders := newClaimHeaders(cfg)
+
 	timeout := 30
 	if cfg.Server.Timeout > 0 {
 		timeout = cfg.Server.Timeout
@@ -46,15 +127,35 @@ func NewProxyHandler(cfg *config.Config, rateLimiter rds.RateLimiter, redisLimit
 		httpClient: &http.Client{
 			Timeout: time.Duration(timeout) * time.Second,
 		},
-		router:       router,
-		rateLimiter:  rateLimiter,
-		redisLimiter: redisLimiter,
-		logger:       logger,
-	}
+		router:          router,
+		rateLimiter:     deps.RateLimiter,
+		redisLimiter:    deps.RedisLimiter,
+		policies:        policies,
+		ipFilter:        deps.IPFilter,
+		banStore:        deps.BanStore,
+		notBanned:       newBanLookupCache(cfg.Ban),
+		verifiers:       deps.Verifiers,
+		validators:      validators,
+		access:          access,
+		claimHeaders:    claimHeaders,
+		reservedHeaders: reservedHeaders,
+		problems:        deps.Problems,
+		revocations:     deps.Revocations,
+		apiKeys:         deps.APIKeys,
+		cache:           deps.ResponseCache,
+		cachePolicies:   cachePolicies,
+		coalescers:      coalescers,
+		headers:         deps.Headers,
+		paths:           deps.Paths,
+		logger:          utils.NewContextLogger(logger),
+	}, nil
 }
 
 func (p *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	handler := p.rateLimitMiddleware(http.HandlerFunc(p.forwardRequest))
+	p.stripReservedHeaders(r)
+	match := p.routeRequest(r)
+	r = r.WithContext(context.WithValue(r.Context(), routeMatchKey{}, match))
+	handler := p.ipFilterMiddleware(p.banMiddleware(p.rateLimitMiddleware(http.HandlerFunc(p.forwardRequest))))
 	handler(w, r)
 }
 
@@ -71,128 +172,110 @@ func (p *ProxyHandler) isMethodAllowed(method string, allowedMethods []string) b
 	return false
 }
 
-// func (p *ProxyHandler) routeRequest(w http.ResponseWriter, r *http.Request) {
-// 	// Find the best matching service
-// 	ctx := context.Background()
-// 	service := p.router.FindBestMatch(r.URL.Path)
-
-// 	if service == nil {
-// 		p.logger.Error(ctx, "No route found", "path", r.URL.Path)
-// 		http.NotFound(w, r)
-// 		return
-// 	}
-
-// 	// Check authorization
-// 	if err := p.authorizationMiddleware(w, r, p.config, service); err != nil {
-// 		p.logger.Error(ctx, "Authorization failed", "error", err)
-// 		http.Error(w, err.Error(), http.StatusUnauthorized)
-// 		return
-// 	}
-
-// 	// Check if the HTTP method is allowed
-// 	if !p.isMethodAllowed(r.Method, service.Methods) {
-// 		p.logger.Error(ctx, "Method not allowed", "path", r.URL.Path, "method", r.Method)
-// 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-// 		return
-// 	}
-
-// 	p.logger.Info(ctx, "Routing request", "path", r.URL.Path, "service", service.Name, "priority", service.Priority)
-
-// 	// Check service-specific rate limit if configured
-// 	// if service.RateLimit != nil && service.RateLimit.Enabled {
-// 	//     clientIP := getClientIP(r)
-// 	//     serviceKey := fmt.Sprintf("service:%s:%s", service.Name, clientIP)
-
-// 	//     allowed, err := g.rateLimiter.Allow(serviceKey)
-// 	//     if err != nil || !allowed {
-// 	//         g.logger.Error("Service rate limit exceeded",
-// 	//             zap.String("service", service.Name),
-// 	//             zap.String("client_ip", clientIP))
-
-// 	//         w.Header().Set("X-Service-RateLimit", "Exceeded")
-// 	//         http.Error(w, "Service rate limit exceeded", http.StatusTooManyRequests)
-// 	//         return
-// 	//     }
-// 	// }
-
-// 	// Proxy the request to the target service
-// 	target, err := url.Parse(service.Target)
-// 	if err != nil {
-// 		p.logger.Error(ctx, "Invalid target URL", "service", service.Name, "target", service.Target, "error", err)
-// 		http.Error(w, "Internal server error", http.StatusInternalServerError)
-// 		return
-// 	}
-
-// 	// Create reverse proxy
-// 	proxy := httputil.NewSingleHostReverseProxy(target)
-
-// 	// Modify request
-// 	originalDirector := proxy.Director
-// 	proxy.Director = func(req *http.Request) {
-// 		originalDirector(req)
-
-// 		// Add gateway headers
-// 		req.Header.Set("X-Forwarded-For", utils.GetClientIP(r))
-// 		req.Header.Set("X-Forwarded-Host", req.Host)
-// 		req.Header.Set("X-Forwarded-Proto", "http")
-// 		if r.TLS != nil {
-// 			req.Header.Set("X-Forwarded-Proto", "https")
-// 		}
-// 		req.Header.Set("X-Gateway-Service", service.Name)
-
-// 		p.logger.Debug(ctx, "Forwarding request", "to", target.String(), "path", req.URL.Path)
-// 	}
-
-// 	// Add error handling
-// 	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-// 		p.logger.Error(ctx, "Proxy error", "service", service.Name, "target", target.String(), "error", err)
-// 		http.Error(w, "Service unavailable", http.StatusBadGateway)
-// 	}
-
-// 	// Add response modification
-// 	proxy.ModifyResponse = func(resp *http.Response) error {
-// 		// Add gateway headers to response
-// 		resp.Header.Set("X-Gateway-Service", service.Name)
-// 		resp.Header.Set("X-Gateway-Request-ID", r.Header.Get("X-Request-ID"))
-
-// 		// Log response status
-// 		p.logger.Debug(ctx, "Service response", "service", service.Name, "status", resp.StatusCode, "content_type", resp.Header.Get("Content-Type"))
-// 		return nil
-// 	}
-
-// 	// Serve the request
-// 	proxy.ServeHTTP(w, r)
-// }
-
 func (p *ProxyHandler) forwardRequest(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
-	service := p.router.FindBestMatch(r.URL.Path)
-
-	if service == nil {
+	ctx := r.Context()
+	match := p.routeMatch(r)
+	if match == nil {
 		p.logger.Error(ctx, "No route found", "path", r.URL.Path)
-		http.NotFound(w, r)
+		p.writeProblem(w, r, "", problem.New(http.StatusNotFound, problem.CodeRouteNotFound, "No route matches the request path"))
 		return
 	}
+	service := match.Service
+
+	vars := &transform.Vars{ClientIP: utils.GetClientIP(r), RequestID: utils.GetRequestID(r)}
+	w = p.wrapResponseHeaders(w, r, service.Name, vars)
 
 	// Check authorization
-	if err := p.authorizationMiddleware(w, r, p.config, service); err != nil {
+	authStart := time.Now()
+	authCtx, authSpan := startAuthSpan(r.Context(), service)
+	claims, err := p.authorizationMiddleware(w, r.WithContext(authCtx), p.config, service)
+	endAuthSpan(authSpan, r, service, err)
+	middleware.ObserveLatency(ctx, "auth", time.Since(authStart))
+	if err != nil {
+		var denied *auth.AccessDeniedError
+		if errors.As(err, &denied) {
+			p.logger.Info(ctx, "Access denied", "path", r.URL.Path, "method", r.Method, "reason", denied.Reason)
+			middleware.RecordAccessDenied(service.Name, denied.Reason)
+			middleware.RecordAuthResult(service.Name, "denied")
+			p.writeForbidden(w, r, service.Name, denied.Reason)
+			return
+		}
+		if errors.Is(err, auth.ErrIntrospectionFailed) || errors.Is(err, auth.ErrAPIKeyStoreUnavailable) {
+			// The provider or key store is unavailable; the client is not
+			// at fault and must not be banned for it.
+			p.logger.Error(ctx, "Authentication backend unavailable", "error", err)
+			middleware.RecordAuthFailure(auth.FailureReason(err))
+			middleware.RecordAuthResult(service.Name, "failure")
+			p.writeProblem(w, r, service.Name, problem.New(http.StatusServiceUnavailable, problem.CodeServiceUnavailable, "Authentication service unavailable"))
+			return
+		}
+		reason := auth.FailureReason(err)
 		p.logger.Error(ctx, "Authorization failed", "error", err)
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		middleware.RecordAuthFailure(reason)
+		middleware.RecordAuthResult(service.Name, "failure")
+		p.recordClientFailure(r.Context(), utils.GetClientIP(r), failureAuth)
+		p.writeUnauthorized(w, r, service, reason)
 		return
 	}
 
+	middleware.RecordAuthResult(service.Name, authResult(r, service))
+	vars.Claim = claimVar(claims)
+
 	// Check if the HTTP method is allowed
 	if !p.isMethodAllowed(r.Method, service.Methods) {
 		p.logger.Error(ctx, "Method not allowed", "path", r.URL.Path, "method", r.Method)
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		w.Header().Set("Allow", strings.Join(service.Methods, ", "))
+		p.writeProblem(w, r, service.Name, problem.New(http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "Method not allowed"))
 		return
 	}
+	p.headers.ApplyRequest(service.Name, r.Method, r.URL.Path, r.Header, vars)
+	if rewrite := p.paths.For(service.Name); rewrite != nil {
+		r = rewritePath(r, rewrite.Apply(r.URL.EscapedPath(), match.Params))
+	}
+
 	// Parse target URL
 	target, err := url.Parse(service.Target)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid target URL: %v", err), http.StatusInternalServerError)
+		p.logger.Error(ctx, "Invalid target URL", "service", service.Name, "target", service.Target, "error", err)
+		p.writeProblem(w, r, service.Name, problem.New(http.StatusInternalServerError, problem.CodeInternal, "The gateway is misconfigured for this route"))
+		return
+	}
+
+	if policy := p.cachePolicies[service.Name]; policy != nil && p.cache != nil {
+		p.serveCached(w, r, service, policy, target)
+		return
+	}
+
+	resp, err := p.forward(r, service, target)
+	if err != nil {
+		p.writeRoundTripError(w, r, service, err)
 		return
 	}
+	defer resp.Body.Close()
+	p.writeResponse(w, r, service, resp.StatusCode, resp.Header, resp.Body)
+}
+
+var errUpstreamRequest = errors.New("invalid upstream request")
+
+// rewritePath returns a copy of r forwarding to the escaped path, so that
+// encoded characters such as %2F reach the backend as sent. The original
+// request keeps its URL for logging.
+func rewritePath(r *http.Request, escaped string) *http.Request {
+	u := *r.URL
+	path, err := url.PathUnescape(escaped)
+	if err != nil {
+		path, escaped = escaped, ""
+	}
+	u.Path, u.RawPath = path, escaped
+	r = r.WithContext(r.Context())
+	r.URL = &u
+	return r
+}
+
+// roundTrip forwards r to the service backend at target. The upstream span
+// ends when the response body is closed.
+func (p *ProxyHandler) roundTrip(r *http.Request, service *server.ServiceConfig, target *url.URL) (*http.Response, error) {
+	ctx := r.Context()
 
 	// Create new request
 	proxyURL := *r.URL
@@ -200,10 +283,22 @@ func (p *ProxyHandler) forwardRequest(w http.ResponseWriter, r *http.Request) {
 	proxyURL.Host = target.Host
 
 	// Create the request
-	req, err := http.NewRequest(r.Method, proxyURL.String(), r.Body)
+	upstreamCtx, upstreamSpan := startUpstreamSpan(ctx, service, r.Method, target.Host)
+	// The transport asks for a connection once per attempt, and resends
+	// idempotent requests that fail on a stale keep-alive connection.
+	attempted := false
+	upstreamCtx = httptrace.WithClientTrace(upstreamCtx, &httptrace.ClientTrace{
+		GetConn: func(string) {
+			if attempted {
+				middleware.RecordBackendRetry(service.Name)
+			}
+			attempted = true
+		},
+	})
+	req, err := http.NewRequestWithContext(upstreamCtx, r.Method, proxyURL.String(), r.Body)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error creating request: %v", err), http.StatusInternalServerError)
-		return
+		upstreamSpan.End()
+		return nil, fmt.Errorf("%w: %v", errUpstreamRequest, err)
 	}
 
 	// Copy headers
@@ -212,28 +307,67 @@ func (p *ProxyHandler) forwardRequest(w http.ResponseWriter, r *http.Request) {
 			req.Header.Add(key, value)
 		}
 	}
+	otel.GetTextMapPropagator().Inject(upstreamCtx, propagation.HeaderCarrier(req.Header))
 
 	// Make the request
+	start := time.Now()
 	resp, err := p.httpClient.Do(req)
+	middleware.SetUpstream(ctx, target.Host, time.Since(start))
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error forwarding request: %v", err), http.StatusBadGateway)
+		middleware.RecordBackendRequest(service.Name, time.Since(start).Seconds(), 0)
+		upstreamSpan.RecordError(err)
+		upstreamSpan.SetStatus(codes.Error, "upstream request failed")
+		upstreamSpan.End()
+		return nil, err
+	}
+	middleware.RecordBackendRequest(service.Name, time.Since(start).Seconds(), resp.StatusCode)
+	upstreamSpan.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		upstreamSpan.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+	resp.Body = &spanBody{ReadCloser: resp.Body, span: upstreamSpan}
+	return resp, nil
+}
+
+func (p *ProxyHandler) writeRoundTripError(w http.ResponseWriter, r *http.Request, service *server.ServiceConfig, err error) {
+	if errors.Is(err, errUpstreamRequest) {
+		p.logger.Error(r.Context(), "Error creating request", "service", service.Name, "error", err)
+		p.writeProblem(w, r, service.Name, problem.New(http.StatusInternalServerError, problem.CodeInternal, "The request could not be forwarded"))
 		return
 	}
-	defer resp.Body.Close()
+	p.logger.Error(r.Context(), "Error forwarding request", "service", service.Name, "target", service.Target, "error", err)
+	p.writeUpstreamError(w, r, service.Name, err)
+}
 
-	// Copy response headers
-	for key, values := range resp.Header {
+// writeResponse copies a backend response to the client.
+func (p *ProxyHandler) writeResponse(w http.ResponseWriter, r *http.Request, service *server.ServiceConfig, status int, header http.Header, body io.Reader) {
+	// Copy response headers, keeping the request ID the gateway already set
+	for key, values := range header {
+		if key == utils.RequestIDHeader {
+			continue
+		}
 		for _, value := range values {
 			w.Header().Add(key, value)
 		}
 	}
 
 	// Set status code
-	w.WriteHeader(resp.StatusCode)
+	w.WriteHeader(status)
 
 	// Copy response body
-	_, err = io.Copy(w, resp.Body)
-	if err != nil {
-		fmt.Printf("Error copying response body: %v\n", err)
+	if _, err := io.Copy(w, body); err != nil {
+		p.logger.Error(r.Context(), "Error copying response body", "service", service.Name, "error", err)
 	}
 }
+
+// spanBody ends the upstream span once the response has been read.
+type spanBody struct {
+	io.ReadCloser
+	span trace.Span
+}
+
+func (b *spanBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.span.End()
+	return err
+}
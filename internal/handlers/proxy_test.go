@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/middleware"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/problem"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/transform"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+	rds "github.com/mtsgn/mtsgn-system-gateway-svc/pkg/redis"
+)
+
+func TestForwardRequest_RewritesPath(t *testing.T) {
+	var forwarded string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.URL.RequestURI()
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{Services: []config.ServiceConfig{{
+		Name: "users", BasePath: "/api/v1/users/*", Target: backend.URL, SkipAuth: true,
+		Rewrite: config.PathRewriteConfig{StripPrefix: "/api/v1/users", AddPrefix: "/internal"},
+	}}}
+	paths, err := transform.NewPaths(cfg.Services)
+	if err != nil {
+		t.Fatalf("NewPaths() error = %v", err)
+	}
+	proxy, err := NewProxyHandler(cfg, ProxyDeps{RateLimiter: rds.NewTokenBucketLimiter(100, 100), Paths: paths})
+	if err != nil {
+		t.Fatalf("NewProxyHandler() error = %v", err)
+	}
+
+	r := httptest.NewRequest("GET", "/api/v1/users/42?fields=name", nil)
+	proxy.ServeHTTP(httptest.NewRecorder(), r)
+
+	if forwarded != "/internal/42?fields=name" {
+		t.Errorf("backend received %q, want /internal/42?fields=name", forwarded)
+	}
+	if r.URL.Path != "/api/v1/users/42" {
+		t.Errorf("client request path changed to %q", r.URL.Path)
+	}
+
+	proxy.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/v1/users/files/a%2Fb", nil))
+	if forwarded != "/internal/files/a%2Fb" {
+		t.Errorf("backend received %q, want the encoded slash kept in /internal/files/a%%2Fb", forwarded)
+	}
+}
+
+func TestForwardRequest_OversizedDecodedBody(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{Services: []config.ServiceConfig{{
+		Name: "users", BasePath: "/users/*", Target: backend.URL, SkipAuth: true,
+	}}}
+	proxy, err := NewProxyHandler(cfg, ProxyDeps{RateLimiter: rds.NewTokenBucketLimiter(100, 100)})
+	if err != nil {
+		t.Fatalf("NewProxyHandler() error = %v", err)
+	}
+	compressor := middleware.NewCompressor(config.CompressionConfig{DecompressRequests: true, MaxRequestBytes: 1024}, nil)
+	handler := middleware.Compression(proxy, compressor)
+
+	var body bytes.Buffer
+	zw, _ := zstd.NewWriter(&body)
+	zw.Write(bytes.Repeat([]byte("a"), 1<<20))
+	zw.Close()
+	r := httptest.NewRequest("POST", "/users/1", &body)
+	r.Header.Set("Content-Encoding", "zstd")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusRequestEntityTooLarge || !strings.Contains(w.Body.String(), problem.CodePayloadTooLarge) {
+		t.Errorf("status = %d, body %q, want 413 payload_too_large", w.Code, w.Body.String())
+	}
+}
+
+// A backend that drops a keep-alive connection without answering makes the
+// transport resend the request on a new one.
+func TestForwardRequest_RecordsRetries(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for first := true; ; first = false {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			reader := bufio.NewReader(conn)
+			http.ReadRequest(reader)
+			io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+			if first {
+				http.ReadRequest(reader)
+			}
+			conn.Close()
+		}
+	}()
+
+	cfg := &config.Config{Services: []config.ServiceConfig{{
+		Name: "retried", BasePath: "/retried/*", Target: "http://" + listener.Addr().String(), SkipAuth: true,
+	}}}
+	proxy, err := NewProxyHandler(cfg, ProxyDeps{RateLimiter: rds.NewTokenBucketLimiter(100, 100)})
+	if err != nil {
+		t.Fatalf("NewProxyHandler() error = %v", err)
+	}
+
+	retried := map[string]string{"backend": "retried"}
+	before := counterValue(t, "backend_retries_total", retried)
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest("GET", "/retried/1", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200", i, w.Code)
+		}
+	}
+	if got := counterValue(t, "backend_retries_total", retried) - before; got != 1 {
+		t.Errorf("backend_retries_total grew by %v, want 1", got)
+	}
+}
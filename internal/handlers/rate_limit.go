@@ -4,10 +4,126 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/mtsgn/mtsgn-mtsgn-system-common-svc/common/logger"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/middleware"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/problem"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+	rds "github.com/mtsgn/mtsgn-system-gateway-svc/pkg/redis"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/tracing"
 	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/utils"
 )
 
+const defaultRateLimitPolicy = "default"
+
+type rateLimitPolicy struct {
+	name    string
+	mode    string
+	limiter rds.RateLimiter
+}
+
+func (p *rateLimitPolicy) shadow() bool {
+	return p.mode == config.RateLimitModeShadow
+}
+
+// newRateLimitPolicies builds one limiter per configured policy. The global
+// limiter is registered under the default policy name, which configured
+// policies may not use.
+func newRateLimitPolicies(cfg config.RateLimitConfig, rateLimiter rds.RateLimiter, redisLimiter *rds.RedisSlidingWindowLimiter, logger logger.ZeroLogger) (map[string]*rateLimitPolicy, error) {
+	policies := map[string]*rateLimitPolicy{
+		defaultRateLimitPolicy: {
+			name:    defaultRateLimitPolicy,
+			mode:    normalizeRateLimitMode(cfg.Mode),
+			limiter: rateLimiter,
+		},
+	}
+
+	for _, policy := range cfg.Policies {
+		if policy.Name == "" {
+			return nil, fmt.Errorf("rate limit policy without a name")
+		}
+		if _, exists := policies[policy.Name]; exists {
+			if policy.Name == defaultRateLimitPolicy {
+				return nil, fmt.Errorf("rate limit policy name %q is reserved for the global limit", policy.Name)
+			}
+			return nil, fmt.Errorf("duplicate rate limit policy %q", policy.Name)
+		}
+
+		var limiter rds.RateLimiter
+		if redisLimiter != nil {
+			limit, window := slidingWindowFor(policy.RequestsPerSecond, policy.Burst)
+			limiter = redisLimiter.WithLimit(policy.Name, limit, window)
+		} else {
+			limiter = rds.NewTokenBucketLimiter(policy.RequestsPerSecond, policy.Burst)
+		}
+		policies[policy.Name] = &rateLimitPolicy{
+			name:    policy.Name,
+			mode:    normalizeRateLimitMode(policy.Mode),
+			limiter: limiter,
+		}
+		logger.Info(context.Background(), "Registered rate limit policy", "name", policy.Name, "requests_per_second", policy.RequestsPerSecond, "mode", policies[policy.Name].mode)
+	}
+	return policies, nil
+}
+
+// slidingWindowFor sizes a sliding window to match a token bucket: burst
+// requests per window of burst/rps seconds allows bursts of up to burst and
+// averages rps. Without a burst the window is one second.
+func slidingWindowFor(rps, burst int) (int, time.Duration) {
+	if rps <= 0 || burst <= 0 {
+		return rps, time.Second
+	}
+	return burst, max(time.Duration(burst)*time.Second/time.Duration(rps), time.Millisecond)
+}
+
+// hasRateLimitPolicy reports whether name is a configured policy or the
+// global one.
+func hasRateLimitPolicy(cfg config.RateLimitConfig, name string) bool {
+	if name == defaultRateLimitPolicy {
+		return true
+	}
+	for _, policy := range cfg.Policies {
+		if policy.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeRateLimitMode(mode string) string {
+	if strings.EqualFold(mode, config.RateLimitModeShadow) {
+		return config.RateLimitModeShadow
+	}
+	return config.RateLimitModeEnforce
+}
+
+// rateLimitPoliciesFor returns the policy enforced for a request and the
+// shadow policies evaluated beside it. Names are applied in order, global
+// first: an enforcing policy replaces the enforced one, while a shadow policy
+// never does, so trialling a limit keeps the limit it would replace. Policy
+// names are checked by NewProxyHandler.
+func (p *ProxyHandler) rateLimitPoliciesFor(names ...string) (*rateLimitPolicy, []*rateLimitPolicy) {
+	enforced := p.policies[defaultRateLimitPolicy]
+	var shadows []*rateLimitPolicy
+	for _, name := range names {
+		policy, ok := p.policies[name]
+		if !ok || policy == enforced {
+			continue
+		}
+		if policy.shadow() {
+			shadows = append(shadows, policy)
+		} else {
+			enforced = policy
+		}
+	}
+	return enforced, shadows
+}
+
 // ==================== Rate Limiting Middleware ====================
 func (p *ProxyHandler) rateLimitMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -16,24 +132,81 @@ func (p *ProxyHandler) rateLimitMiddleware(next http.HandlerFunc) http.HandlerFu
 		path := r.URL.Path
 		rateLimitKey := fmt.Sprintf("%s:%s", clientIP, path)
 
-		allowed, err := p.rateLimiter.Allow(ctx, rateLimitKey)
-		if err != nil {
-			p.logger.Error(ctx, "Rate limiter error", "client_ip", clientIP, "path", path, "error", err)
+		service := p.routeService(r)
+		serviceName := ""
+		if service != nil {
+			serviceName = service.Name
+		}
+		var names []string
+		if service != nil {
+			names = append(names, service.RateLimitPolicy)
+		}
+
+		// A valid API key may carry its own plan and key the limit by consumer.
+		// Invalid keys fall back to the client IP and are rejected later.
+		if service != nil && service.Auth == config.AuthModeAPIKey && !service.SkipAuth {
+			var consumer rds.APIKey
+			var err error
+			if r, consumer, err = p.resolveConsumer(r); err == nil {
+				if consumer.Plan != "" {
+					if _, ok := p.policies[consumer.Plan]; ok {
+						names = append(names, consumer.Plan)
+					} else {
+						// Plans are checked when keys are created, so the policy was
+						// removed from the config since.
+						p.logger.Error(ctx, "API key plan has no rate limit policy, ignoring the plan", "owner", consumer.Owner, "plan", consumer.Plan)
+					}
+				}
+				if service.RateLimitKey == config.RateLimitKeyConsumer {
+					rateLimitKey = fmt.Sprintf("consumer:%s:%s", consumer.Owner, path)
+				}
+			}
+		}
+
+		policy, shadows := p.rateLimitPoliciesFor(names...)
+		for _, shadow := range shadows {
+			p.allowRequest(ctx, shadow, rateLimitKey, serviceName, clientIP)
+		}
+		if p.allowRequest(ctx, policy, rateLimitKey, serviceName, clientIP) {
 			next(w, r)
 			return
 		}
 
-		// p.logger.Info(ctx, "Rate limit check", "client_ip", clientIP, "path", path, "allowed", allowed)
+		w.Header().Set("X-RateLimit-Limit", "Exceeded")
+		w.Header().Set("Retry-After", "1")
+		p.logger.Error(ctx, "Rate limit exceeded", "client_ip", clientIP, "path", path, "policy", policy.name)
+		middleware.RecordRateLimitHit(policy.name, serviceName)
+		p.recordClientFailure(ctx, clientIP, failureRateLimit)
 
-		if !allowed {
-			w.Header().Set("X-RateLimit-Limit", "Exceeded")
-			w.Header().Set("Retry-After", "1")
-			p.logger.Error(ctx, "Rate limit exceeded", "client_ip", clientIP, "path", path)
+		p.writeProblem(w, r, serviceName, problem.New(http.StatusTooManyRequests, problem.CodeRateLimited, "Rate limit exceeded"))
+	}
+}
 
-			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
-			return
-		}
+// allowRequest checks key against policy. Shadow policies only record their
+// would-be rejections, and limiter errors let the request through.
+func (p *ProxyHandler) allowRequest(ctx context.Context, policy *rateLimitPolicy, key, serviceName, clientIP string) bool {
+	spanCtx, span := tracing.Tracer().Start(ctx, "rate_limit", trace.WithAttributes(
+		attrService.String(serviceName),
+		attribute.String("gateway.rate_limit.policy", policy.name),
+		attribute.String("gateway.rate_limit.mode", policy.mode),
+	))
+	limitStart := time.Now()
+	allowed, err := policy.limiter.Allow(spanCtx, key)
+	middleware.ObserveLatency(ctx, "rate_limit", time.Since(limitStart))
+	span.SetAttributes(attribute.Bool("gateway.rate_limit.allowed", allowed))
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+	if err != nil {
+		p.logger.Error(ctx, "Rate limiter error", "client_ip", clientIP, "key", key, "policy", policy.name, "error", err)
+		return true
+	}
 
-		next(w, r)
+	if !allowed && policy.shadow() {
+		middleware.RecordRateLimitShadowHit(policy.name, serviceName)
+		p.logger.Info(ctx, "Rate limit would be exceeded (shadow mode)", "client_ip", clientIP, "key", key, "policy", policy.name, "service", serviceName)
+		return true
 	}
+	return allowed
 }
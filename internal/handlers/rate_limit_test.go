@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+	rds "github.com/mtsgn/mtsgn-system-gateway-svc/pkg/redis"
+)
+
+func TestNewProxyHandler_RateLimitPolicies(t *testing.T) {
+	tests := []struct {
+		name     string
+		policies []config.RateLimitPolicy
+		policy   string
+		wantErr  bool
+	}{
+		{"known policy", []config.RateLimitPolicy{{Name: "strict", RequestsPerSecond: 1, Burst: 1}}, "strict", false},
+		{"global policy", nil, defaultRateLimitPolicy, false},
+		{"unknown policy", []config.RateLimitPolicy{{Name: "strict", RequestsPerSecond: 1, Burst: 1}}, "strcit", true},
+		{"reserved name", []config.RateLimitPolicy{{Name: defaultRateLimitPolicy, RequestsPerSecond: 1, Burst: 1}}, "", true},
+		{"duplicate name", []config.RateLimitPolicy{{Name: "strict"}, {Name: "strict"}}, "", true},
+	}
+	for _, tt := range tests {
+		cfg := &config.Config{
+			RateLimit: config.RateLimitConfig{Policies: tt.policies},
+			Services:  []config.ServiceConfig{{Name: "users", BasePath: "/api/users", SkipAuth: true, RateLimitPolicy: tt.policy}},
+		}
+		_, err := NewProxyHandler(cfg, ProxyDeps{RateLimiter: rds.NewTokenBucketLimiter(100, 100)})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: NewProxyHandler() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRateLimit_Shadow(t *testing.T) {
+	var calls int
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		RateLimit: config.RateLimitConfig{Policies: []config.RateLimitPolicy{
+			{Name: "trial", RequestsPerSecond: 1, Burst: 1, Mode: config.RateLimitModeShadow},
+		}},
+		Services: []config.ServiceConfig{{Name: "reports", BasePath: "/api/reports", Target: backend.URL, SkipAuth: true, RateLimitPolicy: "trial"}},
+	}
+	proxy, err := NewProxyHandler(cfg, ProxyDeps{RateLimiter: rds.NewTokenBucketLimiter(100, 100)})
+	if err != nil {
+		t.Fatalf("NewProxyHandler() error = %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest("GET", "/api/reports", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("request %d: status = %d, want 200 in shadow mode", i, w.Code)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("backend calls = %d, want 3", calls)
+	}
+
+	if got := shadowRejections(t, "trial", "reports"); got != 2 {
+		t.Errorf("shadow rejections = %v, want 2", got)
+	}
+}
+
+// A shadow policy is evaluated beside the global limit, never instead of it.
+func TestRateLimit_ShadowKeepsGlobalLimit(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	cfg := &config.Config{
+		RateLimit: config.RateLimitConfig{Policies: []config.RateLimitPolicy{
+			{Name: "pilot", RequestsPerSecond: 1, Burst: 1, Mode: config.RateLimitModeShadow},
+		}},
+		Services: []config.ServiceConfig{{Name: "exports", BasePath: "/api/exports", Target: backend.URL, SkipAuth: true, RateLimitPolicy: "pilot"}},
+	}
+	proxy, err := NewProxyHandler(cfg, ProxyDeps{RateLimiter: rds.NewTokenBucketLimiter(1, 2)})
+	if err != nil {
+		t.Fatalf("NewProxyHandler() error = %v", err)
+	}
+
+	codes := make([]int, 3)
+	for i := range codes {
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest("GET", "/api/exports", nil))
+		codes[i] = w.Code
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+		t.Errorf("statuses = %v, want [200 200 429] from the global limit", codes)
+	}
+	if got := shadowRejections(t, "pilot", "exports"); got != 2 {
+		t.Errorf("shadow rejections = %v, want 2", got)
+	}
+}
+
+func TestSlidingWindowFor(t *testing.T) {
+	tests := []struct {
+		rps, burst int
+		limit      int
+		window     time.Duration
+	}{
+		{20, 0, 20, time.Second},
+		{20, 5, 5, 250 * time.Millisecond},
+		{10, 30, 30, 3 * time.Second},
+	}
+	for _, tt := range tests {
+		limit, window := slidingWindowFor(tt.rps, tt.burst)
+		if limit != tt.limit || window != tt.window {
+			t.Errorf("slidingWindowFor(%d, %d) = %d, %v, want %d, %v", tt.rps, tt.burst, limit, window, tt.limit, tt.window)
+		}
+	}
+}
+
+func shadowRejections(t *testing.T, policy, service string) float64 {
+	return counterValue(t, "rate_limit_shadow_rejections_total", map[string]string{"policy": policy, "service": service})
+}
+
+// counterValue reads a counter from the default registry, zero when the
+// labels have not been recorded yet.
+func counterValue(t *testing.T, name string, want map[string]string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			for key, value := range want {
+				if labels[key] != value {
+					continue metrics
+				}
+			}
+			return metric.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
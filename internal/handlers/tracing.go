@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/auth"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/middleware"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/server"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/tracing"
+)
+
+const attrService = attribute.Key("gateway.service")
+
+// routeMatchKey holds the *server.Match of a request, nil when no route
+// matched.
+type routeMatchKey struct{}
+
+// routeRequest matches the request in a routing span and labels the server
+// span and metrics with the service and route template.
+func (p *ProxyHandler) routeRequest(r *http.Request) *server.Match {
+	serverSpan := trace.SpanFromContext(r.Context())
+	_, span := tracing.Tracer().Start(r.Context(), "route")
+	defer span.End()
+
+	match := p.router.Match(r.URL.Path)
+	if match == nil {
+		span.SetAttributes(attribute.Bool("gateway.route.matched", false))
+		return nil
+	}
+	service := match.Service
+
+	span.SetAttributes(attrService.String(service.Name), semconv.HTTPRoute(service.Route))
+	serverSpan.SetName(r.Method + " " + service.Route)
+	serverSpan.SetAttributes(attrService.String(service.Name), semconv.HTTPRoute(service.Route))
+	middleware.SetRoute(r.Context(), service.Name, service.Route)
+	return match
+}
+
+// routeMatch returns the match ServeHTTP stored for r, matching only when
+// there is none.
+func (p *ProxyHandler) routeMatch(r *http.Request) *server.Match {
+	if match, ok := r.Context().Value(routeMatchKey{}).(*server.Match); ok {
+		return match
+	}
+	return p.router.Match(r.URL.Path)
+}
+
+// routeService returns the service r was routed to, or nil.
+func (p *ProxyHandler) routeService(r *http.Request) *server.ServiceConfig {
+	if match := p.routeMatch(r); match != nil {
+		return match.Service
+	}
+	return nil
+}
+
+// startAuthSpan wraps authentication; end it with endAuthSpan.
+func startAuthSpan(ctx context.Context, service *server.ServiceConfig) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "auth", trace.WithAttributes(
+		attrService.String(service.Name),
+		attribute.String("gateway.auth.mode", service.Auth),
+	))
+}
+
+func endAuthSpan(span trace.Span, r *http.Request, service *server.ServiceConfig, err error) {
+	defer span.End()
+	if err == nil {
+		span.SetAttributes(attribute.String("gateway.auth.result", authResult(r, service)))
+		return
+	}
+
+	var denied *auth.AccessDeniedError
+	if errors.As(err, &denied) {
+		span.SetAttributes(attribute.String("gateway.auth.result", "denied"), attribute.String("gateway.auth.reason", denied.Reason))
+	} else {
+		span.SetAttributes(attribute.String("gateway.auth.result", "failure"), attribute.String("gateway.auth.reason", auth.FailureReason(err)))
+	}
+	// The reason is recorded; the error text may carry token details.
+	span.SetStatus(codes.Error, "authentication failed")
+}
+
+// startUpstreamSpan starts the client span for the backend call.
+func startUpstreamSpan(ctx context.Context, service *server.ServiceConfig, method, host string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "upstream "+service.Name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attrService.String(service.Name),
+			semconv.HTTPRequestMethodKey.String(method),
+			semconv.ServerAddress(host),
+		),
+	)
+}
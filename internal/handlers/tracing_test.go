@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/middleware"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+	rds "github.com/mtsgn/mtsgn-system-gateway-svc/pkg/redis"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/tracing"
+)
+
+func TestTracing_PropagatesToUpstream(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(tracing.Propagator())
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	var upstream http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = r.Header.Clone()
+	}))
+	defer backend.Close()
+
+	cfg := &config.Config{Services: []config.ServiceConfig{
+		{Name: "orders", BasePath: "/api/orders/*", Target: backend.URL, SkipAuth: true},
+	}}
+	proxy, err := NewProxyHandler(cfg, ProxyDeps{RateLimiter: rds.NewTokenBucketLimiter(100, 100)})
+	if err != nil {
+		t.Fatalf("NewProxyHandler() error = %v", err)
+	}
+	handler := middleware.Tracing(proxy)
+
+	r := httptest.NewRequest("GET", "/api/orders/7", nil)
+	r.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	if got := upstream.Get("traceparent"); !strings.HasPrefix(got, "00-"+traceID+"-") || strings.Contains(got, "00f067aa0ba902b7") {
+		t.Errorf("upstream traceparent = %q, want the same trace with the gateway's span as parent", got)
+	}
+	if got := upstream.Get("X-B3-TraceId"); got != traceID {
+		t.Errorf("upstream X-B3-TraceId = %q, want %s", got, traceID)
+	}
+
+	names := map[string]bool{}
+	for _, span := range recorder.Ended() {
+		names[span.Name()] = true
+		if span.SpanContext().TraceID().String() != traceID {
+			t.Errorf("span %q is in trace %s, want %s", span.Name(), span.SpanContext().TraceID(), traceID)
+		}
+	}
+	for _, name := range []string{"GET /api/orders/*", "route", "rate_limit", "auth", "upstream orders"} {
+		if !names[name] {
+			t.Errorf("missing span %q, got %v", name, names)
+		}
+	}
+}
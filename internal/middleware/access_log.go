@@ -0,0 +1,395 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+)
+
+const (
+	defaultAccessLogBodyBytes = 4096
+	redacted                  = "[REDACTED]"
+)
+
+// Header values that never reach the access log in clear text.
+var defaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-API-Key"}
+
+// Body fields masked when bodies are captured.
+var defaultRedactFields = []string{"password", "token", "access_token", "refresh_token", "id_token", "secret", "client_secret", "api_key"}
+
+// AccessLog writes one record per request in the configured format.
+type AccessLog struct {
+	format        string
+	fields        map[string]bool
+	sampling      map[string]float64
+	headers       []string
+	redactHeaders map[string]bool
+	body          bool
+	maxBodyBytes  int
+	redactFields  map[string]bool
+	logTypes      []string
+
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// NewAccessLog opens the configured output. It returns nil when the access
+// log is turned off.
+func NewAccessLog(cfg config.AccessLogConfig) (*AccessLog, error) {
+	format := strings.ToLower(cfg.Format)
+	switch format {
+	case "":
+		format = config.AccessLogFormatJSON
+	case config.AccessLogFormatJSON, config.AccessLogFormatCombined:
+	case config.AccessLogFormatOff:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown access log format %q", cfg.Format)
+	}
+
+	var out io.Writer
+	switch cfg.Output {
+	case "", "stdout":
+		out = os.Stdout
+	case "stderr":
+		out = os.Stderr
+	default:
+		file, err := os.OpenFile(cfg.Output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("open access log: %w", err)
+		}
+		out = file
+	}
+	return newAccessLog(cfg, format, out), nil
+}
+
+func newAccessLog(cfg config.AccessLogConfig, format string, out io.Writer) *AccessLog {
+	a := &AccessLog{
+		format:        format,
+		sampling:      make(map[string]float64, len(cfg.Sampling)),
+		redactHeaders: make(map[string]bool),
+		body:          cfg.Body.Enabled,
+		maxBodyBytes:  cfg.Body.MaxBytes,
+		redactFields:  make(map[string]bool),
+		out:           out,
+	}
+	if len(cfg.Fields) > 0 {
+		a.fields = make(map[string]bool, len(cfg.Fields))
+		for _, field := range cfg.Fields {
+			a.fields[field] = true
+		}
+	}
+	for status, rate := range cfg.Sampling {
+		a.sampling[strings.ToLower(status)] = rate
+	}
+	for _, header := range cfg.Headers {
+		a.headers = append(a.headers, http.CanonicalHeaderKey(header))
+	}
+	for _, header := range append(defaultRedactHeaders, cfg.RedactHeaders...) {
+		a.redactHeaders[http.CanonicalHeaderKey(header)] = true
+	}
+	for _, field := range append(defaultRedactFields, cfg.Body.RedactFields...) {
+		a.redactFields[strings.ToLower(field)] = true
+	}
+	for _, mediaType := range cfg.Body.LogTypes {
+		a.logTypes = append(a.logTypes, strings.ToLower(mediaType))
+	}
+	if a.maxBodyBytes <= 0 {
+		a.maxBodyBytes = defaultAccessLogBodyBytes
+	}
+	return a
+}
+
+// sampled reports whether a record with this status is kept. An exact
+// status takes precedence over its class.
+func (a *AccessLog) sampled(status int) bool {
+	code := strconv.Itoa(status)
+	rate, ok := a.sampling[code]
+	if !ok {
+		rate, ok = a.sampling[code[:1]+"xx"]
+	}
+	if !ok || rate >= 1 {
+		return true
+	}
+	return rand.Float64() < rate
+}
+
+// accessRecord collects what the proxy learns about a request while it is
+// being served.
+type accessRecord struct {
+	mu       sync.Mutex
+	upstream string
+	userID   string
+	latency  map[string]time.Duration
+}
+
+type accessRecordKey struct{}
+
+func recordFromContext(ctx context.Context) *accessRecord {
+	record, _ := ctx.Value(accessRecordKey{}).(*accessRecord)
+	return record
+}
+
+// SetUpstream records the backend a request was forwarded to and how long
+// it took to respond.
+func SetUpstream(ctx context.Context, upstream string, latency time.Duration) {
+	if record := recordFromContext(ctx); record != nil {
+		record.mu.Lock()
+		record.upstream = upstream
+		record.latency["upstream"] = latency
+		record.mu.Unlock()
+	}
+}
+
+// SetUserID records the authenticated subject of a request.
+func SetUserID(ctx context.Context, userID string) {
+	if record := recordFromContext(ctx); record != nil {
+		record.mu.Lock()
+		record.userID = userID
+		record.mu.Unlock()
+	}
+}
+
+// ObserveLatency adds time spent in a gateway phase such as auth or
+// rate_limit to the latency breakdown.
+func ObserveLatency(ctx context.Context, phase string, d time.Duration) {
+	if record := recordFromContext(ctx); record != nil {
+		record.mu.Lock()
+		record.latency[phase] += d
+		record.mu.Unlock()
+	}
+}
+
+// entry is everything known about a finished request.
+type entry struct {
+	start     time.Time
+	r         *http.Request
+	requestID string
+	clientIP  string
+	service   string
+	route     string
+	status    int
+	bytesIn   int64
+	bytesOut  int64
+	duration  time.Duration
+	record    *accessRecord
+	body      *bodyCapture
+}
+
+func (a *AccessLog) write(e entry) error {
+	var line []byte
+	if a.format == config.AccessLogFormatCombined {
+		line = a.combined(e)
+	} else {
+		var err error
+		if line, err = json.Marshal(a.fieldsOf(e)); err != nil {
+			return err
+		}
+		line = append(line, '\n')
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err := a.out.Write(line)
+	return err
+}
+
+func (a *AccessLog) fieldsOf(e entry) map[string]any {
+	e.record.mu.Lock()
+	latency := map[string]float64{"total": milliseconds(e.duration)}
+	gateway := e.duration
+	for phase, d := range e.record.latency {
+		latency[phase] = milliseconds(d)
+		if phase == "upstream" {
+			gateway -= d
+		}
+	}
+	latency["gateway"] = milliseconds(gateway)
+	fields := map[string]any{
+		"time":       e.start.UTC().Format(time.RFC3339Nano),
+		"request_id": e.requestID,
+		"client_ip":  e.clientIP,
+		"method":     e.r.Method,
+		"path":       e.r.URL.Path,
+		"protocol":   e.r.Proto,
+		"service":    e.service,
+		"route":      e.route,
+		"upstream":   e.record.upstream,
+		"user_id":    e.record.userID,
+		"status":     e.status,
+		"bytes_in":   e.bytesIn,
+		"bytes_out":  e.bytesOut,
+		"latency_ms": latency,
+		"user_agent": e.r.UserAgent(),
+		"referer":    e.r.Referer(),
+	}
+	e.record.mu.Unlock()
+
+	if len(a.headers) > 0 {
+		headers := make(map[string]string, len(a.headers))
+		for _, name := range a.headers {
+			if value := e.r.Header.Get(name); value != "" {
+				if a.redactHeaders[name] {
+					value = redacted
+				}
+				headers[name] = value
+			}
+		}
+		fields["headers"] = headers
+	}
+	if e.body != nil && e.body.buf.Len() > 0 {
+		fields["body"] = a.redactBody(e.r.Header.Get("Content-Type"), e.body)
+	}
+
+	if a.fields != nil {
+		for name := range fields {
+			if !a.fields[name] {
+				delete(fields, name)
+			}
+		}
+	}
+	return fields
+}
+
+// combined renders the Apache combined log format.
+func (a *AccessLog) combined(e entry) []byte {
+	e.record.mu.Lock()
+	user := e.record.userID
+	e.record.mu.Unlock()
+	if user == "" {
+		user = "-"
+	}
+	size := "-"
+	if e.bytesOut > 0 {
+		size = strconv.FormatInt(e.bytesOut, 10)
+	}
+	return fmt.Appendf(nil, "%s - %s [%s] %q %d %s %q %q\n",
+		e.clientIP,
+		user,
+		e.start.Format("02/Jan/2006:15:04:05 -0700"),
+		e.r.Method+" "+a.requestURI(e.r.URL)+" "+e.r.Proto,
+		e.status,
+		size,
+		e.r.Referer(),
+		e.r.UserAgent(),
+	)
+}
+
+// requestURI masks query parameters named like sensitive body fields, such
+// as an API key passed in the query string.
+func (a *AccessLog) requestURI(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.RequestURI()
+	}
+	query := u.Query()
+	for key := range query {
+		if a.redactFields[strings.ToLower(key)] {
+			query[key] = []string{redacted}
+		}
+	}
+	masked := *u
+	masked.RawQuery = query.Encode()
+	return masked.RequestURI()
+}
+
+// redactBody masks sensitive JSON and form fields. JSON that was cut off at
+// the size limit cannot be parsed and is left out, as are other bodies unless
+// their type is configured to be logged.
+func (a *AccessLog) redactBody(contentType string, body *bodyCapture) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		var value any
+		if body.truncated || json.Unmarshal(body.buf.Bytes(), &value) != nil {
+			return "[unparsed json body]"
+		}
+		out, _ := json.Marshal(a.redactValue(value))
+		return string(out)
+	case mediaType == "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(body.buf.String())
+		if err != nil {
+			return "[unparsed form body]"
+		}
+		for key := range values {
+			if a.redactFields[strings.ToLower(key)] {
+				values[key] = []string{redacted}
+			}
+		}
+		return values.Encode()
+	case slices.ContainsFunc(a.logTypes, func(pattern string) bool { return mediaMatches(pattern, mediaType) }):
+		return body.buf.String()
+	case mediaType == "":
+		return "[unredacted body omitted]"
+	default:
+		return "[unredacted " + mediaType + " body omitted]"
+	}
+}
+
+// mediaMatches reports whether mediaType falls in pattern, which may be a
+// "type/*" range.
+func mediaMatches(pattern, mediaType string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(mediaType, prefix+"/")
+	}
+	return pattern == mediaType
+}
+
+func (a *AccessLog) redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, field := range v {
+			if a.redactFields[strings.ToLower(key)] {
+				v[key] = redacted
+			} else {
+				v[key] = a.redactValue(field)
+			}
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = a.redactValue(item)
+		}
+	}
+	return value
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// bodyCapture counts the request body as it is read and keeps the first
+// bytes of it when capture is enabled.
+type bodyCapture struct {
+	io.ReadCloser
+	n         int64
+	limit     int
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (b *bodyCapture) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if room := b.limit - b.buf.Len(); n > 0 && !b.truncated {
+		if n > room {
+			b.buf.Write(p[:room])
+			b.truncated = true
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+	return n, err
+}
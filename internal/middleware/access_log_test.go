@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mtsgn/mtsgn-mtsgn-system-common-svc/common/logger"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+)
+
+func serveLogged(t *testing.T, cfg config.AccessLogConfig, format string, req *http.Request) string {
+	t.Helper()
+	var out bytes.Buffer
+	accessLog := newAccessLog(cfg, format, &out)
+	handler := Logger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		SetRoute(r.Context(), "users", "/api/v1/users/*")
+		SetUserID(r.Context(), "user-1")
+		SetUpstream(r.Context(), "users.internal:8080", 5*time.Millisecond)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	}), accessLog, logger.ZeroLogger{})
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	return out.String()
+}
+
+func TestAccessLog_JSON(t *testing.T) {
+	cfg := config.AccessLogConfig{
+		Headers: []string{"Authorization", "X-Tenant"},
+		Body:    config.AccessLogBodyConfig{Enabled: true, RedactFields: []string{"pin"}},
+	}
+	req := httptest.NewRequest("POST", "/api/v1/users", strings.NewReader(`{"name":"ann","password":"hunter2","card":{"pin":"1234"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer secret-token")
+	req.Header.Set("X-Tenant", "acme")
+
+	line := serveLogged(t, cfg, config.AccessLogFormatJSON, req)
+	if strings.Count(line, "\n") != 1 {
+		t.Fatalf("want exactly one record, got %q", line)
+	}
+	if strings.Contains(line, "hunter2") || strings.Contains(line, "1234") || strings.Contains(line, "secret-token") {
+		t.Fatalf("record leaks a secret: %s", line)
+	}
+
+	var record struct {
+		Route    string            `json:"route"`
+		Service  string            `json:"service"`
+		Upstream string            `json:"upstream"`
+		UserID   string            `json:"user_id"`
+		Status   int               `json:"status"`
+		BytesIn  int64             `json:"bytes_in"`
+		BytesOut int64             `json:"bytes_out"`
+		Latency  map[string]any    `json:"latency_ms"`
+		Headers  map[string]string `json:"headers"`
+		Body     string            `json:"body"`
+	}
+	if err := json.Unmarshal([]byte(line), &record); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if record.Route != "/api/v1/users/*" || record.Service != "users" || record.Upstream != "users.internal:8080" || record.UserID != "user-1" {
+		t.Errorf("record = %+v, want route, service, upstream and user filled in", record)
+	}
+	if record.Status != http.StatusCreated || record.BytesIn != req.ContentLength || record.BytesOut != int64(len("created")) {
+		t.Errorf("status %d, bytes in %d, bytes out %d", record.Status, record.BytesIn, record.BytesOut)
+	}
+	if _, ok := record.Latency["upstream"]; !ok {
+		t.Errorf("latency_ms = %v, want an upstream entry", record.Latency)
+	}
+	if record.Headers["Authorization"] != redacted || record.Headers["X-Tenant"] != "acme" {
+		t.Errorf("headers = %v", record.Headers)
+	}
+	if !strings.Contains(record.Body, `"name":"ann"`) {
+		t.Errorf("body = %q, want the unredacted fields kept", record.Body)
+	}
+}
+
+func TestAccessLog_BodyLimit(t *testing.T) {
+	cfg := config.AccessLogConfig{Body: config.AccessLogBodyConfig{Enabled: true, MaxBytes: 8, LogTypes: []string{"text/*"}}}
+	req := httptest.NewRequest("POST", "/upload", strings.NewReader("0123456789abcdef"))
+	req.Header.Set("Content-Type", "text/plain")
+
+	var record struct {
+		BytesIn int64  `json:"bytes_in"`
+		Body    string `json:"body"`
+	}
+	json.Unmarshal([]byte(serveLogged(t, cfg, config.AccessLogFormatJSON, req)), &record)
+	if record.Body != "01234567" || record.BytesIn != 16 {
+		t.Errorf("body = %q, bytes_in = %d, want the first 8 of 16 bytes", record.Body, record.BytesIn)
+	}
+
+	// Types that are neither redacted nor listed are left out
+	req = httptest.NewRequest("POST", "/upload", strings.NewReader("password=hunter2"))
+	req.Header.Set("Content-Type", "application/xml")
+	json.Unmarshal([]byte(serveLogged(t, cfg, config.AccessLogFormatJSON, req)), &record)
+	if record.Body != "[unredacted application/xml body omitted]" {
+		t.Errorf("body = %q, want the xml body omitted", record.Body)
+	}
+}
+
+func TestAccessLog_Combined(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/v1/users?api_key=gk_secret&page=2", nil)
+	req.Header.Set("User-Agent", "curl/8.0")
+
+	line := serveLogged(t, config.AccessLogConfig{}, config.AccessLogFormatCombined, req)
+	if strings.Contains(line, "gk_secret") {
+		t.Fatalf("record leaks the api key: %s", line)
+	}
+	for _, want := range []string{"192.0.2.1 - user-1 [", `"GET /api/v1/users?api_key=%5BREDACTED%5D&page=2 HTTP/1.1" 201 7 "" "curl/8.0"`} {
+		if !strings.Contains(line, want) {
+			t.Errorf("record %q does not contain %q", line, want)
+		}
+	}
+}
+
+func TestAccessLog_Sampling(t *testing.T) {
+	accessLog := newAccessLog(config.AccessLogConfig{Sampling: map[string]float64{"2xx": 0, "201": 1}}, config.AccessLogFormatJSON, io.Discard)
+	if accessLog.sampled(http.StatusOK) {
+		t.Error("200 should be dropped by the 2xx rate")
+	}
+	if !accessLog.sampled(http.StatusCreated) {
+		t.Error("201 should be kept by its exact rate")
+	}
+	if !accessLog.sampled(http.StatusBadGateway) {
+		t.Error("unlisted statuses should always be logged")
+	}
+}
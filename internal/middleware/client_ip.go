@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/utils"
+)
+
+// ClientIP resolves the originating client address once and stores it in the
+// request context, where utils.GetClientIP picks it up for all later handlers.
+func ClientIP(next http.Handler, resolver *utils.ClientIPResolver) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := utils.WithClientIP(r.Context(), resolver.Resolve(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
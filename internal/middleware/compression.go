@@ -0,0 +1,405 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/internal/problem"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+)
+
+// Supported content codings.
+const (
+	EncodingGzip   = "gzip"
+	EncodingBrotli = "br"
+	EncodingZstd   = "zstd"
+)
+
+const (
+	defaultCompressionMinSize    = 1024
+	defaultMaxDecompressedBytes  = 10 << 20
+	compressionVaryHeader        = "Accept-Encoding"
+	compressionEventStreamPrefix = "text/event-stream"
+)
+
+var defaultCompressionEncodings = []string{EncodingZstd, EncodingBrotli, EncodingGzip}
+
+var defaultCompressionTypes = []string{
+	"text/*",
+	"application/json",
+	"application/problem+json",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+}
+
+// encoder is implemented by the gzip, brotli and zstd writers.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+var encoderPools = map[string]*sync.Pool{
+	EncodingGzip: {New: func() any { return gzip.NewWriter(nil) }},
+	EncodingBrotli: {New: func() any {
+		return brotli.NewWriterLevel(nil, brotli.DefaultCompression)
+	}},
+	EncodingZstd: {New: func() any {
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+		return w
+	}},
+}
+
+// Compressor negotiates response compression per request.
+type Compressor struct {
+	enabled         bool
+	services        map[string]bool
+	encodings       []string
+	minSize         int
+	types           []string
+	decompress      bool
+	maxRequestBytes int64
+}
+
+// NewCompressor returns nil when neither compression nor any service
+// override is enabled.
+func NewCompressor(cfg config.CompressionConfig, services []config.ServiceConfig) *Compressor {
+	c := &Compressor{
+		enabled:         cfg.Enabled,
+		services:        make(map[string]bool),
+		minSize:         cfg.MinSize,
+		types:           cfg.Types,
+		decompress:      cfg.DecompressRequests,
+		maxRequestBytes: cfg.MaxRequestBytes,
+	}
+	active := cfg.Enabled || cfg.DecompressRequests
+	for _, service := range services {
+		if service.Compress != nil {
+			c.services[service.Name] = *service.Compress
+			active = active || *service.Compress
+		}
+	}
+	if !active {
+		return nil
+	}
+	for _, encoding := range cfg.Encodings {
+		encoding = strings.ToLower(strings.TrimSpace(encoding))
+		if _, ok := encoderPools[encoding]; ok {
+			c.encodings = append(c.encodings, encoding)
+		}
+	}
+	if len(c.encodings) == 0 {
+		c.encodings = defaultCompressionEncodings
+	}
+	if c.minSize <= 0 {
+		c.minSize = defaultCompressionMinSize
+	}
+	if len(c.types) == 0 {
+		c.types = defaultCompressionTypes
+	}
+	if c.maxRequestBytes <= 0 {
+		c.maxRequestBytes = defaultMaxDecompressedBytes
+	}
+	return c
+}
+
+func (c *Compressor) enabledFor(service string) bool {
+	if enabled, ok := c.services[service]; ok {
+		return enabled
+	}
+	return c.enabled
+}
+
+func (c *Compressor) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || strings.HasPrefix(mediaType, compressionEventStreamPrefix) {
+		return false
+	}
+	for _, allowed := range c.types {
+		if allowed == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiate picks the encoding the client weights highest, breaking ties by
+// the configured preference. It returns "" when none is acceptable.
+func (c *Compressor) negotiate(acceptEncoding string) string {
+	weights := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "x-gzip" {
+			name = EncodingGzip
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		if name != "" {
+			weights[name] = q
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range c.encodings {
+		q, ok := weights[encoding]
+		if !ok {
+			q = weights["*"]
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// Compression compresses responses for clients that accept it and, when
+// enabled, decodes gzip, brotli and zstd request bodies before they are
+// forwarded.
+func Compression(next http.Handler, c *Compressor) http.Handler {
+	if c == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.decompress {
+			var ok bool
+			if r, ok = c.decodeRequest(w, r); !ok {
+				return
+			}
+		}
+
+		// The service is only known once the proxy has routed the request.
+		labels, ok := r.Context().Value(routeLabelsKey{}).(*routeLabels)
+		if !ok {
+			labels = &routeLabels{}
+			r = r.WithContext(context.WithValue(r.Context(), routeLabelsKey{}, labels))
+		}
+
+		cw := &compressWriter{
+			ResponseWriter: w,
+			c:              c,
+			r:              r,
+			labels:         labels,
+			encoding:       c.negotiate(r.Header.Get("Accept-Encoding")),
+		}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// decodeRequest replaces an encoded request body with its decoded form,
+// bounded by the configured size. Unknown codings are left to the backend.
+func (c *Compressor) decodeRequest(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	if encoding == "" || r.Body == nil || r.Body == http.NoBody {
+		return r, true
+	}
+
+	var decoded io.ReadCloser
+	var err error
+	switch encoding {
+	case EncodingGzip, "x-gzip":
+		decoded, err = gzip.NewReader(r.Body)
+	case EncodingBrotli:
+		decoded = io.NopCloser(brotli.NewReader(r.Body))
+	case EncodingZstd:
+		// Decode on the request goroutine and refuse frames whose window
+		// alone is larger than the body may become.
+		var zr *zstd.Decoder
+		zr, err = zstd.NewReader(r.Body,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxMemory(uint64(c.maxRequestBytes)),
+			zstd.WithDecoderMaxWindow(uint64(max(c.maxRequestBytes, zstd.MinWindowSize))))
+		if err == nil {
+			decoded = zstdBody{zr.IOReadCloser(), c.maxRequestBytes}
+		}
+	default:
+		return r, true
+	}
+	if err != nil {
+		problem.Write(w, r, problem.New(http.StatusBadRequest, problem.CodeBadRequest, "The request body could not be decoded"))
+		return r, false
+	}
+
+	r.Body = http.MaxBytesReader(w, decoded, c.maxRequestBytes)
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	r.ContentLength = -1
+	return r, true
+}
+
+// zstdBody reports the decoder's size limits as an oversized body, so the
+// client gets a 413 rather than a decoding failure.
+type zstdBody struct {
+	io.ReadCloser
+	limit int64
+}
+
+func (b zstdBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if errors.Is(err, zstd.ErrWindowSizeExceeded) || errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+		err = &http.MaxBytesError{Limit: b.limit}
+	}
+	return n, err
+}
+
+// compressWriter decides whether to compress once the response headers and
+// the first min_size bytes, or the whole body if shorter, are known.
+type compressWriter struct {
+	http.ResponseWriter
+	c        *Compressor
+	r        *http.Request
+	labels   *routeLabels
+	encoding string
+
+	status      int
+	wroteHeader bool
+	decided     bool
+	eligible    bool
+	buf         []byte
+	enc         encoder
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	if status < http.StatusOK {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = status
+	cw.eligible = cw.checkEligible()
+	if !cw.eligible {
+		cw.decide(false)
+		return
+	}
+	if length, err := strconv.Atoi(cw.Header().Get("Content-Length")); err == nil {
+		cw.decide(length >= cw.c.minSize)
+	}
+}
+
+func (cw *compressWriter) checkEligible() bool {
+	header := cw.Header()
+	if !cw.c.enabledFor(cw.labels.service) || !cw.c.compressible(header.Get("Content-Type")) {
+		return false
+	}
+	if encoding := header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return false
+	}
+	if header.Get("Content-Range") != "" || strings.Contains(strings.ToLower(header.Get("Cache-Control")), "no-transform") {
+		return false
+	}
+	if !slices.Contains(header.Values("Vary"), compressionVaryHeader) {
+		header.Add("Vary", compressionVaryHeader)
+	}
+	switch {
+	case cw.encoding == "", cw.r.Method == http.MethodHead:
+		return false
+	case cw.status == http.StatusNoContent, cw.status == http.StatusNotModified, cw.status == http.StatusPartialContent:
+		return false
+	}
+	return true
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.decided {
+		if cw.enc != nil {
+			return cw.enc.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) >= cw.c.minSize {
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// decide sends the headers and anything buffered, compressed or not.
+func (cw *compressWriter) decide(compress bool) error {
+	cw.decided = true
+	if compress {
+		header := cw.Header()
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+		header.Del("Accept-Ranges")
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		cw.enc = encoderPools[cw.encoding].Get().(encoder)
+		cw.enc.Reset(cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if cw.enc != nil {
+		_, err := cw.enc.Write(buf)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+// Flush sends buffered output straight away. A response flushed before a
+// decision was made is streamed uncompressed.
+func (cw *compressWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		cw.decide(false)
+	}
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *compressWriter) close() {
+	if !cw.wroteHeader {
+		return
+	}
+	if !cw.decided {
+		cw.decide(cw.eligible && len(cw.buf) >= cw.c.minSize)
+	}
+	if cw.enc != nil {
+		cw.enc.Close()
+		cw.enc.Reset(nil)
+		encoderPools[cw.encoding].Put(cw.enc)
+		cw.enc = nil
+	}
+}
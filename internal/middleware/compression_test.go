@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+)
+
+func decode(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+	var r io.Reader
+	switch encoding {
+	case EncodingGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = zr
+	case EncodingBrotli:
+		r = brotli.NewReader(bytes.NewReader(body))
+	case EncodingZstd:
+		zr, err := zstd.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return string(body)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("decode %s: %v", encoding, err)
+	}
+	return string(out)
+}
+
+func TestCompression(t *testing.T) {
+	off := false
+	compressor := NewCompressor(config.CompressionConfig{Enabled: true, MinSize: 100}, []config.ServiceConfig{{Name: "media", Compress: &off}})
+	large := strings.Repeat(`{"id":1,"name":"product"},`, 20)
+
+	tests := []struct {
+		name           string
+		service        string
+		acceptEncoding string
+		contentType    string
+		header         http.Header
+		body           string
+		want           string
+	}{
+		{"gzip", "catalogue", "gzip", "application/json", nil, large, EncodingGzip},
+		{"client preference", "catalogue", "gzip;q=0.5, br;q=0.9", "application/json", nil, large, EncodingBrotli},
+		{"server preference", "catalogue", "gzip, br, zstd", "application/json", nil, large, EncodingZstd},
+		{"wildcard", "catalogue", "*", "text/html; charset=utf-8", nil, large, EncodingZstd},
+		{"not accepted", "catalogue", "identity", "application/json", nil, large, ""},
+		{"too small", "catalogue", "gzip", "application/json", nil, `{"id":1}`, ""},
+		{"type not allowed", "catalogue", "gzip", "image/png", nil, large, ""},
+		{"already encoded", "catalogue", "gzip", "application/json", http.Header{"Content-Encoding": {"br"}}, large, "br"},
+		{"event stream", "catalogue", "gzip", "text/event-stream", nil, large, ""},
+		{"service disabled", "media", "gzip", "application/json", nil, large, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := Compression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				SetRoute(r.Context(), tt.service, "/*")
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Header().Set("ETag", `"v1"`)
+				for name, values := range tt.header {
+					w.Header()[name] = values
+				}
+				// Written in pieces, as the proxy streams backend bodies.
+				for i := 0; i < len(tt.body); i += 64 {
+					w.Write([]byte(tt.body[i:min(i+64, len(tt.body))]))
+				}
+			}), compressor)
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if got := w.Header().Get("Content-Encoding"); got != tt.want {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.want)
+			}
+			if tt.want == "" || tt.header != nil {
+				if w.Body.String() != tt.body {
+					t.Errorf("body was modified")
+				}
+				return
+			}
+			if got := decode(t, tt.want, w.Body.Bytes()); got != tt.body {
+				t.Errorf("decoded body = %q, want %q", got, tt.body)
+			}
+			if w.Header().Get("ETag") != `W/"v1"` || w.Header().Get("Vary") != "Accept-Encoding" {
+				t.Errorf("ETag %q, Vary %q, want a weak ETag and Vary: Accept-Encoding", w.Header().Get("ETag"), w.Header().Get("Vary"))
+			}
+		})
+	}
+}
+
+func TestCompression_DecodesRequests(t *testing.T) {
+	compressor := NewCompressor(config.CompressionConfig{DecompressRequests: true, MaxRequestBytes: 64}, nil)
+	var got string
+	var readErr error
+	handler := Compression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body []byte
+		body, readErr = io.ReadAll(r.Body)
+		got = string(body)
+	}), compressor)
+
+	encode := func(s string) *bytes.Buffer {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(s))
+		zw.Close()
+		return &buf
+	}
+
+	r := httptest.NewRequest("POST", "/", encode(`{"name":"ann"}`))
+	r.Header.Set("Content-Encoding", "gzip")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if got != `{"name":"ann"}` || readErr != nil {
+		t.Errorf("decoded body = %q, %v", got, readErr)
+	}
+
+	r = httptest.NewRequest("POST", "/", encode(strings.Repeat("a", 1000)))
+	r.Header.Set("Content-Encoding", "gzip")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	var tooLarge *http.MaxBytesError
+	if readErr == nil || !errors.As(readErr, &tooLarge) {
+		t.Errorf("reading an oversized body: err = %v, want http.MaxBytesError", readErr)
+	}
+
+	// A zstd frame may not ask for a window larger than the limit
+	var zbuf bytes.Buffer
+	zw, _ := zstd.NewWriter(&zbuf, zstd.WithWindowSize(1<<20))
+	zw.Write([]byte(strings.Repeat("a", 1<<20)))
+	zw.Close()
+	r = httptest.NewRequest("POST", "/", &zbuf)
+	r.Header.Set("Content-Encoding", "zstd")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if readErr == nil || !errors.As(readErr, &tooLarge) {
+		t.Errorf("reading an oversized zstd body: err = %v, want http.MaxBytesError", readErr)
+	}
+
+	r = httptest.NewRequest("POST", "/", strings.NewReader("not gzip"))
+	r.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid gzip body: status = %d, want 400", w.Code)
+	}
+}
@@ -1,9 +1,7 @@
 package middleware
 
 import (
-	"bytes"
 	"context"
-	"io"
 	"net/http"
 	"time"
 
@@ -12,65 +10,83 @@ import (
 	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/utils"
 )
 
-// Logger logs HTTP requests with status code, method, and duration
-func Logger(next http.Handler, logger logger.ZeroLogger) http.Handler {
+// Logger writes one access log record per request. Request bodies are only
+// captured when enabled, and then only up to the configured size as they
+// stream to the backend.
+func Logger(next http.Handler, accessLog *AccessLog, zeroLogger logger.ZeroLogger) http.Handler {
+	logger := utils.NewContextLogger(zeroLogger)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := context.Background()
+		// Requests that bypassed the RequestID middleware still get an ID.
+		if _, ok := utils.RequestIDFromContext(r.Context()); !ok {
+			r = r.WithContext(utils.WithRequestID(r.Context(), uuid.New().String()))
+		}
+		if accessLog == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
 		start := time.Now()
-		clientIP := utils.GetClientIP(r)
-		requestID := uuid.New().String()
 
-		// Log request details (except body for large requests)
-		logger.Info(ctx,
-			"Incoming request",
-			"request_id", requestID,
-			"method", r.Method,
-			"path", r.URL.Path,
-			"client_ip", clientIP,
-			"user_agent", r.UserAgent(),
-		)
-
-		// For debugging, log request body (be careful with large bodies)
-		if r.Body != nil {
-			bodyBytes, _ := io.ReadAll(r.Body)
-			r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+		// Share the route labels with Metrics when it runs first.
+		labels, ok := ctx.Value(routeLabelsKey{}).(*routeLabels)
+		if !ok {
+			labels = &routeLabels{}
+			ctx = context.WithValue(ctx, routeLabelsKey{}, labels)
+		}
+		record := &accessRecord{latency: make(map[string]time.Duration)}
+		ctx = context.WithValue(ctx, accessRecordKey{}, record)
+		r = r.WithContext(ctx)
 
-			if len(bodyBytes) > 0 && len(bodyBytes) < 1024*10 { // Limit to 10KB
-				logger.Debug(ctx, "Request body", "body", bodyBytes)
+		var body *bodyCapture
+		if r.Body != nil && r.Body != http.NoBody {
+			body = &bodyCapture{ReadCloser: r.Body}
+			if accessLog.body {
+				body.limit = accessLog.maxBodyBytes
 			}
+			r.Body = body
 		}
 
-		// Use response recorder to capture status and duration
 		recorder := newResponseRecorder(w)
 		next.ServeHTTP(recorder, r)
 
 		duration := time.Since(start)
-
-		// Log access
-		accessLog(logger, ctx, r, requestID, recorder.statusCode, duration, clientIP)
-
-		// Log error responses
-		if recorder.statusCode >= 400 {
-			logger.Error(ctx, "Request failed", "status", recorder.statusCode, "path", r.URL.Path, "duration", duration, "client_ip", clientIP)
+		if !accessLog.sampled(recorder.statusCode) {
+			return
+		}
+		e := entry{
+			start:     start,
+			r:         r,
+			requestID: utils.GetRequestID(r),
+			clientIP:  utils.GetClientIP(r),
+			service:   labels.service,
+			route:     labels.route,
+			status:    recorder.statusCode,
+			bytesOut:  recorder.bytes,
+			duration:  duration,
+			record:    record,
+		}
+		if body != nil {
+			e.bytesIn = body.n
+			if accessLog.body {
+				e.body = body
+			}
+		}
+		if err := accessLog.write(e); err != nil {
+			logger.Error(ctx, "Failed to write access log", "error", err)
 		}
 	})
 }
 
-func accessLog(logger logger.ZeroLogger, ctx context.Context, r *http.Request, requestID string, status int, duration time.Duration, clientIP string) {
-	logger.Info(ctx, "HTTP request", "request_id", requestID, "method", r.Method, "path", r.URL.Path, "status", status, "duration", duration, "client_ip", clientIP, "user_agent", r.UserAgent())
-}
-
 type responseRecorder struct {
 	http.ResponseWriter
 	statusCode int
-	body       *bytes.Buffer
+	bytes      int64
 }
 
 func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
 	return &responseRecorder{
 		ResponseWriter: w,
 		statusCode:     http.StatusOK,
-		body:           bytes.NewBuffer(nil),
 	}
 }
 
@@ -80,6 +96,15 @@ func (r *responseRecorder) WriteHeader(statusCode int) {
 }
 
 func (r *responseRecorder) Write(b []byte) (int, error) {
-	r.body.Write(b)
-	return r.ResponseWriter.Write(b)
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *responseRecorder) Flush() {
+	http.NewResponseController(r.ResponseWriter).Flush()
+}
+
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
 }
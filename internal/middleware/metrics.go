@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"strconv"
 	"time"
@@ -15,7 +16,7 @@ var (
 			Name: "http_requests_total",
 			Help: "Total number of HTTP requests",
 		},
-		[]string{"method", "path", "status"},
+		[]string{"method", "service", "route", "status"},
 	)
 
 	httpRequestDuration = promauto.NewHistogramVec(
@@ -24,7 +25,7 @@ var (
 			Help:    "Duration of HTTP requests in seconds",
 			Buckets: prometheus.DefBuckets,
 		},
-		[]string{"method", "path", "status"},
+		[]string{"method", "service", "route", "status"},
 	)
 
 	httpRequestsInFlight = promauto.NewGauge(
@@ -37,9 +38,80 @@ var (
 	rateLimitHits = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "rate_limit_hits_total",
-			Help: "Total number of rate limit hits",
+			Help: "Total number of requests rejected by a rate limit policy",
 		},
-		[]string{"path"},
+		[]string{"policy", "service"},
+	)
+
+	rateLimitShadowRejections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rate_limit_shadow_rejections_total",
+			Help: "Total number of requests a shadow-mode rate limit policy would have rejected",
+		},
+		[]string{"policy", "service"},
+	)
+
+	ipFilterRejections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ip_filter_rejections_total",
+			Help: "Total number of requests refused by IP allow/deny or country rules",
+		},
+		[]string{"service", "reason"},
+	)
+
+	accessDenials = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "access_denials_total",
+			Help: "Total number of valid tokens refused by route access rules",
+		},
+		[]string{"service", "reason"},
+	)
+
+	tokenCacheRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "token_cache_requests_total",
+			Help: "Total number of verified-token cache lookups by result",
+		},
+		[]string{"result"},
+	)
+
+	responseCacheRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "response_cache_requests_total",
+			Help: "Total number of response cache lookups by service and result",
+		},
+		[]string{"service", "result"},
+	)
+
+	coalescedRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "coalesced_requests_total",
+			Help: "Total number of coalescing-eligible requests by service and whether they called the backend (leader) or shared a response (shared)",
+		},
+		[]string{"service", "result"},
+	)
+
+	clientBans = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "client_bans_total",
+			Help: "Total number of clients temporarily banned",
+		},
+		[]string{"reason"},
+	)
+
+	bannedRequests = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "banned_requests_total",
+			Help: "Total number of requests refused because the client is banned",
+		},
+	)
+
+	authenticationResults = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "authentication_results_total",
+			Help: "Total number of authentication outcomes by service",
+		},
+		[]string{"service", "result"},
 	)
 
 	authenticationFailures = promauto.NewCounterVec(
@@ -66,6 +138,14 @@ var (
 		},
 		[]string{"backend", "status"},
 	)
+
+	backendRetriesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "backend_retries_total",
+			Help: "Total number of requests resent to backend services after a failed attempt",
+		},
+		[]string{"backend"},
+	)
 )
 
 // Metrics middleware tracks various HTTP metrics
@@ -83,21 +163,52 @@ func Metrics(next http.Handler) http.Handler {
 			statusCode:     http.StatusOK,
 		}
 
+		// Labels carry the route template rather than the raw path, which
+		// keeps cardinality bounded. The proxy fills them in via SetRoute.
+		labels := &routeLabels{route: "unmatched"}
+		r = r.WithContext(context.WithValue(r.Context(), routeLabelsKey{}, labels))
+
 		next.ServeHTTP(mrw, r)
 
 		duration := time.Since(start).Seconds()
 		status := strconv.Itoa(mrw.statusCode)
-		method := r.Method
-
-		// Extract path pattern (simplified)
-		path := getPathLabel(r.URL.Path)
+		method := methodLabel(r.Method)
 
 		// Record metrics
-		httpRequestsTotal.WithLabelValues(method, path, status).Inc()
-		httpRequestDuration.WithLabelValues(method, path, status).Observe(duration)
+		httpRequestsTotal.WithLabelValues(method, labels.service, labels.route, status).Inc()
+		httpRequestDuration.WithLabelValues(method, labels.service, labels.route, status).Observe(duration)
 	})
 }
 
+// methodLabel maps non-standard methods to OTHER so clients cannot create
+// arbitrary label values.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return method
+	default:
+		return "OTHER"
+	}
+}
+
+type routeLabelsKey struct{}
+
+type routeLabels struct {
+	service string
+	route   string
+}
+
+// SetRoute records the service and route template a request matched, for
+// the labels of the Metrics middleware. Requests that never match are
+// labelled route="unmatched".
+func SetRoute(ctx context.Context, service, route string) {
+	if labels, ok := ctx.Value(routeLabelsKey{}).(*routeLabels); ok {
+		labels.service = service
+		labels.route = route
+	}
+}
+
 type metricsResponseWriter struct {
 	http.ResponseWriter
 	statusCode int
@@ -108,18 +219,73 @@ func (mrw *metricsResponseWriter) WriteHeader(code int) {
 	mrw.ResponseWriter.WriteHeader(code)
 }
 
-// getPathLabel returns a simplified path for metrics (replaces IDs with placeholders)
-func getPathLabel(path string) string {
-	// Simple implementation - in production, you might want more sophisticated path normalization
-	if len(path) > 50 {
-		return path[:50] + "..."
+func (mrw *metricsResponseWriter) Flush() {
+	http.NewResponseController(mrw.ResponseWriter).Flush()
+}
+
+func (mrw *metricsResponseWriter) Unwrap() http.ResponseWriter {
+	return mrw.ResponseWriter
+}
+
+// RecordRateLimitHit records a request rejected by a rate limit policy
+func RecordRateLimitHit(policy, service string) {
+	rateLimitHits.WithLabelValues(policy, service).Inc()
+}
+
+// RecordRateLimitShadowHit records a would-be rejection by a shadow-mode policy
+func RecordRateLimitShadowHit(policy, service string) {
+	rateLimitShadowRejections.WithLabelValues(policy, service).Inc()
+}
+
+// RecordIPFilterRejection records a request refused by the IP filter
+func RecordIPFilterRejection(service, reason string) {
+	ipFilterRejections.WithLabelValues(service, reason).Inc()
+}
+
+// RecordAccessDenied records a request refused by an access rule
+func RecordAccessDenied(service, reason string) {
+	accessDenials.WithLabelValues(service, reason).Inc()
+}
+
+// RecordTokenCache records a verified-token cache hit or miss
+func RecordTokenCache(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
 	}
-	return path
+	tokenCacheRequests.WithLabelValues(result).Inc()
 }
 
-// RecordRateLimitHit records when rate limiting occurs
-func RecordRateLimitHit(path string) {
-	rateLimitHits.WithLabelValues(getPathLabel(path)).Inc()
+// RecordCacheResult records how the response cache answered a request: hit,
+// miss, stale, revalidated or bypass.
+func RecordCacheResult(service, result string) {
+	responseCacheRequests.WithLabelValues(service, result).Inc()
+}
+
+// RecordCoalesced records a request that led a backend call or shared the
+// response of one already in flight.
+func RecordCoalesced(service string, shared bool) {
+	result := "leader"
+	if shared {
+		result = "shared"
+	}
+	coalescedRequests.WithLabelValues(service, result).Inc()
+}
+
+// RecordClientBan records a client being banned
+func RecordClientBan(reason string) {
+	clientBans.WithLabelValues(reason).Inc()
+}
+
+// RecordBannedRequest records a request refused from a banned client
+func RecordBannedRequest() {
+	bannedRequests.Inc()
+}
+
+// RecordAuthResult records an authentication outcome: success, failure,
+// denied, anonymous, invalid or skipped
+func RecordAuthResult(service, result string) {
+	authenticationResults.WithLabelValues(service, result).Inc()
 }
 
 // RecordAuthFailure records authentication failures
@@ -127,9 +293,19 @@ func RecordAuthFailure(reason string) {
 	authenticationFailures.WithLabelValues(reason).Inc()
 }
 
-// RecordBackendRequest records requests to backend services
+// RecordBackendRequest records requests to backend services. A zero status
+// means the request failed before a response arrived.
 func RecordBackendRequest(backend string, duration float64, status int) {
 	statusStr := strconv.Itoa(status)
+	if status == 0 {
+		statusStr = "error"
+	}
 	backendRequestsTotal.WithLabelValues(backend, statusStr).Inc()
 	backendRequestDuration.WithLabelValues(backend, statusStr).Observe(duration)
 }
+
+// RecordBackendRetry records a request resent to a backend, such as after
+// a reused keep-alive connection turned out to be closed.
+func RecordBackendRetry(backend string) {
+	backendRetriesTotal.WithLabelValues(backend).Inc()
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics_RouteLabels(t *testing.T) {
+	handler := Metrics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/unknown" {
+			SetRoute(r.Context(), "users", "/api/v1/users/*")
+		}
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	for _, path := range []string{"/api/v1/users/1", "/api/v1/users/2", "/unknown"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("BREW", "/unknown", nil))
+
+	if got := testutil.ToFloat64(httpRequestsTotal.WithLabelValues("GET", "users", "/api/v1/users/*", "418")); got != 2 {
+		t.Errorf("requests for the route template = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(httpRequestsTotal.WithLabelValues("GET", "", "unmatched", "418")); got != 1 {
+		t.Errorf("unmatched requests = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(httpRequestsTotal.WithLabelValues("OTHER", "", "unmatched", "418")); got != 1 {
+		t.Errorf("requests with a custom method = %v, want 1 labelled OTHER", got)
+	}
+}
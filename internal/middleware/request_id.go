@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/utils"
+)
+
+// RequestID assigns every request an ID. A well-formed inbound X-Request-ID
+// is kept, anything else is replaced with a new UUID. The ID is stored in the
+// request context, forwarded upstream and echoed in the response.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(utils.RequestIDHeader)
+		if !utils.ValidRequestID(id) {
+			id = uuid.New().String()
+		}
+		r.Header.Set(utils.RequestIDHeader, id)
+		w.Header().Set(utils.RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(utils.WithRequestID(r.Context(), id)))
+	})
+}
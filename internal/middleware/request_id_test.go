@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/utils"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name    string
+		inbound string
+		keep    bool
+	}{
+		{"generated when missing", "", false},
+		{"inbound kept", "req-123:abc.DEF_9", true},
+		{"invalid characters replaced", "bad id\r\nX-Injected: 1", false},
+		{"overlong replaced", strings.Repeat("a", 129), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ctxID, forwarded string
+			handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ctxID = utils.GetRequestID(r)
+				forwarded = r.Header.Get(utils.RequestIDHeader)
+			}))
+
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.inbound != "" {
+				req.Header.Set(utils.RequestIDHeader, tt.inbound)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			echoed := rec.Header().Get(utils.RequestIDHeader)
+			if echoed == "" || ctxID != echoed || forwarded != echoed {
+				t.Fatalf("context %q, forwarded %q and response %q should match", ctxID, forwarded, echoed)
+			}
+			if (echoed == tt.inbound) != tt.keep {
+				t.Errorf("request ID = %q, inbound %q kept = %v, want %v", echoed, tt.inbound, echoed == tt.inbound, tt.keep)
+			}
+		})
+	}
+}
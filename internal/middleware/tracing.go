@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/tracing"
+)
+
+// Tracing continues the caller's trace, or starts one, with a server span
+// per request. The proxy renames it after the matched route template.
+func Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracing.Tracer().Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(methodLabel(r.Method)),
+				semconv.URLPath(r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		rw := &tracingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(rw, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rw.statusCode))
+		if rw.statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rw.statusCode))
+		}
+	})
+}
+
+type tracingResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (w *tracingResponseWriter) WriteHeader(code int) {
+	w.statusCode = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *tracingResponseWriter) Flush() {
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *tracingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,244 @@
+// Package problem writes RFC 7807 problem details for every error the
+// gateway produces itself. Only the stable code and a safe message reach the
+// client; callers log the underlying error.
+package problem
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/utils"
+)
+
+// Stable error codes. Clients may rely on these; messages may change.
+const (
+	CodeBadRequest         = "bad_request"
+	CodeUnauthorized       = "unauthorized"
+	CodeForbidden          = "forbidden"
+	CodeNotFound           = "not_found"
+	CodeRouteNotFound      = "route_not_found"
+	CodeMethodNotAllowed   = "method_not_allowed"
+	CodePayloadTooLarge    = "payload_too_large"
+	CodeRateLimited        = "rate_limited"
+	CodeInternal           = "internal_error"
+	CodeBadGateway         = "bad_gateway"
+	CodeServiceUnavailable = "service_unavailable"
+	CodeGatewayTimeout     = "gateway_timeout"
+)
+
+const (
+	ContentTypeProblem = "application/problem+json"
+	contentTypeJSON    = "application/json"
+	contentTypeText    = "text/plain"
+)
+
+// Problem is an RFC 7807 problem detail with the gateway's extension members.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	Reason    string `json:"reason,omitempty"` // Finer grained cause, e.g. expired
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// New returns a problem whose title is the standard status text.
+func New(status int, code, detail string) Problem {
+	return Problem{
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   code,
+		Detail: detail,
+	}
+}
+
+// WithReason returns a copy of p carrying a reason code.
+func (p Problem) WithReason(reason string) Problem {
+	p.Reason = reason
+	return p
+}
+
+type errorTemplate interface {
+	Execute(w io.Writer, data any) error
+}
+
+// Writer renders problems, using a service's templates when the client
+// prefers one of their content types.
+type Writer struct {
+	typeBase  string
+	templates map[string]map[string]errorTemplate // service -> content type
+}
+
+func NewWriter(cfg config.ErrorsConfig, services []config.ServiceConfig) (*Writer, error) {
+	w := &Writer{
+		typeBase:  cfg.TypeBaseURL,
+		templates: make(map[string]map[string]errorTemplate),
+	}
+	for _, service := range services {
+		for _, tc := range service.ErrorTemplates {
+			raw, err := os.ReadFile(tc.File)
+			if err != nil {
+				return nil, fmt.Errorf("service %s: %w", service.Name, err)
+			}
+			contentType, _, err := mime.ParseMediaType(tc.ContentType)
+			if err != nil {
+				return nil, fmt.Errorf("service %s: %w", service.Name, err)
+			}
+
+			var tmpl errorTemplate
+			if strings.Contains(contentType, "html") {
+				tmpl, err = htmltemplate.New(tc.File).Parse(string(raw))
+			} else {
+				tmpl, err = texttemplate.New(tc.File).Parse(string(raw))
+			}
+			if err != nil {
+				return nil, fmt.Errorf("service %s: %w", service.Name, err)
+			}
+			if w.templates[service.Name] == nil {
+				w.templates[service.Name] = make(map[string]errorTemplate)
+			}
+			w.templates[service.Name][contentType] = tmpl
+		}
+	}
+	return w, nil
+}
+
+// Write sends p for a request routed to service, which may be empty.
+func (wr *Writer) Write(w http.ResponseWriter, r *http.Request, service string, p Problem) {
+	if p.Type == "" {
+		p.Type = "about:blank"
+		if wr != nil && wr.typeBase != "" {
+			p.Type = wr.typeBase + p.Code
+		}
+	}
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	if p.RequestID == "" {
+		p.RequestID = requestID(r)
+	}
+
+	var templates map[string]errorTemplate
+	if wr != nil {
+		templates = wr.templates[service]
+	}
+	offers := make([]string, 0, len(templates)+3)
+	offers = append(offers, ContentTypeProblem, contentTypeJSON, contentTypeText)
+	for contentType := range templates {
+		offers = append(offers, contentType)
+	}
+	contentType := negotiate(r.Header.Get("Accept"), offers)
+
+	if tmpl, ok := templates[contentType]; ok {
+		var body bytes.Buffer
+		if err := tmpl.Execute(&body, p); err == nil {
+			writeBody(w, p.Status, contentType+"; charset=utf-8", body.Bytes())
+			return
+		}
+		contentType = ContentTypeProblem
+	}
+
+	switch contentType {
+	case contentTypeText:
+		writeBody(w, p.Status, "text/plain; charset=utf-8", []byte(fmt.Sprintf("%s: %s\n", p.Code, p.message())))
+	default:
+		body, _ := json.Marshal(p)
+		writeBody(w, p.Status, contentType, append(body, '\n'))
+	}
+}
+
+// Write sends p without service templates.
+func Write(w http.ResponseWriter, r *http.Request, p Problem) {
+	(*Writer)(nil).Write(w, r, "", p)
+}
+
+func (p Problem) message() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
+
+func writeBody(w http.ResponseWriter, status int, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// requestID returns the ID the gateway assigned to the request, if any.
+func requestID(r *http.Request) string {
+	return utils.GetRequestID(r)
+}
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+	order     int
+}
+
+// negotiate picks the offer the Accept header prefers, falling back to the
+// first offer when nothing matches.
+func negotiate(accept string, offers []string) string {
+	if accept == "" {
+		return offers[0]
+	}
+
+	var ranges []acceptRange
+	for i, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaType: mediaType, q: q, order: i})
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].q != ranges[j].q {
+			return ranges[i].q > ranges[j].q
+		}
+		// Prefer the more specific range on equal weight.
+		return strings.Count(ranges[i].mediaType, "*") < strings.Count(ranges[j].mediaType, "*")
+	})
+
+	for _, ar := range ranges {
+		if ar.q <= 0 {
+			continue
+		}
+		for _, offer := range offers {
+			if mediaMatches(ar.mediaType, offer) {
+				return offer
+			}
+		}
+	}
+	return offers[0]
+}
+
+func mediaMatches(pattern, offer string) bool {
+	if pattern == "*/*" || pattern == offer {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(offer, prefix+"/")
+	}
+	return false
+}
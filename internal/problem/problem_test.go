@@ -0,0 +1,88 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/utils"
+)
+
+func TestWriter_Negotiation(t *testing.T) {
+	tmpl := filepath.Join(t.TempDir(), "error.html")
+	os.WriteFile(tmpl, []byte(`<h1>{{.Title}}</h1><p>{{.Detail}} ({{.Code}})</p>`), 0o600)
+
+	writer, err := NewWriter(config.ErrorsConfig{TypeBaseURL: "https://errors.example.com/"}, []config.ServiceConfig{
+		{Name: "web", ErrorTemplates: []config.ErrorTemplateConfig{{ContentType: "text/html", File: tmpl}}},
+	})
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	pr := New(http.StatusBadGateway, CodeBadGateway, "The upstream service is <unavailable>")
+
+	tests := []struct {
+		name        string
+		service     string
+		accept      string
+		contentType string
+		contains    string
+	}{
+		{"default", "api", "", ContentTypeProblem, `"code":"bad_gateway"`},
+		{"any", "api", "*/*", ContentTypeProblem, `"type":"https://errors.example.com/bad_gateway"`},
+		{"plain json", "api", "application/json", "application/json", `"status":502`},
+		{"text", "api", "text/plain", "text/plain; charset=utf-8", "bad_gateway: The upstream service is <unavailable>"},
+		{"html without template", "api", "text/html", ContentTypeProblem, `"code":"bad_gateway"`},
+		{"browser", "web", "text/html,application/xhtml+xml,*/*;q=0.8", "text/html; charset=utf-8", "&lt;unavailable&gt; (bad_gateway)"},
+		{"weights", "web", "text/html;q=0.5, application/problem+json", ContentTypeProblem, `"code":"bad_gateway"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/orders", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			writer.Write(w, r, tt.service, pr)
+
+			if w.Code != http.StatusBadGateway {
+				t.Errorf("status = %d, want 502", w.Code)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+			if !strings.Contains(w.Body.String(), tt.contains) {
+				t.Errorf("body = %q, want it to contain %q", w.Body.String(), tt.contains)
+			}
+		})
+	}
+}
+
+func TestWrite_ProblemFields(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/orders/7", nil)
+	r = r.WithContext(utils.WithRequestID(r.Context(), "req-1"))
+	w := httptest.NewRecorder()
+	Write(w, r, New(http.StatusUnauthorized, CodeUnauthorized, "Authentication failed").WithReason("expired"))
+
+	var body Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	want := Problem{
+		Type:      "about:blank",
+		Title:     "Unauthorized",
+		Status:    http.StatusUnauthorized,
+		Detail:    "Authentication failed",
+		Instance:  "/api/orders/7",
+		Code:      CodeUnauthorized,
+		Reason:    "expired",
+		RequestID: "req-1",
+	}
+	if body != want {
+		t.Errorf("body = %+v, want %+v", body, want)
+	}
+}
@@ -8,27 +8,46 @@ import (
 )
 
 type ServiceConfig struct {
-	Name     string
-	Target   string
-	Methods  []string
-	Priority int  // Higher number = higher priority
-	SkipAuth bool // If true, skip authentication
+	Name            string
+	Route           string // Route template the service was registered under
+	Target          string
+	Methods         []string
+	SkipAuth        bool   // If true, skip authentication
+	Auth            string // Authentication mode, token, api_key or optional
+	InvalidToken    string // reject or ignore, for optional auth
+	RateLimitPolicy string // Named rate limit policy, empty for the global limit
+	RateLimitKey    string // ip or consumer
+	TokenType       string // Token format accepted by the service
 }
 
+// PriorityRouter matches request paths against route templates. A template
+// segment is a literal, a :name parameter matching one segment, or, as the
+// last segment, a *name catch-all matching the remaining segments, possibly
+// none. Literals take precedence over parameters, and parameters over
+// catch-alls. When no template matches the whole path, the longest template
+// that is a prefix of it matches.
 type PriorityRouter struct {
 	root *RouteNode
 	mu   sync.RWMutex
 }
 
 type RouteNode struct {
-	children   map[string]*RouteNode
-	service    *ServiceConfig
-	isWildcard bool // for * patterns
+	children map[string]*RouteNode // literal segments
+	param    *RouteNode            // :name segment
+	catchAll *RouteNode            // trailing *name segment
+	service  *ServiceConfig
+	params   []string // names of the values captured on the way here
+}
+
+// Match is the result of routing a path.
+type Match struct {
+	Service *ServiceConfig
+	Params  map[string]string // :name and *name values by name
 }
 
 func NewPriorityRouter() *PriorityRouter {
 	return &PriorityRouter{
-		root: &RouteNode{children: make(map[string]*RouteNode)},
+		root: newRouteNode(),
 	}
 }
 
@@ -36,77 +55,138 @@ func (r *PriorityRouter) AddRoute(path string, service *ServiceConfig) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	segments := utils.SplitPath(path)
-	service.Priority = len(segments) // Depth-based priority
-
-	r.insert(r.root, segments, service, 0)
+	service.Route = path
+	r.insert(r.root, utils.SplitPath(path), service, nil)
 }
 
-func (r *PriorityRouter) insert(node *RouteNode, segments []string, service *ServiceConfig, depth int) {
+func (r *PriorityRouter) insert(node *RouteNode, segments []string, service *ServiceConfig, params []string) {
 	if len(segments) == 0 {
 		node.service = service
+		node.params = params
 		return
 	}
 
 	segment := segments[0]
-	isWildcard := strings.HasPrefix(segment, "*") || strings.HasPrefix(segment, ":")
-
-	key := segment
-	if isWildcard {
-		key = "*" // Group wildcards together
-	}
-
-	child, exists := node.children[key]
-	if !exists {
-		child = &RouteNode{
-			children:   make(map[string]*RouteNode),
-			isWildcard: isWildcard,
+	var child *RouteNode
+	switch {
+	case strings.HasPrefix(segment, "*") && len(segments) == 1:
+		if node.catchAll == nil {
+			node.catchAll = newRouteNode()
+		}
+		child = node.catchAll
+		params = append(params, segment[1:])
+	case strings.HasPrefix(segment, ":"), strings.HasPrefix(segment, "*"):
+		// A * before the last segment matches one segment, like :name.
+		if node.param == nil {
+			node.param = newRouteNode()
+		}
+		child = node.param
+		params = append(params, segment[1:])
+	default:
+		child = node.children[segment]
+		if child == nil {
+			child = newRouteNode()
+			node.children[segment] = child
 		}
-		node.children[key] = child
 	}
 
-	r.insert(child, segments[1:], service, depth+1)
+	r.insert(child, segments[1:], service, params)
 }
 
-// FindBestMatch finds the most specific (highest priority) route
-func (r *PriorityRouter) FindBestMatch(path string) *ServiceConfig {
-	segments := utils.SplitPath(path)
-	candidates := r.collectCandidates(r.root, segments, 0, []*ServiceConfig{})
+func newRouteNode() *RouteNode {
+	return &RouteNode{children: make(map[string]*RouteNode)}
+}
+
+// Match finds the most specific route for path, or nil. Prefix matches are
+// only considered when no template matches the whole path.
+func (r *PriorityRouter) Match(path string) *Match {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
-	if len(candidates) == 0 {
+	segments := utils.SplitPath(path)
+	node, values := r.root.match(segments, nil)
+	if node == nil {
+		node, values, _ = r.root.matchPrefix(segments, nil, 0)
+	}
+	if node == nil {
 		return nil
 	}
-
-	// Return the candidate with highest priority (most specific)
-	best := candidates[0]
-	for _, candidate := range candidates[1:] {
-		if candidate.Priority > best.Priority {
-			best = candidate
+	match := &Match{Service: node.service, Params: make(map[string]string, len(node.params))}
+	for i, name := range node.params {
+		if name != "" {
+			match.Params[name] = values[i]
 		}
 	}
-	return best
+	return match
 }
 
-func (r *PriorityRouter) collectCandidates(node *RouteNode, segments []string, depth int, results []*ServiceConfig) []*ServiceConfig {
-	if node.service != nil {
-		results = append(results, node.service)
+// FindBestMatch finds the most specific route
+func (r *PriorityRouter) FindBestMatch(path string) *ServiceConfig {
+	if match := r.Match(path); match != nil {
+		return match.Service
 	}
+	return nil
+}
 
+// match walks literals, then parameters, then the catch-all, backtracking on
+// dead ends. It returns the node whose template matches all of segments and
+// the captured values, or nil.
+func (n *RouteNode) match(segments []string, values []string) (*RouteNode, []string) {
 	if len(segments) == 0 {
-		return results
+		if n.service != nil {
+			return n, values
+		}
+		if n.catchAll != nil && n.catchAll.service != nil {
+			return n.catchAll, capture(values, "")
+		}
+		return nil, nil
 	}
 
-	segment := segments[0]
+	if child, exists := n.children[segments[0]]; exists {
+		if node, captured := child.match(segments[1:], values); node != nil {
+			return node, captured
+		}
+	}
+	if n.param != nil {
+		if node, captured := n.param.match(segments[1:], capture(values, segments[0])); node != nil {
+			return node, captured
+		}
+	}
+	if n.catchAll != nil && n.catchAll.service != nil {
+		return n.catchAll, capture(values, strings.Join(segments, "/"))
+	}
+	return nil, nil
+}
 
-	// Try exact match first
-	if child, exists := node.children[segment]; exists {
-		results = r.collectCandidates(child, segments[1:], depth+1, results)
+// matchPrefix finds the deepest route whose template is a prefix of
+// segments, since templates without a catch-all have always matched as
+// prefixes. Ties go to literals over parameters.
+func (n *RouteNode) matchPrefix(segments []string, values []string, depth int) (*RouteNode, []string, int) {
+	var best *RouteNode
+	var bestValues []string
+	bestDepth := -1
+	if n.service != nil {
+		best, bestValues, bestDepth = n, values, depth
+	}
+	if len(segments) == 0 {
+		return best, bestValues, bestDepth
 	}
 
-	// Try wildcard match
-	if child, exists := node.children["*"]; exists {
-		results = r.collectCandidates(child, segments[1:], depth+1, results)
+	if child, exists := n.children[segments[0]]; exists {
+		if node, captured, d := child.matchPrefix(segments[1:], values, depth+1); node != nil && d > bestDepth {
+			best, bestValues, bestDepth = node, captured, d
+		}
+	}
+	if n.param != nil {
+		if node, captured, d := n.param.matchPrefix(segments[1:], capture(values, segments[0]), depth+1); node != nil && d > bestDepth {
+			best, bestValues, bestDepth = node, captured, d
+		}
 	}
+	return best, bestValues, bestDepth
+}
 
-	return results
+// capture appends value to a copy of values, so sibling branches never share
+// a backing array.
+func capture(values []string, value string) []string {
+	return append(values[:len(values):len(values)], value)
 }
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestPriorityRouter_Match(t *testing.T) {
+	router := NewPriorityRouter()
+	for _, route := range []string{
+		"/*",
+		"/api/users/*",
+		"/api/users/me",
+		"/api/users/:id/posts/:post",
+		"/api/files/*path",
+		"/api/tenants/:tenant/*rest",
+		"/legacy",
+	} {
+		router.AddRoute(route, &ServiceConfig{Name: route})
+	}
+
+	tests := []struct {
+		path   string
+		route  string
+		params map[string]string
+	}{
+		{"/api/users/me", "/api/users/me", map[string]string{}},
+		{"/api/users/42/posts/7", "/api/users/:id/posts/:post", map[string]string{"id": "42", "post": "7"}},
+		{"/api/users/42/posts", "/api/users/*", map[string]string{}},
+		{"/api/users", "/api/users/*", map[string]string{}},
+		{"/api/files/docs/2024/report.pdf", "/api/files/*path", map[string]string{"path": "docs/2024/report.pdf"}},
+		{"/api/files", "/api/files/*path", map[string]string{"path": ""}},
+		{"/api/tenants/acme/users/1", "/api/tenants/:tenant/*rest", map[string]string{"tenant": "acme", "rest": "users/1"}},
+		{"/legacy", "/legacy", map[string]string{}},
+		{"/legacy/anything/below", "/*", map[string]string{}}, // a catch-all beats a prefix
+		{"/other/path", "/*", map[string]string{}},
+		{"/", "/*", map[string]string{}},
+	}
+	for _, tt := range tests {
+		match := router.Match(tt.path)
+		if match == nil {
+			t.Errorf("Match(%q) = nil, want %s", tt.path, tt.route)
+			continue
+		}
+		if match.Service.Name != tt.route || !maps.Equal(match.Params, tt.params) {
+			t.Errorf("Match(%q) = %s %v, want %s %v", tt.path, match.Service.Name, match.Params, tt.route, tt.params)
+		}
+	}
+}
+
+// Without a root catch-all, templates still match as prefixes, but only once
+// no template matches the whole path.
+func TestPriorityRouter_Precedence(t *testing.T) {
+	router := NewPriorityRouter()
+	for _, route := range []string{
+		"/api/users",
+		"/api/:id/details",
+		"/api/:id",
+		"/api/orders/:order/items",
+	} {
+		router.AddRoute(route, &ServiceConfig{Name: route})
+	}
+
+	tests := []struct {
+		path   string
+		route  string
+		params map[string]string
+	}{
+		{"/api/users", "/api/users", map[string]string{}},
+		{"/api/users/details", "/api/:id/details", map[string]string{"id": "users"}},
+		{"/api/42/details", "/api/:id/details", map[string]string{"id": "42"}},
+		{"/api/users/5", "/api/users", map[string]string{}},
+		{"/api/42/other", "/api/:id", map[string]string{"id": "42"}},
+		{"/api/orders/7/items/3", "/api/orders/:order/items", map[string]string{"order": "7"}},
+		{"/api/orders/7/other", "/api/:id", map[string]string{"id": "orders"}},
+	}
+	for _, tt := range tests {
+		match := router.Match(tt.path)
+		if match == nil {
+			t.Errorf("Match(%q) = nil, want %s", tt.path, tt.route)
+			continue
+		}
+		if match.Service.Name != tt.route || !maps.Equal(match.Params, tt.params) {
+			t.Errorf("Match(%q) = %s %v, want %s %v", tt.path, match.Service.Name, match.Params, tt.route, tt.params)
+		}
+	}
+}
+
+func TestPriorityRouter_NoMatch(t *testing.T) {
+	router := NewPriorityRouter()
+	router.AddRoute("/api/users/:id", &ServiceConfig{Name: "users"})
+	if match := router.Match("/api/orders/1"); match != nil {
+		t.Errorf("Match() = %s, want nil", match.Service.Name)
+	}
+	if service := router.FindBestMatch("/api"); service != nil {
+		t.Errorf("FindBestMatch() = %s, want nil", service.Name)
+	}
+}
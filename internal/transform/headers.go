@@ -0,0 +1,253 @@
+// Package transform applies the declarative request and response rewrites
+// configured per service.
+package transform
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+)
+
+// Vars are the request values header templates may reference.
+type Vars struct {
+	ClientIP  string
+	RequestID string
+	// Claim returns the formatted claim at a dotted path, if present.
+	Claim func(path string) (string, bool)
+}
+
+// Headers holds the compiled header rules of every service.
+type Headers struct {
+	request  map[string][]headerRule
+	response map[string][]headerRule
+}
+
+// NewHeaders compiles the header rules of services. Environment variables are
+// read once here, and an unset one is an error. It returns nil when no
+// service has header rules.
+func NewHeaders(services []config.ServiceConfig) (*Headers, error) {
+	h := &Headers{
+		request:  make(map[string][]headerRule),
+		response: make(map[string][]headerRule),
+	}
+	for _, service := range services {
+		for _, rule := range service.Headers.Request {
+			compiled, err := compileHeaderRule(rule)
+			if err != nil {
+				return nil, fmt.Errorf("service %s: request header rule: %w", service.Name, err)
+			}
+			h.request[service.Name] = append(h.request[service.Name], compiled)
+		}
+		for _, rule := range service.Headers.Response {
+			compiled, err := compileHeaderRule(rule)
+			if err != nil {
+				return nil, fmt.Errorf("service %s: response header rule: %w", service.Name, err)
+			}
+			h.response[service.Name] = append(h.response[service.Name], compiled)
+		}
+	}
+	if len(h.request) == 0 && len(h.response) == 0 {
+		return nil, nil
+	}
+	return h, nil
+}
+
+// HasResponseRules reports whether responses of service may be rewritten.
+func (h *Headers) HasResponseRules(service string) bool {
+	return h != nil && len(h.response[service]) > 0
+}
+
+// ApplyRequest rewrites the headers of a request to service.
+func (h *Headers) ApplyRequest(service, method, path string, header http.Header, vars *Vars) {
+	if h == nil {
+		return
+	}
+	apply(h.request[service], method, path, header, vars)
+}
+
+// ApplyResponse rewrites the headers of a response to a request for
+// method and path.
+func (h *Headers) ApplyResponse(service, method, path string, header http.Header, vars *Vars) {
+	if h == nil {
+		return
+	}
+	apply(h.response[service], method, path, header, vars)
+}
+
+type headerRule struct {
+	methods []string
+	paths   []string
+	rename  [][2]string
+	remove  []string
+	set     []headerValue
+	add     []headerValue
+}
+
+type headerValue struct {
+	name  string
+	value template
+}
+
+// Viper lowercases map keys, so header names are canonicalized here.
+func compileHeaderRule(rule config.HeaderRule) (headerRule, error) {
+	compiled := headerRule{methods: rule.Methods, paths: rule.Paths}
+	for from, to := range rule.Rename {
+		compiled.rename = append(compiled.rename, [2]string{http.CanonicalHeaderKey(from), http.CanonicalHeaderKey(to)})
+	}
+	for _, name := range rule.Remove {
+		compiled.remove = append(compiled.remove, http.CanonicalHeaderKey(name))
+	}
+	var err error
+	if compiled.set, err = compileHeaderValues(rule.Set); err != nil {
+		return headerRule{}, err
+	}
+	if compiled.add, err = compileHeaderValues(rule.Add); err != nil {
+		return headerRule{}, err
+	}
+	return compiled, nil
+}
+
+func compileHeaderValues(values map[string]string) ([]headerValue, error) {
+	compiled := make([]headerValue, 0, len(values))
+	for name, value := range values {
+		tmpl, err := parseTemplate(value)
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %w", name, err)
+		}
+		compiled = append(compiled, headerValue{name: http.CanonicalHeaderKey(name), value: tmpl})
+	}
+	// Map order is random; keep the result stable.
+	slices.SortFunc(compiled, func(a, b headerValue) int { return strings.Compare(a.name, b.name) })
+	return compiled, nil
+}
+
+// apply runs the matching rules in order. Within a rule, headers are renamed,
+// removed, set and then added. A value referencing a missing claim is
+// skipped.
+func apply(rules []headerRule, method, path string, header http.Header, vars *Vars) {
+	for _, rule := range rules {
+		if !rule.matches(method, path) {
+			continue
+		}
+		for _, names := range rule.rename {
+			if values := header.Values(names[0]); len(values) > 0 {
+				header.Del(names[0])
+				header[names[1]] = values
+			}
+		}
+		for _, name := range rule.remove {
+			header.Del(name)
+		}
+		for _, hv := range rule.set {
+			if value, ok := hv.value.render(vars); ok {
+				header.Set(hv.name, value)
+			}
+		}
+		for _, hv := range rule.add {
+			if value, ok := hv.value.render(vars); ok {
+				header.Add(hv.name, value)
+			}
+		}
+	}
+}
+
+func (rule headerRule) matches(method, path string) bool {
+	if len(rule.methods) > 0 && !slices.ContainsFunc(rule.methods, func(m string) bool {
+		return strings.EqualFold(m, method)
+	}) {
+		return false
+	}
+	if len(rule.paths) == 0 {
+		return true
+	}
+	for _, pattern := range rule.paths {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		} else if path == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// template is a header value split into literal text and ${...} references.
+type template []templatePart
+
+type templatePart struct {
+	literal  string
+	variable string // client_ip, request_id or claim
+	claim    string
+}
+
+func parseTemplate(value string) (template, error) {
+	var tmpl template
+	for {
+		start := strings.Index(value, "${")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(value[start:], "}")
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated reference in %q", value)
+		}
+		if start > 0 {
+			tmpl = append(tmpl, templatePart{literal: value[:start]})
+		}
+		part, err := parseReference(value[start+2 : start+end])
+		if err != nil {
+			return nil, err
+		}
+		tmpl = append(tmpl, part)
+		value = value[start+end+1:]
+	}
+	if value != "" {
+		tmpl = append(tmpl, templatePart{literal: value})
+	}
+	return tmpl, nil
+}
+
+func parseReference(name string) (templatePart, error) {
+	switch {
+	case name == "client_ip", name == "request_id":
+		return templatePart{variable: name}, nil
+	case strings.HasPrefix(name, "claim.") && len(name) > len("claim."):
+		return templatePart{variable: "claim", claim: strings.TrimPrefix(name, "claim.")}, nil
+	case strings.HasPrefix(name, "env."):
+		env, ok := os.LookupEnv(strings.TrimPrefix(name, "env."))
+		if !ok {
+			return templatePart{}, fmt.Errorf("environment variable %s is not set", strings.TrimPrefix(name, "env."))
+		}
+		return templatePart{literal: env}, nil
+	}
+	return templatePart{}, fmt.Errorf("unknown reference ${%s}", name)
+}
+
+func (t template) render(vars *Vars) (string, bool) {
+	var b strings.Builder
+	for _, part := range t {
+		switch part.variable {
+		case "":
+			b.WriteString(part.literal)
+		case "client_ip":
+			b.WriteString(vars.ClientIP)
+		case "request_id":
+			b.WriteString(vars.RequestID)
+		case "claim":
+			if vars.Claim == nil {
+				return "", false
+			}
+			value, ok := vars.Claim(part.claim)
+			if !ok {
+				return "", false
+			}
+			b.WriteString(value)
+		}
+	}
+	return b.String(), true
+}
@@ -0,0 +1,90 @@
+package transform
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+)
+
+func TestHeaders(t *testing.T) {
+	t.Setenv("BILLING_KEY", "secret")
+	headers, err := NewHeaders([]config.ServiceConfig{{
+		Name: "billing",
+		Headers: config.HeaderRulesConfig{
+			Request: []config.HeaderRule{
+				{
+					Rename: map[string]string{"x-legacy-user": "x-user"},
+					Remove: []string{"cookie"},
+					Set: map[string]string{
+						"x-internal-key": "${env.BILLING_KEY}",
+						"x-caller":       "${claim.sub}@${client_ip}",
+					},
+					Add: map[string]string{"x-trace": "gw-${request_id}"},
+				},
+				{Methods: []string{"POST"}, Paths: []string{"/api/billing/invoices*"}, Set: map[string]string{"x-write": "true"}},
+			},
+			Response: []config.HeaderRule{{Remove: []string{"server"}}},
+		},
+	}})
+	if err != nil {
+		t.Fatalf("NewHeaders() error = %v", err)
+	}
+
+	vars := &Vars{ClientIP: "203.0.113.7", RequestID: "req-1", Claim: func(path string) (string, bool) {
+		return "alice", path == "sub"
+	}}
+	header := http.Header{"X-Legacy-User": {"42"}, "Cookie": {"a=b"}, "X-Trace": {"client"}}
+	headers.ApplyRequest("billing", "GET", "/api/billing/invoices/1", header, vars)
+
+	want := map[string]string{
+		"X-User":         "42",
+		"X-Legacy-User":  "",
+		"Cookie":         "",
+		"X-Internal-Key": "secret",
+		"X-Caller":       "alice@203.0.113.7",
+		"X-Write":        "",
+	}
+	for name, value := range want {
+		if got := header.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+	if got := strings.Join(header.Values("X-Trace"), ","); got != "client,gw-req-1" {
+		t.Errorf("X-Trace = %q, want client,gw-req-1", got)
+	}
+
+	headers.ApplyRequest("billing", "POST", "/api/billing/invoices", header, &Vars{})
+	if header.Get("X-Write") != "true" {
+		t.Error("POST rule did not apply")
+	}
+	if header.Get("X-Caller") != "alice@203.0.113.7" {
+		t.Error("value with a missing claim should be skipped")
+	}
+
+	response := http.Header{"Server": {"nginx"}}
+	headers.ApplyResponse("billing", "GET", "/api/billing", response, vars)
+	if response.Get("Server") != "" {
+		t.Error("Server header was not removed")
+	}
+}
+
+func TestNewHeaders_Invalid(t *testing.T) {
+	for _, value := range []string{"${env.GATEWAY_TEST_UNSET}", "${unknown}", "${client_ip"} {
+		_, err := NewHeaders([]config.ServiceConfig{{
+			Name:    "billing",
+			Headers: config.HeaderRulesConfig{Request: []config.HeaderRule{{Set: map[string]string{"x-value": value}}}},
+		}})
+		if err == nil {
+			t.Errorf("NewHeaders(%q) expected error", value)
+		}
+	}
+}
+
+func TestNewHeaders_Empty(t *testing.T) {
+	headers, err := NewHeaders([]config.ServiceConfig{{Name: "billing"}})
+	if err != nil || headers != nil {
+		t.Errorf("NewHeaders() = %v, %v, want nil", headers, err)
+	}
+}
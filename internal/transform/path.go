@@ -0,0 +1,145 @@
+package transform
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/utils"
+)
+
+var paramReference = regexp.MustCompile(`\$\{param\.([^}]*)\}`)
+
+// Paths holds the path rewrites of every service.
+type Paths struct {
+	rewrites map[string]*PathRewrite
+}
+
+// PathRewrite is the compiled rewrite of one service.
+type PathRewrite struct {
+	strip       []string
+	regex       *regexp.Regexp
+	replacement string
+	addPrefix   string
+}
+
+// NewPaths compiles the path rewrites of services. Parameters referenced by a
+// rewrite must be :name or *name segments of the service's base path. It
+// returns nil when no service rewrites paths.
+func NewPaths(services []config.ServiceConfig) (*Paths, error) {
+	p := &Paths{rewrites: make(map[string]*PathRewrite)}
+	for _, service := range services {
+		rewrite, err := newPathRewrite(service.Rewrite, service.BasePath)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: path rewrite: %w", service.Name, err)
+		}
+		if rewrite != nil {
+			p.rewrites[service.Name] = rewrite
+		}
+	}
+	if len(p.rewrites) == 0 {
+		return nil, nil
+	}
+	return p, nil
+}
+
+// For returns the rewrite of service, or nil.
+func (p *Paths) For(service string) *PathRewrite {
+	if p == nil {
+		return nil
+	}
+	return p.rewrites[service]
+}
+
+func newPathRewrite(cfg config.PathRewriteConfig, basePath string) (*PathRewrite, error) {
+	if cfg == (config.PathRewriteConfig{}) {
+		return nil, nil
+	}
+	rewrite := &PathRewrite{
+		strip:       utils.SplitPath(cfg.StripPrefix),
+		replacement: cfg.Replacement,
+		addPrefix:   strings.TrimSuffix(cfg.AddPrefix, "/"),
+	}
+	if cfg.Regex != "" {
+		regex, err := regexp.Compile(cfg.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex: %w", err)
+		}
+		rewrite.regex = regex
+	} else if cfg.Replacement != "" {
+		return nil, fmt.Errorf("replacement requires regex")
+	}
+
+	var params []string
+	for _, segment := range utils.SplitPath(basePath) {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			params = append(params, segment[1:])
+		}
+	}
+	for _, match := range paramReference.FindAllStringSubmatch(cfg.Replacement+cfg.AddPrefix, -1) {
+		if !slices.Contains(params, match[1]) {
+			return nil, fmt.Errorf("unknown route parameter %q", match[1])
+		}
+	}
+	return rewrite, nil
+}
+
+// Apply returns the escaped path forwarded for the escaped path, given the
+// route parameters of the request. Parameters hold decoded values and are
+// escaped again as they are substituted.
+func (rw *PathRewrite) Apply(path string, params map[string]string) string {
+	if len(rw.strip) > 0 {
+		path = rw.stripPrefix(path)
+	}
+	if rw.regex != nil && rw.regex.MatchString(path) {
+		// Parameter values are substituted first, escaped from Expand.
+		replacement := expandParams(rw.replacement, params, func(value string) string {
+			return strings.ReplaceAll(escapeParam(value), "$", "$$")
+		})
+		path = rw.regex.ReplaceAllString(path, replacement)
+	}
+	if rw.addPrefix != "" {
+		path = expandParams(rw.addPrefix, params, escapeParam) + path
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+// stripPrefix removes the prefix segments, where :name matches any segment.
+// Paths not under the prefix are returned unchanged.
+func (rw *PathRewrite) stripPrefix(path string) string {
+	rest := strings.TrimPrefix(path, "/")
+	for _, segment := range rw.strip {
+		head, tail, _ := strings.Cut(rest, "/")
+		if head == "" || (!strings.HasPrefix(segment, ":") && head != segment) {
+			return path
+		}
+		rest = tail
+	}
+	return "/" + rest
+}
+
+// escapeParam escapes each segment of a parameter value, keeping the slashes
+// of *name parameters.
+func escapeParam(value string) string {
+	segments := strings.Split(value, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func expandParams(s string, params map[string]string, escape func(string) string) string {
+	return paramReference.ReplaceAllStringFunc(s, func(reference string) string {
+		value := params[paramReference.FindStringSubmatch(reference)[1]]
+		if escape != nil {
+			return escape(value)
+		}
+		return value
+	})
+}
@@ -0,0 +1,108 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+)
+
+func TestPathRewrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		basePath string
+		rewrite  config.PathRewriteConfig
+		path     string
+		params   map[string]string
+		want     string
+	}{
+		{
+			name:     "strip prefix",
+			basePath: "/api/v1/users/*",
+			rewrite:  config.PathRewriteConfig{StripPrefix: "/api/v1/users"},
+			path:     "/api/v1/users/42/profile",
+			want:     "/42/profile",
+		},
+		{
+			name:     "strip prefix to root",
+			basePath: "/api/v1/users/*",
+			rewrite:  config.PathRewriteConfig{StripPrefix: "/api/v1/users/"},
+			path:     "/api/v1/users",
+			want:     "/",
+		},
+		{
+			name:     "path outside prefix",
+			basePath: "/api/v1/users/*",
+			rewrite:  config.PathRewriteConfig{StripPrefix: "/api/v1/users"},
+			path:     "/api/v1/usersettings",
+			want:     "/api/v1/usersettings",
+		},
+		{
+			name:     "strip and add prefix",
+			basePath: "/api/v1/users/*",
+			rewrite:  config.PathRewriteConfig{StripPrefix: "/api/v1", AddPrefix: "/internal/"},
+			path:     "/api/v1/users/42",
+			want:     "/internal/users/42",
+		},
+		{
+			name:     "regex with capture groups",
+			basePath: "/api/orders/*",
+			rewrite:  config.PathRewriteConfig{Regex: `^/api/orders/(?P<id>\d+)/items$`, Replacement: "/v2/order-items/${id}"},
+			path:     "/api/orders/7/items",
+			want:     "/v2/order-items/7",
+		},
+		{
+			name:     "regex not matching",
+			basePath: "/api/orders/*",
+			rewrite:  config.PathRewriteConfig{Regex: `^/api/orders/(\d+)$`, Replacement: "/orders/$1"},
+			path:     "/api/orders/latest",
+			want:     "/api/orders/latest",
+		},
+		{
+			name:     "route parameters",
+			basePath: "/api/tenants/:tenant/users/*",
+			rewrite:  config.PathRewriteConfig{StripPrefix: "/api/tenants/:tenant", AddPrefix: "/${param.tenant}"},
+			path:     "/api/tenants/acme/users/1",
+			params:   map[string]string{"tenant": "acme"},
+			want:     "/acme/users/1",
+		},
+		{
+			name:     "route parameters in replacement",
+			basePath: "/api/tenants/:tenant/*",
+			rewrite:  config.PathRewriteConfig{Regex: `^/api/tenants/[^/]+/(.*)$`, Replacement: "/$1/${param.tenant}"},
+			path:     "/api/tenants/a$1/reports",
+			params:   map[string]string{"tenant": "a$1"},
+			want:     "/reports/a$1",
+		},
+		{
+			name:     "escaped path and parameters",
+			basePath: "/api/tenants/:tenant/*",
+			rewrite:  config.PathRewriteConfig{StripPrefix: "/api/tenants/:tenant", AddPrefix: "/${param.tenant}"},
+			path:     "/api/tenants/a%20b/files/x%2Fy",
+			params:   map[string]string{"tenant": "a b"},
+			want:     "/a%20b/files/x%2Fy",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths, err := NewPaths([]config.ServiceConfig{{Name: "svc", BasePath: tt.basePath, Rewrite: tt.rewrite}})
+			if err != nil {
+				t.Fatalf("NewPaths() error = %v", err)
+			}
+			if got := paths.For("svc").Apply(tt.path, tt.params); got != tt.want {
+				t.Errorf("Apply(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPaths_Invalid(t *testing.T) {
+	for name, rewrite := range map[string]config.PathRewriteConfig{
+		"bad regex":         {Regex: "("},
+		"no regex":          {Replacement: "/x"},
+		"unknown parameter": {AddPrefix: "/${param.tenant}"},
+	} {
+		if _, err := NewPaths([]config.ServiceConfig{{Name: "svc", BasePath: "/api/*", Rewrite: rewrite}}); err == nil {
+			t.Errorf("%s: NewPaths() expected error", name)
+		}
+	}
+}
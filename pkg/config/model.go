@@ -1,18 +1,32 @@
 package config
 
 type Config struct {
-	AppEnv    string          `mapstructure:"app_env"`
-	LogLevel  string          `mapstructure:"log_level"`
-	Server    ServerConfig    `mapstructure:"server"`
-	Redis     RedisConfig     `mapstructure:"redis"`
-	Auth      AuthConfig      `mapstructure:"auth"`
-	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
-	Services  []ServiceConfig `mapstructure:"services"`
+	AppEnv      string            `mapstructure:"app_env"`
+	LogLevel    string            `mapstructure:"log_level"`
+	Server      ServerConfig      `mapstructure:"server"`
+	Redis       RedisConfig       `mapstructure:"redis"`
+	Auth        AuthConfig        `mapstructure:"auth"`
+	RateLimit   RateLimitConfig   `mapstructure:"rate_limit"`
+	IPFilter    IPFilterConfig    `mapstructure:"ip_filter"`
+	GeoIP       GeoIPConfig       `mapstructure:"geoip"`
+	Admin       AdminConfig       `mapstructure:"admin"`
+	Ban         BanConfig         `mapstructure:"ban"`
+	Errors      ErrorsConfig      `mapstructure:"errors"`
+	Metrics     MetricsConfig     `mapstructure:"metrics"`
+	Tracing     TracingConfig     `mapstructure:"tracing"`
+	AccessLog   AccessLogConfig   `mapstructure:"access_log"`
+	Cache       CacheConfig       `mapstructure:"cache"`
+	Compression CompressionConfig `mapstructure:"compression"`
+	Services    []ServiceConfig   `mapstructure:"services"`
 }
 
 type ServerConfig struct {
 	Port    int `mapstructure:"port"`
 	Timeout int `mapstructure:"timeout"`
+	// TrustedProxies lists CIDRs or addresses whose forwarding headers and
+	// PROXY protocol headers are believed.
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+	ProxyProtocol  bool     `mapstructure:"proxy_protocol"`
 }
 
 type RedisConfig struct {
@@ -23,20 +37,358 @@ type RedisConfig struct {
 }
 
 type AuthConfig struct {
+	// JWTSecret is the legacy name of PublicKey and is only read when
+	// PublicKey is empty.
 	JWTSecret                  string `mapstructure:"jwt_secret"`
+	PublicKey                  string `mapstructure:"public_key"` // Hex V4 public key for tokens without a kid
 	AccessTokenExpirationTime  int    `mapstructure:"access_token_expiration_time"`
 	RefreshTokenExpirationTime int    `mapstructure:"refresh_token_expiration_time"`
+	// Keys and KeySetFile register additional public keys selected by the
+	// kid in the token footer. Files are re-read when they change.
+	Keys              []KeyConfig `mapstructure:"keys"`
+	KeySetFile        string      `mapstructure:"key_set_file"`
+	KeyRefreshSeconds int         `mapstructure:"key_refresh_seconds"`
+	LocalKey          string      `mapstructure:"local_key"`      // Hex V4 symmetric key for v4.local tokens
+	HMACSecret        string      `mapstructure:"hmac_secret"`    // Shared secret for HS256 JWTs
+	JWTAlgorithms     []string    `mapstructure:"jwt_algorithms"` // Defaults to RS256, ES256, EdDSA (+HS256 with a secret)
+	// Validation holds the token rules every service starts from.
+	Validation TokenValidationConfig `mapstructure:"validation"`
+	Revocation RevocationConfig      `mapstructure:"revocation"`
+	// ReservedHeaders are removed from every inbound request before auth, in
+	// addition to the headers named in ClaimHeaders.
+	ReservedHeaders []string            `mapstructure:"reserved_headers"`
+	ClaimHeaders    []ClaimHeader       `mapstructure:"claim_headers"` // Defaults to the X-User-ID ... X-Exp set
+	APIKeys         APIKeyConfig        `mapstructure:"api_keys"`
+	Introspection   IntrospectionConfig `mapstructure:"introspection"`
+	TokenCache      TokenCacheConfig    `mapstructure:"token_cache"`
 }
 
+// TokenCacheConfig caches the claims of verified tokens until they expire.
+type TokenCacheConfig struct {
+	Enabled    bool `mapstructure:"enabled"`
+	MaxEntries int  `mapstructure:"max_entries"` // Defaults to 10000
+}
+
+// APIKeyConfig controls how services with auth: api_key read keys. Keys are
+// kept in Redis when it is available, otherwise in File.
+type APIKeyConfig struct {
+	Header     string `mapstructure:"header"`      // Defaults to X-API-Key
+	QueryParam string `mapstructure:"query_param"` // Disabled when empty
+	File       string `mapstructure:"file"`
+}
+
+// Service authentication modes.
+const (
+	AuthModeToken  = "token"
+	AuthModeAPIKey = "api_key"
+	// AuthModeOptional forwards the claims of a valid token but lets requests
+	// without one through as anonymous.
+	AuthModeOptional = "optional"
+)
+
+// What optional auth does with a token that fails verification.
+const (
+	InvalidTokenReject = "reject"
+	InvalidTokenIgnore = "ignore"
+)
+
+// Rate limit keys.
+const (
+	RateLimitKeyIP       = "ip"
+	RateLimitKeyConsumer = "consumer"
+)
+
+// ClaimHeader forwards a verified claim (dotted path) as a request header.
+type ClaimHeader struct {
+	Claim  string `mapstructure:"claim"`
+	Header string `mapstructure:"header"`
+}
+
+// RevocationConfig controls checking token sessionId and jti claims against
+// the shared revocation list.
+type RevocationConfig struct {
+	Enabled               bool `mapstructure:"enabled"`
+	CacheStalenessSeconds int  `mapstructure:"cache_staleness_seconds"` // How long a "not revoked" answer is reused
+	CacheSize             int  `mapstructure:"cache_size"`
+	FailClosed            bool `mapstructure:"fail_closed"`         // Reject tokens when the store is unreachable
+	DefaultTTLSeconds     int  `mapstructure:"default_ttl_seconds"` // Revocation lifetime when none is given
+}
+
+// TokenValidationConfig holds the claim rules applied after a token's
+// signature is verified. Service-level values replace the global ones field
+// by field.
+type TokenValidationConfig struct {
+	Issuers          []string `mapstructure:"issuers"`         // Accepted iss values, any if empty
+	Audiences        []string `mapstructure:"audiences"`       // At least one aud must match, any if empty
+	MaxAgeSeconds    int      `mapstructure:"max_age_seconds"` // Maximum time since iat, unlimited if zero
+	ClockSkewSeconds int      `mapstructure:"clock_skew_seconds"`
+	RequiredClaims   []string `mapstructure:"required_claims"`
+}
+
+// Token types a service can accept.
+const (
+	TokenTypePasetoPublic = "paseto_v4_public"
+	TokenTypePasetoLocal  = "paseto_v4_local"
+	TokenTypeJWT          = "jwt"
+	TokenTypeIntrospect   = "oauth2_introspection"
+)
+
+// IntrospectionConfig points opaque OAuth2 tokens at an RFC 7662
+// introspection endpoint.
+type IntrospectionConfig struct {
+	Endpoint             string        `mapstructure:"endpoint"`
+	ClientID             string        `mapstructure:"client_id"` // Sent with HTTP basic auth
+	ClientSecret         string        `mapstructure:"client_secret"`
+	TimeoutSeconds       int           `mapstructure:"timeout_seconds"`
+	CacheSeconds         int           `mapstructure:"cache_seconds"`          // Upper bound for active results, also capped by exp
+	NegativeCacheSeconds int           `mapstructure:"negative_cache_seconds"` // How long inactive results are reused
+	CacheSize            int           `mapstructure:"cache_size"`
+	ClaimHeaders         []ClaimHeader `mapstructure:"claim_headers"` // Defaults to sub, client_id, scope and username
+}
+
+// KeyConfig is a public key given inline as hex or read from a hex or PEM file.
+type KeyConfig struct {
+	KID  string `mapstructure:"kid"`
+	Hex  string `mapstructure:"hex"`
+	File string `mapstructure:"file"`
+}
+
+// Rate limit modes. A policy in shadow mode is evaluated and its would-be
+// rejections are recorded, but traffic is never blocked.
+const (
+	RateLimitModeEnforce = "enforce"
+	RateLimitModeShadow  = "shadow"
+)
+
 type RateLimitConfig struct {
-	RequestsPerSecond int `mapstructure:"requests_per_second"`
-	Burst             int `mapstructure:"burst"`
+	RequestsPerSecond int               `mapstructure:"requests_per_second"`
+	Burst             int               `mapstructure:"burst"`
+	Mode              string            `mapstructure:"mode"`
+	Policies          []RateLimitPolicy `mapstructure:"policies"`
+}
+
+// RateLimitPolicy is a named limit that services opt into through
+// rate_limit_policy. Services without a policy use the global limit.
+type RateLimitPolicy struct {
+	Name              string `mapstructure:"name"`
+	RequestsPerSecond int    `mapstructure:"requests_per_second"`
+	Burst             int    `mapstructure:"burst"`
+	Mode              string `mapstructure:"mode"`
+}
+
+// IPFilterConfig holds CIDR and country allow/deny lists. Deny entries win,
+// and a non-empty allow list refuses everything it does not match.
+type IPFilterConfig struct {
+	Allow          []string `mapstructure:"allow"`
+	Deny           []string `mapstructure:"deny"`
+	AllowCountries []string `mapstructure:"allow_countries"`
+	DenyCountries  []string `mapstructure:"deny_countries"`
+}
+
+type GeoIPConfig struct {
+	DatabasePath string `mapstructure:"database_path"` // MaxMind-format .mmdb file
+}
+
+// AdminConfig controls the /admin API. With Port set it is served on its own
+// listener instead of the gateway port.
+type AdminConfig struct {
+	APIKey string `mapstructure:"api_key"` // Bearer token for /admin endpoints, empty disables them
+	Port   int    `mapstructure:"port"`
+	// DenyListRefreshSeconds is how often instances reload dynamic deny entries from Redis
+	DenyListRefreshSeconds int `mapstructure:"deny_list_refresh_seconds"`
+}
+
+// BanConfig controls automatic temporary bans of clients that keep failing
+// authentication or hitting rate limits. Each repeated ban doubles in length
+// up to MaxBanSeconds while earlier offences are remembered.
+type BanConfig struct {
+	Enabled           bool `mapstructure:"enabled"`
+	Threshold         int  `mapstructure:"threshold"`      // Failures within the window that trigger a ban
+	WindowSeconds     int  `mapstructure:"window_seconds"` // Window over which failures are counted
+	BanSeconds        int  `mapstructure:"ban_seconds"`    // Duration of the first ban
+	MaxBanSeconds     int  `mapstructure:"max_ban_seconds"`
+	OffenceTTLSeconds int  `mapstructure:"offence_ttl_seconds"` // How long a past ban counts towards escalation
+	// LookupCacheSeconds is how long a client found not banned skips the ban
+	// store lookup. Bans placed by other instances apply after at most this.
+	LookupCacheSeconds int `mapstructure:"lookup_cache_seconds"`
 }
 
 type ServiceConfig struct {
-	Name     string   `mapstructure:"name"`
-	BasePath string   `mapstructure:"base_path"`
-	Target   string   `mapstructure:"target"`
-	Methods  []string `mapstructure:"methods"`
-	SkipAuth bool     `mapstructure:"skip_auth"`
+	Name            string                 `mapstructure:"name"`
+	BasePath        string                 `mapstructure:"base_path"`
+	Target          string                 `mapstructure:"target"`
+	Methods         []string               `mapstructure:"methods"`
+	SkipAuth        bool                   `mapstructure:"skip_auth"`
+	Auth            string                 `mapstructure:"auth"`          // token (default), api_key or optional
+	InvalidToken    string                 `mapstructure:"invalid_token"` // reject (default) or ignore, for optional auth
+	RateLimitPolicy string                 `mapstructure:"rate_limit_policy"`
+	RateLimitKey    string                 `mapstructure:"rate_limit_key"` // ip (default) or consumer
+	IPFilter        IPFilterConfig         `mapstructure:"ip_filter"`
+	TokenType       string                 `mapstructure:"token_type"` // Defaults to paseto_v4_public
+	TokenValidation *TokenValidationConfig `mapstructure:"token_validation"`
+	Access          []AccessRule           `mapstructure:"access"`
+	ClaimHeaders    []ClaimHeader          `mapstructure:"claim_headers"` // Replaces auth.claim_headers
+	ErrorTemplates  []ErrorTemplateConfig  `mapstructure:"error_templates"`
+	Cache           ServiceCacheConfig     `mapstructure:"cache"`
+	Coalesce        CoalesceConfig         `mapstructure:"coalesce"`
+	Compress        *bool                  `mapstructure:"compress"` // Overrides compression.enabled
+	Headers         HeaderRulesConfig      `mapstructure:"headers"`
+	Rewrite         PathRewriteConfig      `mapstructure:"rewrite"`
+}
+
+// HeaderRulesConfig rewrites the headers of requests sent to a service and
+// of the responses returned to clients.
+type HeaderRulesConfig struct {
+	Request  []HeaderRule `mapstructure:"request"`
+	Response []HeaderRule `mapstructure:"response"`
+}
+
+// HeaderRule applies to requests matching Methods and Paths, which follow the
+// access rule syntax. Values may reference ${client_ip}, ${request_id},
+// ${claim.<path>} and ${env.<NAME>}.
+type HeaderRule struct {
+	Methods []string          `mapstructure:"methods"`
+	Paths   []string          `mapstructure:"paths"`
+	Rename  map[string]string `mapstructure:"rename"` // old name to new name
+	Remove  []string          `mapstructure:"remove"`
+	Set     map[string]string `mapstructure:"set"`
+	Add     map[string]string `mapstructure:"add"`
+}
+
+// PathRewriteConfig changes the path forwarded to a service. The steps run
+// in the order strip_prefix, regex, add_prefix; the query is kept.
+type PathRewriteConfig struct {
+	StripPrefix string `mapstructure:"strip_prefix"` // may contain :param segments
+	Regex       string `mapstructure:"regex"`
+	Replacement string `mapstructure:"replacement"` // $1, ${name} and ${param.<name>}
+	AddPrefix   string `mapstructure:"add_prefix"`  // may reference ${param.<name>}
+}
+
+// ErrorTemplateConfig renders gateway errors with a Go template when the
+// client prefers ContentType. The template receives the problem details.
+type ErrorTemplateConfig struct {
+	ContentType string `mapstructure:"content_type"`
+	File        string `mapstructure:"file"`
+}
+
+// MetricsConfig controls the Prometheus endpoint. With Port set it is served
+// on its own listener instead of the gateway port.
+type MetricsConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Path    string `mapstructure:"path"` // Defaults to /metrics
+	Port    int    `mapstructure:"port"`
+}
+
+// TracingConfig controls OpenTelemetry span export.
+type TracingConfig struct {
+	Enabled     bool    `mapstructure:"enabled"`
+	Exporter    string  `mapstructure:"exporter"` // otlp (default) or stdout
+	Endpoint    string  `mapstructure:"endpoint"` // OTLP/HTTP collector host:port, defaults to localhost:4318
+	Insecure    bool    `mapstructure:"insecure"`
+	SampleRatio float64 `mapstructure:"sample_ratio"` // Share of new traces sampled, defaults to 1
+	ServiceName string  `mapstructure:"service_name"`
+}
+
+// Access log formats.
+const (
+	AccessLogFormatJSON     = "json"
+	AccessLogFormatCombined = "combined"
+	AccessLogFormatOff      = "off"
+)
+
+// AccessLogConfig controls the single record written for each request.
+type AccessLogConfig struct {
+	Format string `mapstructure:"format"` // json (default), combined or off
+	Output string `mapstructure:"output"` // stdout (default), stderr or a file path
+	// Fields limits the JSON record to these fields, all when empty.
+	Fields []string `mapstructure:"fields"`
+	// Sampling maps a status ("404") or class ("2xx") to the share of
+	// records kept. Unlisted statuses are always logged.
+	Sampling map[string]float64 `mapstructure:"sampling"`
+	// Headers are request headers copied into the record. Values of
+	// RedactHeaders are masked in addition to credentials and cookies.
+	Headers       []string            `mapstructure:"headers"`
+	RedactHeaders []string            `mapstructure:"redact_headers"`
+	Body          AccessLogBodyConfig `mapstructure:"body"`
+}
+
+// AccessLogBodyConfig enables request body capture. Only the first MaxBytes
+// are kept, as the body streams to the backend.
+type AccessLogBodyConfig struct {
+	Enabled  bool `mapstructure:"enabled"`
+	MaxBytes int  `mapstructure:"max_bytes"` // Defaults to 4096
+	// RedactFields are JSON and form fields masked in addition to the
+	// default password, token and secret fields.
+	RedactFields []string `mapstructure:"redact_fields"`
+	// LogTypes are media types, or "text/*" style ranges, whose bodies are
+	// logged as is. Other bodies cannot be redacted and are left out.
+	LogTypes []string `mapstructure:"log_types"`
+}
+
+// CacheConfig sizes the response cache shared by services with caching
+// enabled. Redis is used when configured.
+type CacheConfig struct {
+	MaxEntries   int   `mapstructure:"max_entries"`    // In-memory store, defaults to 10000
+	MaxBytes     int64 `mapstructure:"max_bytes"`      // In-memory store body total, defaults to 256 MiB
+	MaxBodyBytes int   `mapstructure:"max_body_bytes"` // Larger responses are not stored, defaults to 1 MiB
+}
+
+// ServiceCacheConfig caches GET responses of a service. Backend
+// Cache-Control and Expires headers take precedence over these defaults.
+type ServiceCacheConfig struct {
+	Enabled    bool `mapstructure:"enabled"`
+	TTLSeconds int  `mapstructure:"ttl_seconds"` // Freshness when the backend sends none
+	// KeyHeaders are request headers whose values are part of the cache key.
+	KeyHeaders []string `mapstructure:"key_headers"`
+	// PerUser keys entries by the caller's credentials, allowing responses to
+	// authenticated requests to be stored.
+	PerUser                     bool `mapstructure:"per_user"`
+	StaleWhileRevalidateSeconds int  `mapstructure:"stale_while_revalidate_seconds"`
+	StaleIfErrorSeconds         int  `mapstructure:"stale_if_error_seconds"`
+}
+
+// CoalesceConfig collapses identical concurrent GET and HEAD requests into
+// one backend call whose response is shared by all of them.
+type CoalesceConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// KeyHeaders are request headers that must also match, besides method,
+	// path, query, credentials and conditional headers.
+	KeyHeaders   []string `mapstructure:"key_headers"`
+	MaxBodyBytes int      `mapstructure:"max_body_bytes"` // Larger responses are not shared, defaults to 1 MiB
+}
+
+// CompressionConfig controls response compression and decompression of
+// encoded request bodies.
+type CompressionConfig struct {
+	Enabled   bool     `mapstructure:"enabled"`
+	Encodings []string `mapstructure:"encodings"` // Server preference, defaults to zstd, br, gzip
+	MinSize   int      `mapstructure:"min_size"`  // Smaller responses are sent as is, defaults to 1024
+	// Types lists compressible media types; "text/*" matches a whole type.
+	Types              []string `mapstructure:"types"`
+	DecompressRequests bool     `mapstructure:"decompress_requests"`
+	MaxRequestBytes    int64    `mapstructure:"max_request_bytes"` // Decompressed body limit, defaults to 10 MiB
+}
+
+// ErrorsConfig controls the problem+json error responses.
+type ErrorsConfig struct {
+	TypeBaseURL string `mapstructure:"type_base_url"` // type is this plus the error code, about:blank when empty
+}
+
+// AccessRule applies to requests matching Methods and Paths (all when empty).
+// Paths ending in "*" match by prefix.
+type AccessRule struct {
+	Methods []string         `mapstructure:"methods"`
+	Paths   []string         `mapstructure:"paths"`
+	Scopes  []string         `mapstructure:"scopes"` // all required
+	Roles   []string         `mapstructure:"roles"`  // any one required
+	Admin   bool             `mapstructure:"admin"`  // requires isAdmin
+	Claims  []ClaimCondition `mapstructure:"claims"`
+}
+
+// ClaimCondition requires the claim at a dotted path to equal Equals or one
+// of In.
+type ClaimCondition struct {
+	Claim  string   `mapstructure:"claim"`
+	Equals string   `mapstructure:"equals"`
+	In     []string `mapstructure:"in"`
 }
@@ -0,0 +1,50 @@
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Reader resolves client addresses to ISO 3166-1 country codes using a local
+// MaxMind-format (.mmdb) database such as GeoLite2-Country.
+type Reader struct {
+	db *maxminddb.Reader
+}
+
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+func Open(path string) (*Reader, error) {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open geoip database: %w", err)
+	}
+	return &Reader{db: db}, nil
+}
+
+// Country returns the upper-case country code for addr, or an empty string
+// when the database has no entry for it.
+func (r *Reader) Country(addr netip.Addr) (string, error) {
+	var record countryRecord
+	if err := r.db.Lookup(net.IP(addr.AsSlice()), &record); err != nil {
+		return "", err
+	}
+	if record.Country.ISOCode != "" {
+		return strings.ToUpper(record.Country.ISOCode), nil
+	}
+	return strings.ToUpper(record.RegisteredCountry.ISOCode), nil
+}
+
+func (r *Reader) Close() error {
+	return r.db.Close()
+}
@@ -0,0 +1,193 @@
+package ipfilter
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+	rds "github.com/mtsgn/mtsgn-system-gateway-svc/pkg/redis"
+)
+
+// Reason codes returned to clients and used as metric labels.
+const (
+	ReasonDynamicDeny       = "dynamic_deny"
+	ReasonIPDenied          = "ip_denied"
+	ReasonIPNotAllowed      = "ip_not_allowed"
+	ReasonCountryDenied     = "country_denied"
+	ReasonCountryNotAllowed = "country_not_allowed"
+)
+
+// CountryLookup resolves an address to an ISO country code.
+type CountryLookup interface {
+	Country(addr netip.Addr) (string, error)
+}
+
+// Rules is one set of static allow/deny lists. Deny entries win over allow
+// entries, and a non-empty allow list refuses everything it does not match.
+type Rules struct {
+	allow          []netip.Prefix
+	deny           []netip.Prefix
+	allowCountries map[string]struct{}
+	denyCountries  map[string]struct{}
+}
+
+func NewRules(cfg config.IPFilterConfig) (*Rules, error) {
+	rules := &Rules{
+		allowCountries: countrySet(cfg.AllowCountries),
+		denyCountries:  countrySet(cfg.DenyCountries),
+	}
+	for _, entry := range cfg.Allow {
+		prefix, err := rds.ParseDenyEntry(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allow entry: %w", err)
+		}
+		rules.allow = append(rules.allow, prefix)
+	}
+	for _, entry := range cfg.Deny {
+		prefix, err := rds.ParseDenyEntry(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deny entry: %w", err)
+		}
+		rules.deny = append(rules.deny, prefix)
+	}
+	return rules, nil
+}
+
+func (r *Rules) empty() bool {
+	return len(r.allow) == 0 && len(r.deny) == 0 && len(r.allowCountries) == 0 && len(r.denyCountries) == 0
+}
+
+func (r *Rules) usesCountries() bool {
+	return len(r.allowCountries) > 0 || len(r.denyCountries) > 0
+}
+
+// allows reports whether the rules only let listed addresses or countries
+// through.
+func (r *Rules) allows() bool {
+	return len(r.allow) > 0 || len(r.allowCountries) > 0
+}
+
+// check returns a reason code when addr is refused. country is only
+// consulted when country rules exist; an unknown country fails an allow list.
+func (r *Rules) check(addr netip.Addr, country string) string {
+	if containsAddr(r.deny, addr) {
+		return ReasonIPDenied
+	}
+	if len(r.allow) > 0 && !containsAddr(r.allow, addr) {
+		return ReasonIPNotAllowed
+	}
+	if _, denied := r.denyCountries[country]; denied && country != "" {
+		return ReasonCountryDenied
+	}
+	if len(r.allowCountries) > 0 {
+		if _, allowed := r.allowCountries[country]; !allowed {
+			return ReasonCountryNotAllowed
+		}
+	}
+	return ""
+}
+
+// Filter evaluates the dynamic deny list, the global rules and then the rules
+// of the matched service.
+type Filter struct {
+	global    *Rules
+	services  map[string]*Rules
+	countries CountryLookup
+	denyList  rds.DenyList
+}
+
+func NewFilter(cfg *config.Config, countries CountryLookup, denyList rds.DenyList) (*Filter, error) {
+	global, err := NewRules(cfg.IPFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &Filter{
+		global:    global,
+		services:  make(map[string]*Rules),
+		countries: countries,
+		denyList:  denyList,
+	}
+	for _, service := range cfg.Services {
+		rules, err := NewRules(service.IPFilter)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", service.Name, err)
+		}
+		if !rules.empty() {
+			filter.services[service.Name] = rules
+		}
+	}
+
+	if filter.countries == nil && filter.usesCountries() {
+		return nil, fmt.Errorf("country rules are configured but no geoip database is set")
+	}
+	return filter, nil
+}
+
+func (f *Filter) usesCountries() bool {
+	if f.global.usesCountries() {
+		return true
+	}
+	for _, rules := range f.services {
+		if rules.usesCountries() {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns the reason code for refusing ip on service, or an empty
+// string when the request may proceed. An address that cannot be parsed is
+// refused whenever an allow list applies.
+func (f *Filter) Check(ip string, service string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		if serviceRules := f.services[service]; f.global.allows() || (serviceRules != nil && serviceRules.allows()) {
+			return ReasonIPNotAllowed
+		}
+		return ""
+	}
+	addr = addr.Unmap()
+
+	if f.denyList != nil {
+		if _, denied := f.denyList.Match(addr); denied {
+			return ReasonDynamicDeny
+		}
+	}
+
+	serviceRules := f.services[service]
+	if f.global.empty() && serviceRules == nil {
+		return ""
+	}
+
+	country := ""
+	if f.countries != nil && (f.global.usesCountries() || (serviceRules != nil && serviceRules.usesCountries())) {
+		country, _ = f.countries.Country(addr)
+	}
+
+	if reason := f.global.check(addr, country); reason != "" {
+		return reason
+	}
+	if serviceRules != nil {
+		return serviceRules.check(addr, country)
+	}
+	return ""
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func countrySet(codes []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(codes))
+	for _, code := range codes {
+		set[strings.ToUpper(strings.TrimSpace(code))] = struct{}{}
+	}
+	return set
+}
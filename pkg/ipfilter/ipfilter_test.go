@@ -0,0 +1,91 @@
+package ipfilter
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/mtsgn/mtsgn-system-gateway-svc/pkg/config"
+	rds "github.com/mtsgn/mtsgn-system-gateway-svc/pkg/redis"
+)
+
+type staticCountries map[string]string
+
+func (s staticCountries) Country(addr netip.Addr) (string, error) {
+	return s[addr.String()], nil
+}
+
+func TestFilter_Check(t *testing.T) {
+	cfg := &config.Config{
+		IPFilter: config.IPFilterConfig{
+			Deny:          []string{"203.0.113.0/24"},
+			DenyCountries: []string{"xx"},
+		},
+		Services: []config.ServiceConfig{
+			{
+				Name: "admin",
+				IPFilter: config.IPFilterConfig{
+					Allow: []string{"10.0.0.0/8", "2001:db8::/32"},
+				},
+			},
+			{
+				Name: "regional",
+				IPFilter: config.IPFilterConfig{
+					AllowCountries: []string{"KR", "VN"},
+				},
+			},
+		},
+	}
+	countries := staticCountries{
+		"198.51.100.1": "XX",
+		"198.51.100.2": "KR",
+		"198.51.100.3": "US",
+	}
+	denyList := rds.NewLocalDenyList()
+	if err := denyList.Add(context.Background(), "192.0.2.9", time.Minute, "abuse"); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	filter, err := NewFilter(cfg, countries, denyList)
+	if err != nil {
+		t.Fatalf("NewFilter() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		ip      string
+		service string
+		want    string
+	}{
+		{name: "unrestricted service", ip: "192.0.2.1", service: "public", want: ""},
+		{name: "global deny", ip: "203.0.113.5", service: "public", want: ReasonIPDenied},
+		{name: "global deny wins over service allow", ip: "203.0.113.5", service: "admin", want: ReasonIPDenied},
+		{name: "dynamic deny", ip: "192.0.2.9", service: "public", want: ReasonDynamicDeny},
+		{name: "country denied", ip: "198.51.100.1", service: "public", want: ReasonCountryDenied},
+		{name: "service allow list hit", ip: "10.1.2.3", service: "admin", want: ""},
+		{name: "service allow list hit ipv6", ip: "2001:db8::5", service: "admin", want: ""},
+		{name: "service allow list miss", ip: "192.0.2.1", service: "admin", want: ReasonIPNotAllowed},
+		{name: "service country allowed", ip: "198.51.100.2", service: "regional", want: ""},
+		{name: "service country not allowed", ip: "198.51.100.3", service: "regional", want: ReasonCountryNotAllowed},
+		{name: "unknown country fails allow list", ip: "192.0.2.1", service: "regional", want: ReasonCountryNotAllowed},
+		{name: "unparseable address fails allow list", ip: "not-an-ip", service: "admin", want: ReasonIPNotAllowed},
+		{name: "unparseable address fails country allow list", ip: "", service: "regional", want: ReasonIPNotAllowed},
+		{name: "unparseable address without allow list", ip: "not-an-ip", service: "public", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filter.Check(tt.ip, tt.service); got != tt.want {
+				t.Errorf("Check(%s, %s) = %q, want %q", tt.ip, tt.service, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewFilter_CountryRulesWithoutDatabase(t *testing.T) {
+	cfg := &config.Config{IPFilter: config.IPFilterConfig{DenyCountries: []string{"XX"}}}
+	if _, err := NewFilter(cfg, nil, nil); err == nil {
+		t.Error("NewFilter() expected error when country rules have no database")
+	}
+}
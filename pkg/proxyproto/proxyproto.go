@@ -0,0 +1,228 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// v2Signature prefixes every PROXY protocol v2 header.
+var v2Signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+const (
+	v1MaxLength          = 107
+	defaultHeaderTimeout = 5 * time.Second
+)
+
+var ErrInvalidHeader = errors.New("invalid PROXY protocol header")
+
+// Listener accepts connections that are prefixed with a PROXY protocol v1 or
+// v2 header. Only peers accepted by the trust function may send a header; for
+// them it is mandatory, and connections from any other peer are served as-is.
+type Listener struct {
+	net.Listener
+	trusted       func(netip.Addr) bool
+	headerTimeout time.Duration
+}
+
+func NewListener(inner net.Listener, trusted func(netip.Addr) bool) *Listener {
+	return &Listener{
+		Listener:      inner,
+		trusted:       trusted,
+		headerTimeout: defaultHeaderTimeout,
+	}
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	peer, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok || l.trusted == nil || !l.trusted(peer.AddrPort().Addr().Unmap()) {
+		return conn, nil
+	}
+
+	// The header is read lazily so a slow peer cannot stall the accept loop.
+	return &Conn{
+		Conn:          conn,
+		reader:        bufio.NewReader(conn),
+		headerTimeout: l.headerTimeout,
+	}, nil
+}
+
+// Conn reports the source address carried in the PROXY header as its
+// RemoteAddr.
+type Conn struct {
+	net.Conn
+	reader        *bufio.Reader
+	headerTimeout time.Duration
+
+	once       sync.Once
+	remoteAddr net.Addr
+	err        error
+
+	// readDeadline is the last read deadline set by the caller, which
+	// readHeader restores since net.Conn cannot report it.
+	mu           sync.Mutex
+	readDeadline time.Time
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *Conn) readHeader() {
+	if c.headerTimeout > 0 {
+		c.mu.Lock()
+		deadline := time.Now().Add(c.headerTimeout)
+		if !c.readDeadline.IsZero() && c.readDeadline.Before(deadline) {
+			deadline = c.readDeadline
+		}
+		c.Conn.SetReadDeadline(deadline)
+		c.mu.Unlock()
+		defer func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.Conn.SetReadDeadline(c.readDeadline)
+		}()
+	}
+
+	prefix, err := c.reader.Peek(5)
+	if err != nil {
+		c.err = err
+		return
+	}
+
+	switch {
+	case string(prefix) == "PROXY":
+		c.remoteAddr, c.err = readV1(c.reader)
+	case bytes.Equal(prefix, v2Signature[:5]):
+		c.remoteAddr, c.err = readV2(c.reader)
+	default:
+		c.err = fmt.Errorf("%w: missing header from trusted peer", ErrInvalidHeader)
+	}
+}
+
+// readV1 parses "PROXY TCP4|TCP6|UNKNOWN src dst sport dport\r\n". A nil
+// address means the connection's own peer address applies.
+func readV1(reader *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < v1MaxLength {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("%w: v1 header too long", ErrInvalidHeader)
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("%w: malformed v1 header", ErrInvalidHeader)
+	}
+
+	addr, err := netip.ParseAddr(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad source address: %v", ErrInvalidHeader, err)
+	}
+	if (fields[1] == "TCP4") != addr.Is4() {
+		return nil, fmt.Errorf("%w: address family mismatch", ErrInvalidHeader)
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad source port: %v", ErrInvalidHeader, err)
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, uint16(port))), nil
+}
+
+// readV2 parses the binary v2 header. LOCAL commands and unsupported address
+// families keep the connection's own peer address; TLVs are skipped.
+func readV2(reader *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[:12], v2Signature) {
+		return nil, fmt.Errorf("%w: bad v2 signature", ErrInvalidHeader)
+	}
+	if header[12]>>4 != 2 {
+		return nil, fmt.Errorf("%w: unsupported version", ErrInvalidHeader)
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, err
+	}
+
+	command := header[12] & 0x0F
+	if command == 0x0 { // LOCAL: health checks from the proxy itself
+		return nil, nil
+	}
+	if command != 0x1 {
+		return nil, fmt.Errorf("%w: unsupported command", ErrInvalidHeader)
+	}
+
+	switch header[13] >> 4 {
+	case 0x1: // AF_INET
+		if len(payload) < 12 {
+			return nil, fmt.Errorf("%w: short IPv4 address block", ErrInvalidHeader)
+		}
+		addr := netip.AddrFrom4([4]byte(payload[0:4]))
+		port := binary.BigEndian.Uint16(payload[8:10])
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, port)), nil
+	case 0x2: // AF_INET6
+		if len(payload) < 36 {
+			return nil, fmt.Errorf("%w: short IPv6 address block", ErrInvalidHeader)
+		}
+		addr := netip.AddrFrom16([16]byte(payload[0:16])).Unmap()
+		port := binary.BigEndian.Uint16(payload[32:34])
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, port)), nil
+	default:
+		return nil, nil
+	}
+}
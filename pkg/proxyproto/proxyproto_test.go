@@ -0,0 +1,163 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestReadV1(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		want    string
+		wantErr bool
+	}{
+		{name: "tcp4", header: "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n", want: "192.0.2.1:56324"},
+		{name: "tcp6", header: "PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n", want: "[2001:db8::1]:56324"},
+		{name: "unknown", header: "PROXY UNKNOWN\r\n"},
+		{name: "family mismatch", header: "PROXY TCP4 2001:db8::1 2001:db8::2 1 2\r\n", wantErr: true},
+		{name: "missing crlf", header: "PROXY TCP4 192.0.2.1 192.0.2.2 1 2\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, err := readV1(bufio.NewReader(bytes.NewBufferString(tt.header + "GET / HTTP/1.1\r\n")))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readV1() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := ""
+			if addr != nil {
+				got = addr.String()
+			}
+			if got != tt.want {
+				t.Errorf("readV1() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadV2(t *testing.T) {
+	payload := make([]byte, 12)
+	copy(payload[0:4], []byte{198, 51, 100, 4})
+	copy(payload[4:8], []byte{10, 0, 0, 1})
+	binary.BigEndian.PutUint16(payload[8:10], 40000)
+	binary.BigEndian.PutUint16(payload[10:12], 443)
+
+	header := append([]byte{}, v2Signature...)
+	header = append(header, 0x21, 0x11, 0, byte(len(payload)))
+	header = append(header, payload...)
+
+	addr, err := readV2(bufio.NewReader(bytes.NewReader(header)))
+	if err != nil {
+		t.Fatalf("readV2() error = %v", err)
+	}
+	if addr.String() != "198.51.100.4:40000" {
+		t.Errorf("readV2() = %q, want 198.51.100.4:40000", addr.String())
+	}
+}
+
+func TestListener(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() error = %v", err)
+	}
+	defer inner.Close()
+
+	listener := NewListener(inner, func(addr netip.Addr) bool { return addr.IsLoopback() })
+
+	go func() {
+		client, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			return
+		}
+		defer client.Close()
+		client.Write([]byte("PROXY TCP4 203.0.113.9 127.0.0.1 1234 80\r\nhello"))
+	}()
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept() error = %v", err)
+	}
+	defer conn.Close()
+
+	body, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if string(body) != "hello" {
+		t.Errorf("body = %q, want hello", body)
+	}
+	if got := conn.RemoteAddr().String(); got != "203.0.113.9:1234" {
+		t.Errorf("RemoteAddr() = %q, want 203.0.113.9:1234", got)
+	}
+}
+
+func TestListener_MissingHeader(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() error = %v", err)
+	}
+	defer inner.Close()
+
+	listener := NewListener(inner, func(addr netip.Addr) bool { return true })
+
+	go func() {
+		client, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			return
+		}
+		defer client.Close()
+		client.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	}()
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept() error = %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Read(make([]byte, 10)); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("Read() error = %v, want ErrInvalidHeader", err)
+	}
+}
+
+// deadlineConn records the read deadline last applied to the connection.
+type deadlineConn struct {
+	net.Conn
+	readDeadline time.Time
+}
+
+func (c *deadlineConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline = t
+	return c.Conn.SetReadDeadline(t)
+}
+
+func TestConn_RestoresReadDeadline(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	go client.Write([]byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\nGET"))
+
+	inner := &deadlineConn{Conn: server}
+	conn := &Conn{Conn: inner, reader: bufio.NewReader(inner), headerTimeout: time.Minute}
+
+	// Set by http.Server before the first read
+	deadline := time.Now().Add(time.Hour)
+	conn.SetReadDeadline(deadline)
+	if _, err := conn.Read(make([]byte, 3)); err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if !inner.readDeadline.Equal(deadline) {
+		t.Errorf("read deadline = %v after the header, want %v", inner.readDeadline, deadline)
+	}
+}
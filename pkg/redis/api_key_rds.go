@@ -0,0 +1,220 @@
+package rds
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// APIKey describes a consumer key. Only the SHA-256 hash of the key is stored.
+type APIKey struct {
+	Hash      string    `json:"hash"`
+	Owner     string    `json:"owner"`
+	Scopes    []string  `json:"scopes,omitempty"`
+	Plan      string    `json:"plan,omitempty"`       // Rate limit policy name
+	ExpiresAt time.Time `json:"expires_at,omitempty"` // Zero means no expiry
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Expired reports whether the key has an expiry at or before now.
+func (k APIKey) Expired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt)
+}
+
+// APIKeyStore looks up API keys by hash.
+type APIKeyStore interface {
+	Get(ctx context.Context, hash string) (APIKey, bool, error)
+	Put(ctx context.Context, key APIKey) error
+	Delete(ctx context.Context, hash string) error
+	List(ctx context.Context) ([]APIKey, error)
+}
+
+// -------------------- redis api key store ---------------------------- //
+
+// RedisAPIKeyStore keeps keys in a single hash shared by all instances.
+type RedisAPIKeyStore struct {
+	client *redis.Client
+	key    string
+}
+
+func NewRedisAPIKeyStore(client *RedisClient) *RedisAPIKeyStore {
+	return &RedisAPIKeyStore{
+		client: client.client,
+		key:    "api_keys",
+	}
+}
+
+func (s *RedisAPIKeyStore) Get(ctx context.Context, hash string) (APIKey, bool, error) {
+	raw, err := s.client.HGet(ctx, s.key, hash).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return APIKey{}, false, nil
+	}
+	if err != nil {
+		return APIKey{}, false, err
+	}
+
+	var key APIKey
+	if err := json.Unmarshal(raw, &key); err != nil {
+		return APIKey{}, false, err
+	}
+	return key, true, nil
+}
+
+func (s *RedisAPIKeyStore) Put(ctx context.Context, key APIKey) error {
+	raw, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	return s.client.HSet(ctx, s.key, key.Hash, raw).Err()
+}
+
+func (s *RedisAPIKeyStore) Delete(ctx context.Context, hash string) error {
+	return s.client.HDel(ctx, s.key, hash).Err()
+}
+
+func (s *RedisAPIKeyStore) List(ctx context.Context) ([]APIKey, error) {
+	values, err := s.client.HGetAll(ctx, s.key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]APIKey, 0, len(values))
+	for _, raw := range values {
+		var key APIKey
+		if err := json.Unmarshal([]byte(raw), &key); err != nil {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sortAPIKeys(keys)
+	return keys, nil
+}
+
+// -------------------- local api key store ---------------------------- //
+
+// LocalAPIKeyStore keeps keys in memory, loaded from and saved to an optional
+// JSON file holding a list of APIKey records.
+type LocalAPIKeyStore struct {
+	mu   sync.RWMutex
+	path string
+	keys map[string]APIKey
+}
+
+func NewLocalAPIKeyStore(path string) (*LocalAPIKeyStore, error) {
+	store := &LocalAPIKeyStore{
+		path: path,
+		keys: make(map[string]APIKey),
+	}
+	if path == "" {
+		return store, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []APIKey
+	if err := json.Unmarshal(raw, &keys); err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		store.keys[key.Hash] = key
+	}
+	return store, nil
+}
+
+func (s *LocalAPIKeyStore) Get(ctx context.Context, hash string) (APIKey, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[hash]
+	return key, ok, nil
+}
+
+func (s *LocalAPIKeyStore) Put(ctx context.Context, key APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := maps.Clone(s.keys)
+	keys[key.Hash] = key
+	return s.swap(keys)
+}
+
+func (s *LocalAPIKeyStore) Delete(ctx context.Context, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := maps.Clone(s.keys)
+	delete(keys, hash)
+	return s.swap(keys)
+}
+
+// swap saves keys and only then serves them, so that memory never holds a
+// change the file does not; callers hold the write lock.
+func (s *LocalAPIKeyStore) swap(keys map[string]APIKey) error {
+	if err := s.save(keys); err != nil {
+		return err
+	}
+	s.keys = keys
+	return nil
+}
+
+func (s *LocalAPIKeyStore) List(ctx context.Context) ([]APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	sortAPIKeys(keys)
+	return keys, nil
+}
+
+// save writes the file atomically.
+func (s *LocalAPIKeyStore) save(byHash map[string]APIKey) error {
+	if s.path == "" {
+		return nil
+	}
+
+	keys := make([]APIKey, 0, len(byHash))
+	for _, key := range byHash {
+		keys = append(keys, key)
+	}
+	sortAPIKeys(keys)
+	raw, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".api_keys-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func sortAPIKeys(keys []APIKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Owner != keys[j].Owner {
+			return keys[i].Owner < keys[j].Owner
+		}
+		return keys[i].Hash < keys[j].Hash
+	})
+}
@@ -0,0 +1,86 @@
+package rds
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func testAPIKeyStore(t *testing.T, store APIKeyStore) {
+	ctx := context.Background()
+	key := APIKey{Hash: "abc", Owner: "partner-a", Scopes: []string{"orders:read"}, Plan: "gold", CreatedAt: time.Now().UTC()}
+	if err := store.Put(ctx, key); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	got, ok, err := store.Get(ctx, "abc")
+	if err != nil || !ok {
+		t.Fatalf("Get() = %v, %v, want the stored key", ok, err)
+	}
+	if got.Owner != "partner-a" || got.Plan != "gold" || len(got.Scopes) != 1 {
+		t.Errorf("Get() = %+v, want %+v", got, key)
+	}
+	if _, ok, _ := store.Get(ctx, "missing"); ok {
+		t.Error("Get() found an unknown hash")
+	}
+
+	if keys, _ := store.List(ctx); len(keys) != 1 {
+		t.Errorf("List() = %d keys, want 1", len(keys))
+	}
+	if err := store.Delete(ctx, "abc"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, ok, _ := store.Get(ctx, "abc"); ok {
+		t.Error("Get() found a deleted key")
+	}
+}
+
+func TestRedisAPIKeyStore(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Failed to start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	testAPIKeyStore(t, NewRedisAPIKeyStore(&RedisClient{client: redis.NewClient(&redis.Options{Addr: mr.Addr()})}))
+}
+
+func TestLocalAPIKeyStore_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api_keys.json")
+	store, err := NewLocalAPIKeyStore(path)
+	if err != nil {
+		t.Fatalf("NewLocalAPIKeyStore() error = %v", err)
+	}
+	testAPIKeyStore(t, store)
+
+	if err := store.Put(context.Background(), APIKey{Hash: "def", Owner: "partner-b"}); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	reloaded, err := NewLocalAPIKeyStore(path)
+	if err != nil {
+		t.Fatalf("NewLocalAPIKeyStore() reload error = %v", err)
+	}
+	if got, ok, _ := reloaded.Get(context.Background(), "def"); !ok || got.Owner != "partner-b" {
+		t.Errorf("Get() after reload = %+v, %v, want partner-b", got, ok)
+	}
+
+	// A change that cannot be saved is not served either
+	os.RemoveAll(filepath.Dir(path))
+	if err := store.Put(context.Background(), APIKey{Hash: "ghi", Owner: "partner-c"}); err == nil {
+		t.Fatal("Put() error = nil, want the failed save reported")
+	}
+	if _, ok, _ := store.Get(context.Background(), "ghi"); ok {
+		t.Error("Get() found a key whose save failed")
+	}
+	if err := store.Delete(context.Background(), "def"); err == nil {
+		t.Fatal("Delete() error = nil, want the failed save reported")
+	}
+	if _, ok, _ := store.Get(context.Background(), "def"); !ok {
+		t.Error("Get() lost a key whose deletion failed to save")
+	}
+}
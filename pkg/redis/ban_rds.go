@@ -0,0 +1,277 @@
+package rds
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Ban is a temporary block placed on a client key. Offences counts how many
+// times the key has been banned recently and drives escalation.
+type Ban struct {
+	Key       string    `json:"key"`
+	Reason    string    `json:"reason"`
+	Offences  int64     `json:"offences"`
+	BannedAt  time.Time `json:"banned_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// BanStore counts client failures and keeps active bans.
+type BanStore interface {
+	// RecordFailure adds a failure for key and returns the number of failures
+	// seen within window.
+	RecordFailure(ctx context.Context, key string, window time.Duration) (int64, error)
+	// Offend increments the offence count for key, which is forgotten after
+	// ttl without new offences, and clears its failure history.
+	Offend(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	Ban(ctx context.Context, ban Ban) error
+	Get(ctx context.Context, key string) (Ban, bool, error)
+	Unban(ctx context.Context, key string) error
+	List(ctx context.Context) ([]Ban, error)
+}
+
+// -------------------- redis ban store ---------------------------- //
+
+// RedisBanStore shares failure counts and bans across gateway instances.
+type RedisBanStore struct {
+	client   *redis.Client
+	prefix   string
+	instance string // tells apart failures recorded by different instances
+	counter  atomic.Uint64
+}
+
+func NewRedisBanStore(client *RedisClient) *RedisBanStore {
+	instance := make([]byte, 8)
+	rand.Read(instance)
+	return &RedisBanStore{
+		client:   client.client,
+		prefix:   "ban",
+		instance: hex.EncodeToString(instance),
+	}
+}
+
+func (s *RedisBanStore) RecordFailure(ctx context.Context, key string, window time.Duration) (int64, error) {
+	now := time.Now().UnixMilli()
+	redisKey := fmt.Sprintf("%s:failures:%s", s.prefix, key)
+	member := fmt.Sprintf("%d:%s:%d", now, s.instance, s.counter.Add(1))
+
+	pipe := s.client.Pipeline()
+	pipe.ZAdd(ctx, redisKey, redis.Z{Score: float64(now), Member: member})
+	pipe.ZRemRangeByScore(ctx, redisKey, "-inf", fmt.Sprintf("%d", now-window.Milliseconds()))
+	countCmd := pipe.ZCard(ctx, redisKey)
+	pipe.Expire(ctx, redisKey, window+time.Second)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("redis ban failure count failed: %w", err)
+	}
+	return countCmd.Val(), nil
+}
+
+func (s *RedisBanStore) Offend(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	offencesKey := fmt.Sprintf("%s:offences:%s", s.prefix, key)
+
+	pipe := s.client.TxPipeline()
+	countCmd := pipe.Incr(ctx, offencesKey)
+	pipe.Expire(ctx, offencesKey, ttl)
+	pipe.Del(ctx, fmt.Sprintf("%s:failures:%s", s.prefix, key))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("redis ban offence failed: %w", err)
+	}
+	return countCmd.Val(), nil
+}
+
+func (s *RedisBanStore) Ban(ctx context.Context, ban Ban) error {
+	payload, err := json.Marshal(ban)
+	if err != nil {
+		return err
+	}
+	ttl := time.Until(ban.ExpiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	if err := s.client.Set(ctx, fmt.Sprintf("%s:active:%s", s.prefix, ban.Key), payload, ttl).Err(); err != nil {
+		return fmt.Errorf("redis ban set failed: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisBanStore) Get(ctx context.Context, key string) (Ban, bool, error) {
+	payload, err := s.client.Get(ctx, fmt.Sprintf("%s:active:%s", s.prefix, key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Ban{}, false, nil
+	}
+	if err != nil {
+		return Ban{}, false, fmt.Errorf("redis ban get failed: %w", err)
+	}
+
+	var ban Ban
+	if err := json.Unmarshal(payload, &ban); err != nil {
+		return Ban{}, false, err
+	}
+	return ban, true, nil
+}
+
+func (s *RedisBanStore) Unban(ctx context.Context, key string) error {
+	pipe := s.client.TxPipeline()
+	pipe.Del(ctx, fmt.Sprintf("%s:active:%s", s.prefix, key))
+	pipe.Del(ctx, fmt.Sprintf("%s:failures:%s", s.prefix, key))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis unban failed: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisBanStore) List(ctx context.Context) ([]Ban, error) {
+	var bans []Ban
+	pattern := fmt.Sprintf("%s:active:*", s.prefix)
+	iter := s.client.Scan(ctx, 0, pattern, 100).Iterator()
+	for iter.Next(ctx) {
+		ban, found, err := s.Get(ctx, strings.TrimPrefix(iter.Val(), fmt.Sprintf("%s:active:", s.prefix)))
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			bans = append(bans, ban)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("redis ban scan failed: %w", err)
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].ExpiresAt.Before(bans[j].ExpiresAt) })
+	return bans, nil
+}
+
+// -------------------- local ban store ---------------------------- //
+
+// LocalBanStore keeps failures and bans in process memory.
+type LocalBanStore struct {
+	mu       sync.Mutex
+	failures map[string][]time.Time
+	offences map[string]localOffence
+	bans     map[string]Ban
+}
+
+type localOffence struct {
+	count     int64
+	expiresAt time.Time
+}
+
+func NewLocalBanStore() *LocalBanStore {
+	store := &LocalBanStore{
+		failures: make(map[string][]time.Time),
+		offences: make(map[string]localOffence),
+		bans:     make(map[string]Ban),
+	}
+	go store.cleanupExpired()
+	return store
+}
+
+func (s *LocalBanStore) RecordFailure(ctx context.Context, key string, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	cutoff := now.Add(-window)
+	recent := s.failures[key][:0]
+	for _, at := range s.failures[key] {
+		if at.After(cutoff) {
+			recent = append(recent, at)
+		}
+	}
+	s.failures[key] = append(recent, now)
+	return int64(len(s.failures[key])), nil
+}
+
+func (s *LocalBanStore) Offend(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	offence := s.offences[key]
+	if now.After(offence.expiresAt) {
+		offence.count = 0
+	}
+	offence.count++
+	offence.expiresAt = now.Add(ttl)
+	s.offences[key] = offence
+	delete(s.failures, key)
+	return offence.count, nil
+}
+
+func (s *LocalBanStore) Ban(ctx context.Context, ban Ban) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bans[ban.Key] = ban
+	return nil
+}
+
+func (s *LocalBanStore) Get(ctx context.Context, key string) (Ban, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ban, found := s.bans[key]
+	if !found {
+		return Ban{}, false, nil
+	}
+	if time.Now().After(ban.ExpiresAt) {
+		delete(s.bans, key)
+		return Ban{}, false, nil
+	}
+	return ban, true, nil
+}
+
+func (s *LocalBanStore) Unban(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.bans, key)
+	delete(s.failures, key)
+	return nil
+}
+
+func (s *LocalBanStore) List(ctx context.Context) ([]Ban, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	bans := make([]Ban, 0, len(s.bans))
+	for _, ban := range s.bans {
+		if now.Before(ban.ExpiresAt) {
+			bans = append(bans, ban)
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].ExpiresAt.Before(bans[j].ExpiresAt) })
+	return bans, nil
+}
+
+func (s *LocalBanStore) cleanupExpired() {
+	ticker := time.NewTicker(10 * time.Minute)
+	for range ticker.C {
+		s.mu.Lock()
+		now := time.Now()
+		for key, ban := range s.bans {
+			if now.After(ban.ExpiresAt) {
+				delete(s.bans, key)
+			}
+		}
+		for key, offence := range s.offences {
+			if now.After(offence.expiresAt) {
+				delete(s.offences, key)
+			}
+		}
+		for key, failures := range s.failures {
+			if len(failures) == 0 || now.Sub(failures[len(failures)-1]) > time.Hour {
+				delete(s.failures, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,121 @@
+package rds
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisBanStore(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Failed to start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	store := NewRedisBanStore(&RedisClient{client: redis.NewClient(&redis.Options{Addr: mr.Addr()})})
+	ctx := context.Background()
+	key := "198.51.100.1"
+
+	for i := int64(1); i <= 3; i++ {
+		count, err := store.RecordFailure(ctx, key, time.Minute)
+		if err != nil {
+			t.Fatalf("RecordFailure() error = %v", err)
+		}
+		if count != i {
+			t.Errorf("RecordFailure() = %d, want %d", count, i)
+		}
+	}
+
+	offences, err := store.Offend(ctx, key, time.Hour)
+	if err != nil || offences != 1 {
+		t.Fatalf("Offend() = %d, %v, want 1", offences, err)
+	}
+	if count, _ := store.RecordFailure(ctx, key, time.Minute); count != 1 {
+		t.Errorf("RecordFailure() after Offend = %d, want 1", count)
+	}
+	if offences, _ := store.Offend(ctx, key, time.Hour); offences != 2 {
+		t.Errorf("Offend() = %d, want 2", offences)
+	}
+
+	now := time.Now()
+	ban := Ban{Key: key, Reason: "auth", Offences: 2, BannedAt: now, ExpiresAt: now.Add(time.Minute)}
+	if err := store.Ban(ctx, ban); err != nil {
+		t.Fatalf("Ban() error = %v", err)
+	}
+
+	got, banned, err := store.Get(ctx, key)
+	if err != nil || !banned {
+		t.Fatalf("Get() = %v, %v, want banned", banned, err)
+	}
+	if got.Reason != "auth" || got.Offences != 2 {
+		t.Errorf("Get() = %+v, want reason auth with 2 offences", got)
+	}
+
+	bans, err := store.List(ctx)
+	if err != nil || len(bans) != 1 {
+		t.Fatalf("List() = %v, %v, want one ban", bans, err)
+	}
+
+	if err := store.Unban(ctx, key); err != nil {
+		t.Fatalf("Unban() error = %v", err)
+	}
+	if _, banned, _ := store.Get(ctx, key); banned {
+		t.Error("Get() = banned, want not banned after Unban")
+	}
+
+	// Bans expire with their TTL
+	if err := store.Ban(ctx, ban); err != nil {
+		t.Fatalf("Ban() error = %v", err)
+	}
+	mr.FastForward(2 * time.Minute)
+	if _, banned, _ := store.Get(ctx, key); banned {
+		t.Error("Get() = banned, want expired")
+	}
+}
+
+// Instances count failures together, even when their counters line up
+// within the same millisecond.
+func TestRedisBanStore_SharedAcrossInstances(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Failed to start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	client := &RedisClient{client: redis.NewClient(&redis.Options{Addr: mr.Addr()})}
+	first, second := NewRedisBanStore(client), NewRedisBanStore(client)
+	ctx := context.Background()
+
+	var count int64
+	for i := 0; i < 50; i++ {
+		first.RecordFailure(ctx, "198.51.100.2", time.Minute)
+		count, err = second.RecordFailure(ctx, "198.51.100.2", time.Minute)
+		if err != nil {
+			t.Fatalf("RecordFailure() error = %v", err)
+		}
+	}
+	if count != 100 {
+		t.Errorf("RecordFailure() = %d, want 100", count)
+	}
+}
+
+func TestLocalBanStore(t *testing.T) {
+	store := NewLocalBanStore()
+	ctx := context.Background()
+
+	if count, _ := store.RecordFailure(ctx, "k", time.Minute); count != 1 {
+		t.Errorf("RecordFailure() = %d, want 1", count)
+	}
+	if offences, _ := store.Offend(ctx, "k", time.Hour); offences != 1 {
+		t.Errorf("Offend() = %d, want 1", offences)
+	}
+
+	store.Ban(ctx, Ban{Key: "k", ExpiresAt: time.Now().Add(-time.Second)})
+	if _, banned, _ := store.Get(ctx, "k"); banned {
+		t.Error("Get() = banned, want expired ban ignored")
+	}
+}
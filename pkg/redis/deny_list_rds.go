@@ -0,0 +1,266 @@
+package rds
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mtsgn/mtsgn-mtsgn-system-common-svc/common/logger"
+	"github.com/redis/go-redis/v9"
+)
+
+// DenyEntry is a dynamically added address or CIDR range that is refused
+// until ExpiresAt. A zero ExpiresAt never expires.
+type DenyEntry struct {
+	Entry     string    `json:"entry"`
+	Reason    string    `json:"reason,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+
+	prefix netip.Prefix
+}
+
+func (e DenyEntry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && now.After(e.ExpiresAt)
+}
+
+// DenyList holds deny entries added at runtime. Match is served from memory
+// so it is safe to call on every request.
+type DenyList interface {
+	Add(ctx context.Context, entry string, ttl time.Duration, reason string) error
+	Remove(ctx context.Context, entry string) error
+	List(ctx context.Context) ([]DenyEntry, error)
+	Match(addr netip.Addr) (DenyEntry, bool)
+}
+
+// ParseDenyEntry accepts a bare address or a CIDR range and returns its
+// canonical prefix.
+func ParseDenyEntry(entry string) (netip.Prefix, error) {
+	entry = strings.TrimSpace(entry)
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid deny entry %q: %w", entry, err)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid deny entry %q: %w", entry, err)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+func matchDenyEntries(entries []DenyEntry, addr netip.Addr, now time.Time) (DenyEntry, bool) {
+	addr = addr.Unmap()
+	for _, entry := range entries {
+		if entry.prefix.Contains(addr) && !entry.expired(now) {
+			return entry, true
+		}
+	}
+	return DenyEntry{}, false
+}
+
+// -------------------- redis deny list ---------------------------- //
+
+// RedisDenyList shares deny entries across gateway instances. Entries live in
+// a sorted set scored by expiry time and are mirrored into memory by Refresh,
+// which Watch calls on every refresh interval.
+type RedisDenyList struct {
+	client  *redis.Client
+	key     string
+	refresh time.Duration
+
+	mu      sync.RWMutex
+	entries []DenyEntry
+}
+
+func NewRedisDenyList(client *RedisClient, refresh time.Duration) *RedisDenyList {
+	if refresh <= 0 {
+		refresh = 5 * time.Second
+	}
+	return &RedisDenyList{
+		client:  client.client,
+		key:     "ip_deny",
+		refresh: refresh,
+	}
+}
+
+func (l *RedisDenyList) Add(ctx context.Context, entry string, ttl time.Duration, reason string) error {
+	prefix, err := ParseDenyEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	score := math.Inf(1)
+	if ttl > 0 {
+		score = float64(time.Now().Add(ttl).UnixMilli())
+	}
+
+	pipe := l.client.TxPipeline()
+	pipe.ZAdd(ctx, l.key, redis.Z{Score: score, Member: prefix.String()})
+	pipe.HSet(ctx, l.key+":reasons", prefix.String(), reason)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis deny list add failed: %w", err)
+	}
+	return l.Refresh(ctx)
+}
+
+func (l *RedisDenyList) Remove(ctx context.Context, entry string) error {
+	prefix, err := ParseDenyEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	pipe := l.client.TxPipeline()
+	pipe.ZRem(ctx, l.key, prefix.String())
+	pipe.HDel(ctx, l.key+":reasons", prefix.String())
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis deny list remove failed: %w", err)
+	}
+	return l.Refresh(ctx)
+}
+
+func (l *RedisDenyList) List(ctx context.Context) ([]DenyEntry, error) {
+	if err := l.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return append([]DenyEntry(nil), l.entries...), nil
+}
+
+func (l *RedisDenyList) Match(addr netip.Addr) (DenyEntry, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return matchDenyEntries(l.entries, addr, time.Now())
+}
+
+// Refresh drops expired entries in Redis and reloads the in-memory snapshot.
+func (l *RedisDenyList) Refresh(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	pipe := l.client.Pipeline()
+	pipe.ZRemRangeByScore(ctx, l.key, "-inf", fmt.Sprintf("(%d", now.UnixMilli()))
+	membersCmd := pipe.ZRangeWithScores(ctx, l.key, 0, -1)
+	reasonsCmd := pipe.HGetAll(ctx, l.key+":reasons")
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis deny list refresh failed: %w", err)
+	}
+
+	reasons := reasonsCmd.Val()
+	entries := make([]DenyEntry, 0, len(membersCmd.Val()))
+	for _, member := range membersCmd.Val() {
+		name, _ := member.Member.(string)
+		prefix, err := ParseDenyEntry(name)
+		if err != nil {
+			continue
+		}
+		entry := DenyEntry{Entry: name, Reason: reasons[name], prefix: prefix}
+		if !math.IsInf(member.Score, 1) {
+			entry.ExpiresAt = time.UnixMilli(int64(member.Score))
+		}
+		entries = append(entries, entry)
+	}
+
+	l.mu.Lock()
+	l.entries = entries
+	l.mu.Unlock()
+	return nil
+}
+
+// Watch refreshes the deny list every refresh interval until ctx is done.
+// Failed refreshes keep the previous snapshot.
+func (l *RedisDenyList) Watch(ctx context.Context, logger logger.ZeroLogger) {
+	ticker := time.NewTicker(l.refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.Refresh(ctx); err != nil {
+				logger.Error(ctx, "Failed to refresh deny list, keeping previous entries", "error", err)
+			}
+		}
+	}
+}
+
+// -------------------- local deny list ---------------------------- //
+
+// LocalDenyList keeps deny entries in process memory for single-instance
+// deployments without Redis.
+type LocalDenyList struct {
+	mu      sync.RWMutex
+	entries map[string]DenyEntry
+}
+
+func NewLocalDenyList() *LocalDenyList {
+	return &LocalDenyList{entries: make(map[string]DenyEntry)}
+}
+
+func (l *LocalDenyList) Add(ctx context.Context, entry string, ttl time.Duration, reason string) error {
+	prefix, err := ParseDenyEntry(entry)
+	if err != nil {
+		return err
+	}
+	denyEntry := DenyEntry{Entry: prefix.String(), Reason: reason, prefix: prefix}
+	if ttl > 0 {
+		denyEntry.ExpiresAt = time.Now().Add(ttl)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries[denyEntry.Entry] = denyEntry
+	return nil
+}
+
+func (l *LocalDenyList) Remove(ctx context.Context, entry string) error {
+	prefix, err := ParseDenyEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, prefix.String())
+	return nil
+}
+
+func (l *LocalDenyList) List(ctx context.Context) ([]DenyEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	entries := make([]DenyEntry, 0, len(l.entries))
+	for key, entry := range l.entries {
+		if entry.expired(now) {
+			delete(l.entries, key)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Entry < entries[j].Entry })
+	return entries, nil
+}
+
+func (l *LocalDenyList) Match(addr netip.Addr) (DenyEntry, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	now := time.Now()
+	addr = addr.Unmap()
+	for _, entry := range l.entries {
+		if entry.prefix.Contains(addr) && !entry.expired(now) {
+			return entry, true
+		}
+	}
+	return DenyEntry{}, false
+}
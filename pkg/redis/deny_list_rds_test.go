@@ -0,0 +1,119 @@
+package rds
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/mtsgn/mtsgn-mtsgn-system-common-svc/common/logger"
+	"github.com/redis/go-redis/v9"
+)
+
+func setupTestDenyList(t *testing.T) (*RedisDenyList, *miniredis.Miniredis) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Failed to start miniredis: %v", err)
+	}
+	client := &RedisClient{client: redis.NewClient(&redis.Options{Addr: mr.Addr()})}
+	return NewRedisDenyList(client, time.Hour), mr
+}
+
+func TestRedisDenyList(t *testing.T) {
+	list, mr := setupTestDenyList(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	if err := list.Add(ctx, "203.0.113.0/24", 0, "abuse"); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := list.Add(ctx, "192.0.2.7", 50*time.Millisecond, "scan"); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	entry, denied := list.Match(netip.MustParseAddr("203.0.113.77"))
+	if !denied || entry.Reason != "abuse" {
+		t.Errorf("Match() = %+v, %v, want abuse entry", entry, denied)
+	}
+	if _, denied := list.Match(netip.MustParseAddr("192.0.2.7")); !denied {
+		t.Error("Match() = false, want true before ttl")
+	}
+
+	// A second instance sees entries added by the first
+	other := NewRedisDenyList(&RedisClient{client: list.client}, time.Hour)
+	if err := other.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if _, denied := other.Match(netip.MustParseAddr("203.0.113.1")); !denied {
+		t.Error("Match() on second instance = false, want true")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, denied := list.Match(netip.MustParseAddr("192.0.2.7")); denied {
+		t.Error("Match() = true, want false after ttl")
+	}
+	entries, err := list.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("List() returned %d entries, want 1", len(entries))
+	}
+
+	if err := list.Remove(ctx, "203.0.113.0/24"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if _, denied := list.Match(netip.MustParseAddr("203.0.113.77")); denied {
+		t.Error("Match() = true, want false after Remove")
+	}
+}
+
+func TestRedisDenyList_Watch(t *testing.T) {
+	list, mr := setupTestDenyList(t)
+	defer mr.Close()
+	list.refresh = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		list.Watch(ctx, logger.ZeroLogger{})
+		close(done)
+	}()
+
+	other := NewRedisDenyList(&RedisClient{client: list.client}, time.Hour)
+	if err := other.Add(context.Background(), "198.51.100.4", 0, "abuse"); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, denied := list.Match(netip.MustParseAddr("198.51.100.4")); denied {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Match() = false, want entry picked up by Watch")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Watch() did not return after cancel")
+	}
+}
+
+func TestParseDenyEntry(t *testing.T) {
+	prefix, err := ParseDenyEntry("10.1.2.3/8")
+	if err != nil || prefix.String() != "10.0.0.0/8" {
+		t.Errorf("ParseDenyEntry() = %v, %v, want 10.0.0.0/8", prefix, err)
+	}
+	prefix, err = ParseDenyEntry("::ffff:192.0.2.1")
+	if err != nil || prefix.String() != "192.0.2.1/32" {
+		t.Errorf("ParseDenyEntry() = %v, %v, want 192.0.2.1/32", prefix, err)
+	}
+	if _, err := ParseDenyEntry("nope"); err == nil {
+		t.Error("ParseDenyEntry() expected error")
+	}
+}
@@ -0,0 +1,178 @@
+package rds
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultResponseCacheSize  = 10000
+	defaultResponseCacheBytes = 256 << 20
+)
+
+// CachedResponse is an upstream response kept by the response cache. An
+// entry with Vary set and no Status only records which request headers select
+// the variant stored under a derived key, and expires at FreshUntil with the
+// longest-lived variant.
+type CachedResponse struct {
+	Status               int           `json:"status,omitempty"`
+	Header               http.Header   `json:"header,omitempty"`
+	Body                 []byte        `json:"body,omitempty"`
+	Vary                 []string      `json:"vary,omitempty"`
+	StoredAt             time.Time     `json:"stored_at"`
+	FreshUntil           time.Time     `json:"fresh_until"`
+	StaleWhileRevalidate time.Duration `json:"stale_while_revalidate,omitempty"`
+	StaleIfError         time.Duration `json:"stale_if_error,omitempty"`
+}
+
+// Fresh reports whether the response can be served without contacting the
+// backend.
+func (r *CachedResponse) Fresh(now time.Time) bool {
+	return now.Before(r.FreshUntil)
+}
+
+// StaleWhileRevalidating reports whether the stale response may be served
+// while it is refreshed in the background.
+func (r *CachedResponse) StaleWhileRevalidating(now time.Time) bool {
+	return now.Before(r.FreshUntil.Add(r.StaleWhileRevalidate))
+}
+
+// StaleOnError reports whether the stale response may be served when the
+// backend fails.
+func (r *CachedResponse) StaleOnError(now time.Time) bool {
+	return now.Before(r.FreshUntil.Add(r.StaleIfError))
+}
+
+// ResponseCache stores responses until ttl elapses.
+type ResponseCache interface {
+	Get(ctx context.Context, key string) (*CachedResponse, bool, error)
+	Set(ctx context.Context, key string, resp *CachedResponse, ttl time.Duration) error
+}
+
+// -------------------- redis response cache ---------------------------- //
+
+type RedisResponseCache struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisResponseCache(client *RedisClient) *RedisResponseCache {
+	return &RedisResponseCache{
+		client: client.client,
+		prefix: "response_cache",
+	}
+}
+
+func (c *RedisResponseCache) Get(ctx context.Context, key string) (*CachedResponse, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	raw, err := c.client.Get(ctx, c.prefix+":"+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("redis response cache lookup failed: %w", err)
+	}
+	var resp CachedResponse
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil, false, fmt.Errorf("decode cached response: %w", err)
+	}
+	return &resp, true, nil
+}
+
+func (c *RedisResponseCache) Set(ctx context.Context, key string, resp *CachedResponse, ttl time.Duration) error {
+	raw, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	if err := c.client.Set(ctx, c.prefix+":"+key, raw, ttl).Err(); err != nil {
+		return fmt.Errorf("redis response cache store failed: %w", err)
+	}
+	return nil
+}
+
+// -------------------- local response cache ---------------------------- //
+
+// LocalResponseCache is a bounded LRU of responses in process memory. Both
+// the number of entries and their total body size are limited.
+type LocalResponseCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+	entries    map[string]*list.Element
+	order      *list.List // front is most recently used
+	now        func() time.Time
+}
+
+type localResponseEntry struct {
+	key       string
+	resp      *CachedResponse
+	expiresAt time.Time
+}
+
+func NewLocalResponseCache(maxEntries int, maxBytes int64) *LocalResponseCache {
+	if maxEntries <= 0 {
+		maxEntries = defaultResponseCacheSize
+	}
+	if maxBytes <= 0 {
+		maxBytes = defaultResponseCacheBytes
+	}
+	return &LocalResponseCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+		now:        time.Now,
+	}
+}
+
+func (c *LocalResponseCache) Get(ctx context.Context, key string) (*CachedResponse, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := element.Value.(*localResponseEntry)
+	if !c.now().Before(entry.expiresAt) {
+		c.remove(element)
+		return nil, false, nil
+	}
+	c.order.MoveToFront(element)
+	return entry.resp, true, nil
+}
+
+func (c *LocalResponseCache) Set(ctx context.Context, key string, resp *CachedResponse, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	// A response larger than the whole cache would only evict everything else.
+	if int64(len(resp.Body)) > c.maxBytes {
+		return nil
+	}
+	entry := &localResponseEntry{key: key, resp: resp, expiresAt: c.now().Add(ttl)}
+	c.entries[key] = c.order.PushFront(entry)
+	c.bytes += int64(len(resp.Body))
+	for c.order.Len() > c.maxEntries || c.bytes > c.maxBytes {
+		c.remove(c.order.Back())
+	}
+	return nil
+}
+
+func (c *LocalResponseCache) remove(element *list.Element) {
+	entry := c.order.Remove(element).(*localResponseEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= int64(len(entry.resp.Body))
+}
@@ -0,0 +1,102 @@
+package rds
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func testResponseCache(t *testing.T, cache ResponseCache) {
+	ctx := context.Background()
+	resp := &CachedResponse{
+		Status:     http.StatusOK,
+		Header:     http.Header{"Etag": {`"v1"`}},
+		Body:       []byte("catalogue"),
+		StoredAt:   time.Now().UTC(),
+		FreshUntil: time.Now().Add(time.Minute).UTC(),
+	}
+	if err := cache.Set(ctx, "products", resp, time.Minute); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	got, ok, err := cache.Get(ctx, "products")
+	if err != nil || !ok {
+		t.Fatalf("Get() = %v, %v, want the stored response", ok, err)
+	}
+	if got.Status != http.StatusOK || string(got.Body) != "catalogue" || got.Header.Get("ETag") != `"v1"` {
+		t.Errorf("Get() = %+v, want %+v", got, resp)
+	}
+	if _, ok, _ := cache.Get(ctx, "missing"); ok {
+		t.Error("Get() found an unknown key")
+	}
+}
+
+func TestRedisResponseCache(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Failed to start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	testResponseCache(t, NewRedisResponseCache(&RedisClient{client: redis.NewClient(&redis.Options{Addr: mr.Addr()})}))
+}
+
+func TestLocalResponseCache(t *testing.T) {
+	testResponseCache(t, NewLocalResponseCache(10, 0))
+}
+
+func TestLocalResponseCache_Bounds(t *testing.T) {
+	ctx := context.Background()
+	cache := NewLocalResponseCache(2, 0)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	cache.Set(ctx, "a", &CachedResponse{Status: 200}, time.Minute)
+	cache.Set(ctx, "b", &CachedResponse{Status: 200}, time.Second)
+	cache.Get(ctx, "a")
+	cache.Set(ctx, "c", &CachedResponse{Status: 200}, time.Minute)
+	if _, ok, _ := cache.Get(ctx, "b"); ok {
+		t.Error("least recently used entry was not evicted")
+	}
+	if _, ok, _ := cache.Get(ctx, "a"); !ok {
+		t.Error("recently used entry was evicted")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok, _ := cache.Get(ctx, "c"); ok {
+		t.Error("expired entry was returned")
+	}
+}
+
+func TestLocalResponseCache_ByteLimit(t *testing.T) {
+	ctx := context.Background()
+	cache := NewLocalResponseCache(10, 10)
+	body := func(n int) *CachedResponse { return &CachedResponse{Status: 200, Body: make([]byte, n)} }
+
+	cache.Set(ctx, "a", body(4), time.Minute)
+	cache.Set(ctx, "b", body(4), time.Minute)
+	cache.Get(ctx, "a")
+	cache.Set(ctx, "c", body(4), time.Minute)
+	if _, ok, _ := cache.Get(ctx, "b"); ok {
+		t.Error("least recently used entry was not evicted over the byte limit")
+	}
+	if _, ok, _ := cache.Get(ctx, "a"); !ok {
+		t.Error("recently used entry was evicted")
+	}
+
+	// Replacing an entry releases the bytes of the old body
+	cache.Set(ctx, "a", body(1), time.Minute)
+	cache.Set(ctx, "d", body(5), time.Minute)
+	if cache.bytes != 10 || len(cache.entries) != 3 {
+		t.Errorf("cache holds %d bytes in %d entries, want 10 in 3", cache.bytes, len(cache.entries))
+	}
+
+	cache.Set(ctx, "e", body(11), time.Minute)
+	if _, ok, _ := cache.Get(ctx, "e"); ok || len(cache.entries) != 3 {
+		t.Error("response larger than the cache was stored")
+	}
+}
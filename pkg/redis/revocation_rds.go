@@ -0,0 +1,191 @@
+package rds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Kinds of identifiers that can be revoked.
+const (
+	RevocationSession = "session"
+	RevocationToken   = "token"
+)
+
+// RevocationStore keeps revoked session and token ids until ttl elapses and
+// notifies subscribers of new revocations. A zero ttl never elapses, and is
+// reported as a zero expiry.
+type RevocationStore interface {
+	Revoke(ctx context.Context, kind, id string, ttl time.Duration) error
+	// RevokedUntil reports whether id is revoked and when the revocation
+	// expires.
+	RevokedUntil(ctx context.Context, kind, id string) (time.Time, bool, error)
+	// Subscribe calls fn for every revocation published by any instance until
+	// ctx is done.
+	Subscribe(ctx context.Context, fn func(kind, id string, expiresAt time.Time)) error
+}
+
+// revocationExpiry returns when a revocation made now for ttl expires.
+func revocationExpiry(now time.Time, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return now.Add(ttl)
+}
+
+// -------------------- redis revocation store ---------------------------- //
+
+type RedisRevocationStore struct {
+	client  *redis.Client
+	prefix  string
+	channel string
+}
+
+func NewRedisRevocationStore(client *RedisClient) *RedisRevocationStore {
+	return &RedisRevocationStore{
+		client:  client.client,
+		prefix:  "revoked",
+		channel: "revocations",
+	}
+}
+
+func (s *RedisRevocationStore) Revoke(ctx context.Context, kind, id string, ttl time.Duration) error {
+	if id == "" {
+		return errors.New("revocation id cannot be empty")
+	}
+
+	// Messages are kind:expiry:id, with the expiry in unix milliseconds or 0.
+	var expiry int64
+	if expiresAt := revocationExpiry(time.Now(), ttl); !expiresAt.IsZero() {
+		expiry = expiresAt.UnixMilli()
+	}
+	pipe := s.client.TxPipeline()
+	pipe.Set(ctx, fmt.Sprintf("%s:%s:%s", s.prefix, kind, id), time.Now().Unix(), ttl)
+	pipe.Publish(ctx, s.channel, fmt.Sprintf("%s:%d:%s", kind, expiry, id))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis revoke failed: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisRevocationStore) RevokedUntil(ctx context.Context, kind, id string) (time.Time, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	ttl, err := s.client.PTTL(ctx, fmt.Sprintf("%s:%s:%s", s.prefix, kind, id)).Result()
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("redis revocation lookup failed: %w", err)
+	}
+	switch {
+	case ttl == -2: // missing
+		return time.Time{}, false, nil
+	case ttl < 0: // no expiry
+		return time.Time{}, true, nil
+	}
+	return time.Now().Add(ttl), true, nil
+}
+
+func (s *RedisRevocationStore) Subscribe(ctx context.Context, fn func(kind, id string, expiresAt time.Time)) error {
+	pubsub := s.client.Subscribe(ctx, s.channel)
+	defer pubsub.Close()
+
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return fmt.Errorf("redis revocation subscribe failed: %w", err)
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-messages:
+			if !ok {
+				return errors.New("redis revocation subscription closed")
+			}
+			if kind, id, expiresAt, ok := parseRevocationMessage(msg.Payload); ok {
+				fn(kind, id, expiresAt)
+			}
+		}
+	}
+}
+
+// parseRevocationMessage reads a kind:expiry:id message. Messages without an
+// expiry are reported as expiring now, so that subscribers look them up.
+func parseRevocationMessage(payload string) (kind, id string, expiresAt time.Time, ok bool) {
+	kind, rest, found := strings.Cut(payload, ":")
+	if !found {
+		return "", "", time.Time{}, false
+	}
+	expiry, id, found := strings.Cut(rest, ":")
+	millis, err := strconv.ParseInt(expiry, 10, 64)
+	if !found || err != nil {
+		return kind, rest, time.Now(), true
+	}
+	if millis > 0 {
+		expiresAt = time.UnixMilli(millis)
+	}
+	return kind, id, expiresAt, true
+}
+
+// -------------------- local revocation store ---------------------------- //
+
+// LocalRevocationStore keeps revocations in process memory for
+// single-instance deployments.
+type LocalRevocationStore struct {
+	mu          sync.Mutex
+	revoked     map[string]time.Time // zero never expires
+	subscribers []func(kind, id string, expiresAt time.Time)
+}
+
+func NewLocalRevocationStore() *LocalRevocationStore {
+	return &LocalRevocationStore{revoked: make(map[string]time.Time)}
+}
+
+func (s *LocalRevocationStore) Revoke(ctx context.Context, kind, id string, ttl time.Duration) error {
+	if id == "" {
+		return errors.New("revocation id cannot be empty")
+	}
+
+	s.mu.Lock()
+	now := time.Now()
+	for key, expiresAt := range s.revoked {
+		if !expiresAt.IsZero() && now.After(expiresAt) {
+			delete(s.revoked, key)
+		}
+	}
+	expiresAt := revocationExpiry(now, ttl)
+	s.revoked[kind+":"+id] = expiresAt
+	subscribers := append([]func(kind, id string, expiresAt time.Time){}, s.subscribers...)
+	s.mu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(kind, id, expiresAt)
+	}
+	return nil
+}
+
+func (s *LocalRevocationStore) RevokedUntil(ctx context.Context, kind, id string) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt, found := s.revoked[kind+":"+id]
+	if !found || (!expiresAt.IsZero() && time.Now().After(expiresAt)) {
+		return time.Time{}, false, nil
+	}
+	return expiresAt, true, nil
+}
+
+func (s *LocalRevocationStore) Subscribe(ctx context.Context, fn func(kind, id string, expiresAt time.Time)) error {
+	s.mu.Lock()
+	s.subscribers = append(s.subscribers, fn)
+	s.mu.Unlock()
+
+	<-ctx.Done()
+	return nil
+}
@@ -48,6 +48,25 @@ func NewRedisSlidingWindowLimiter(cfg *config.RedisConfig, limit int, window tim
 	}, nil
 }
 
+// WithLimit returns a limiter that shares this limiter's connection but keeps
+// its counters under a separate prefix, so independent policies never consume
+// each other's budget.
+func (l *RedisSlidingWindowLimiter) WithLimit(name string, limit int, window time.Duration) *RedisSlidingWindowLimiter {
+	if limit <= 0 {
+		limit = l.limit
+	}
+	if window <= 0 {
+		window = l.window
+	}
+	return &RedisSlidingWindowLimiter{
+		client:  l.client,
+		prefix:  fmt.Sprintf("%s:%s", l.prefix, name),
+		limit:   limit,
+		window:  window,
+		counter: atomic.Uint64{},
+	}
+}
+
 func (l *RedisSlidingWindowLimiter) Allow(ctx context.Context, key string) (bool, error) {
 	// Validate input
 	if key == "" {
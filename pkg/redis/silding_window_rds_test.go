@@ -296,6 +296,46 @@ func TestRedisSlidingWindowLimiter_Allow(t *testing.T) {
 	})
 }
 
+func TestRedisSlidingWindowLimiter_WithLimit(t *testing.T) {
+	limiter, mr := setupTestRedis(t)
+	defer mr.Close()
+	defer limiter.client.Close()
+
+	policy := limiter.WithLimit("strict", 2, time.Second)
+	if policy.prefix != "rate_limit:strict" {
+		t.Errorf("Expected prefix rate_limit:strict, got %s", policy.prefix)
+	}
+
+	key := "test_key_policy"
+	for i := 0; i < 2; i++ {
+		allowed, err := policy.Allow(context.Background(), key)
+		if err != nil {
+			t.Fatalf("Allow() error = %v", err)
+		}
+		if !allowed {
+			t.Errorf("Allow() = false, want true for request %d", i+1)
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	allowed, err := policy.Allow(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+	if allowed {
+		t.Error("Allow() = true, want false for request over policy limit")
+	}
+
+	// The parent limiter keeps its own budget for the same key
+	allowed, err = limiter.Allow(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+	if !allowed {
+		t.Error("Allow() = false, want true on parent limiter")
+	}
+}
+
 func TestRedisSlidingWindowLimiter_Allow_EdgeCases(t *testing.T) {
 	limiter, mr := setupTestRedis(t)
 	defer mr.Close()
@@ -1,24 +1,173 @@
 package utils
 
 import (
+	"context"
+	"fmt"
+	"net"
 	"net/http"
+	"net/netip"
 	"strings"
 )
 
-func GetClientIP(r *http.Request) string {
-	// Check for X-Forwarded-For header (from proxy)
-	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
-		ips := strings.Split(forwarded, ",")
-		if len(ips) > 0 {
-			return strings.TrimSpace(ips[0])
+type clientIPContextKey struct{}
+
+// ClientIPResolver determines the originating client address of a request.
+// Forwarding headers are only honoured when the connecting peer is a trusted
+// proxy, and are walked right to left so that a client cannot spoof its
+// address by prepending entries of its own.
+type ClientIPResolver struct {
+	trusted []netip.Prefix
+}
+
+// NewClientIPResolver accepts CIDR ranges or bare addresses of trusted proxies.
+func NewClientIPResolver(trustedProxies []string) (*ClientIPResolver, error) {
+	resolver := &ClientIPResolver{}
+	for _, entry := range trustedProxies {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+			}
+			resolver.trusted = append(resolver.trusted, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
 		}
+		addr = addr.Unmap()
+		resolver.trusted = append(resolver.trusted, netip.PrefixFrom(addr, addr.BitLen()))
 	}
+	return resolver, nil
+}
 
-	// Check for X-Real-IP header
-	if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
-		return realIP
+// IsTrusted reports whether addr belongs to a trusted proxy range.
+func (c *ClientIPResolver) IsTrusted(addr netip.Addr) bool {
+	if c == nil || !addr.IsValid() {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range c.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
 	}
+	return false
+}
 
-	// Fallback to remote address
-	return strings.Split(r.RemoteAddr, ":")[0]
+// Resolve returns the client address for r. The peer address is used unless
+// it is a trusted proxy, in which case the Forwarded header (RFC 7239) or
+// X-Forwarded-For is walked from the right until the first untrusted hop.
+func (c *ClientIPResolver) Resolve(r *http.Request) string {
+	remote, ok := parseHost(r.RemoteAddr)
+	if !ok {
+		return r.RemoteAddr
+	}
+	if !c.IsTrusted(remote) {
+		return remote.String()
+	}
+
+	if hops := forwardedFor(r.Header.Values("Forwarded")); len(hops) > 0 {
+		return c.walk(hops, remote).String()
+	}
+
+	var hops []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(value, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	if len(hops) > 0 {
+		return c.walk(hops, remote).String()
+	}
+
+	if realIP, ok := parseHost(r.Header.Get("X-Real-IP")); ok {
+		return realIP.String()
+	}
+	return remote.String()
+}
+
+// walk returns the right-most hop that is not a trusted proxy. An unparseable
+// hop ends the walk at the last address that could be verified.
+func (c *ClientIPResolver) walk(hops []string, remote netip.Addr) netip.Addr {
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseHost(hops[i])
+		if !ok {
+			return client
+		}
+		client = addr
+		if !c.IsTrusted(addr) {
+			return client
+		}
+	}
+	return client
+}
+
+// forwardedFor extracts the for= parameters of RFC 7239 Forwarded headers in
+// the order they were appended.
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, val, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if !found || !strings.EqualFold(key, "for") {
+					continue
+				}
+				hops = append(hops, strings.Trim(strings.TrimSpace(val), `"`))
+			}
+		}
+	}
+	return hops
+}
+
+// parseHost parses an address that may carry a port, brackets or an IPv6 zone.
+func parseHost(value string) (netip.Addr, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return netip.Addr{}, false
+	}
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.WithZone("").Unmap(), true
+}
+
+// RemoteIP returns the host part of a RemoteAddr, handling IPv6 literals.
+func RemoteIP(remoteAddr string) string {
+	if addr, ok := parseHost(remoteAddr); ok {
+		return addr.String()
+	}
+	return remoteAddr
+}
+
+// WithClientIP stores the resolved client address in ctx.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPContextKey{}, ip)
+}
+
+// ClientIPFromContext returns the client address stored by WithClientIP.
+func ClientIPFromContext(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(clientIPContextKey{}).(string)
+	return ip, ok && ip != ""
+}
+
+// GetClientIP returns the client address resolved for this request, or the
+// peer address when no resolver has run. Forwarding headers are never trusted
+// here; use ClientIPResolver for that.
+func GetClientIP(r *http.Request) string {
+	if ip, ok := ClientIPFromContext(r.Context()); ok {
+		return ip
+	}
+	return RemoteIP(r.RemoteAddr)
 }
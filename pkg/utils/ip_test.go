@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPResolver_Resolve(t *testing.T) {
+	resolver, err := NewClientIPResolver([]string{"10.0.0.0/8", "2001:db8::/32", "127.0.0.1"})
+	if err != nil {
+		t.Fatalf("NewClientIPResolver() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{
+			name:       "untrusted peer ignores forwarding headers",
+			remoteAddr: "203.0.113.7:5000",
+			headers:    map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Real-IP": "5.6.7.8"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "trusted peer walks xff from the right",
+			remoteAddr: "10.0.0.2:5000",
+			headers:    map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.9, 10.0.0.5"},
+			want:       "198.51.100.9",
+		},
+		{
+			name:       "all hops trusted returns left-most",
+			remoteAddr: "10.0.0.2:5000",
+			headers:    map[string]string{"X-Forwarded-For": "10.1.1.1, 10.0.0.5"},
+			want:       "10.1.1.1",
+		},
+		{
+			name:       "unparseable hop stops the walk",
+			remoteAddr: "10.0.0.2:5000",
+			headers:    map[string]string{"X-Forwarded-For": "1.2.3.4, garbage, 10.0.0.5"},
+			want:       "10.0.0.5",
+		},
+		{
+			name:       "forwarded header takes precedence",
+			remoteAddr: "127.0.0.1:5000",
+			headers: map[string]string{
+				"Forwarded":       `for=192.0.2.60;proto=http, for="[2001:db8:cafe::17]:4711"`,
+				"X-Forwarded-For": "9.9.9.9",
+			},
+			want: "192.0.2.60",
+		},
+		{
+			name:       "x-real-ip from trusted peer",
+			remoteAddr: "127.0.0.1:5000",
+			headers:    map[string]string{"X-Real-IP": "198.51.100.1"},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "ipv6 remote address",
+			remoteAddr: "[2a00:1450::1]:443",
+			want:       "2a00:1450::1",
+		},
+		{
+			name:       "ipv4-mapped ipv6 peer is trusted",
+			remoteAddr: "[::ffff:10.0.0.2]:5000",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.2"},
+			want:       "198.51.100.2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+			if got := resolver.Resolve(r); got != tt.want {
+				t.Errorf("Resolve() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewClientIPResolver_Invalid(t *testing.T) {
+	if _, err := NewClientIPResolver([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("NewClientIPResolver() expected error for invalid CIDR")
+	}
+	if _, err := NewClientIPResolver([]string{"not-an-ip"}); err == nil {
+		t.Error("NewClientIPResolver() expected error for invalid address")
+	}
+}
+
+func TestGetClientIP(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "[::1]:8080"
+	r.Header.Set("X-Forwarded-For", "1.2.3.4")
+	if got := GetClientIP(r); got != "::1" {
+		t.Errorf("GetClientIP() = %q, want ::1", got)
+	}
+
+	r = r.WithContext(WithClientIP(r.Context(), "198.51.100.3"))
+	if got := GetClientIP(r); got != "198.51.100.3" {
+		t.Errorf("GetClientIP() = %q, want value from context", got)
+	}
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"context"
+
+	"github.com/mtsgn/mtsgn-mtsgn-system-common-svc/common/logger"
+)
+
+// ContextLogger adds the request ID found in ctx to every log line.
+type ContextLogger struct {
+	logger.ZeroLogger
+}
+
+func NewContextLogger(logger logger.ZeroLogger) ContextLogger {
+	return ContextLogger{ZeroLogger: logger}
+}
+
+func (l ContextLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	l.ZeroLogger.Info(ctx, msg, withRequestID(ctx, args)...)
+}
+
+func (l ContextLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	l.ZeroLogger.Error(ctx, msg, withRequestID(ctx, args)...)
+}
+
+func (l ContextLogger) Debug(ctx context.Context, msg string, args ...interface{}) {
+	l.ZeroLogger.Debug(ctx, msg, withRequestID(ctx, args)...)
+}
+
+func withRequestID(ctx context.Context, args []interface{}) []interface{} {
+	if ctx == nil {
+		return args
+	}
+	id, ok := RequestIDFromContext(ctx)
+	if !ok {
+		return args
+	}
+	return append([]interface{}{"request_id", id}, args...)
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+)
+
+// RequestIDHeader carries the request ID between clients, the gateway and
+// upstream services.
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+type requestIDContextKey struct{}
+
+// ValidRequestID reports whether an inbound request ID is safe to reuse. Only
+// short tokens of letters, digits and ._:- are accepted so that client values
+// cannot inject into logs or headers.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// WithRequestID stores the request ID in ctx.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID stored by WithRequestID.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDContextKey{}).(string)
+	return id, ok && id != ""
+}
+
+// GetRequestID returns the request ID assigned to r, or an empty string when
+// the RequestID middleware has not run.
+func GetRequestID(r *http.Request) string {
+	id, _ := RequestIDFromContext(r.Context())
+	return id
+}